@@ -1,6 +1,6 @@
 module github.com/cloudbees/lighthouse-githubapp
 
-go 1.13
+go 1.16
 
 require (
 	github.com/blang/semver v3.5.1+incompatible
@@ -12,11 +12,19 @@ require (
 	github.com/jenkins-x/go-scm v1.5.145
 	github.com/jenkins-x/jx-logging v0.0.10
 	github.com/jenkins-x/logrus-stackdriver-formatter v0.2.3
+	github.com/nats-io/nats-server/v2 v2.1.7
+	github.com/nats-io/nats.go v1.10.0
 	github.com/patrickmn/go-cache v2.1.0+incompatible
 	github.com/pkg/errors v0.9.1
+	github.com/prometheus/client_golang v1.1.0
 	github.com/sirupsen/logrus v1.6.0
 	github.com/stretchr/testify v1.6.1
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
 	gopkg.in/DataDog/dd-trace-go.v1 v1.19.0
+	gopkg.in/yaml.v2 v2.3.0
 )
 
 exclude github.com/jenkins-x/jx/pkg/prow v0.0.0-20191018175829-4badc08866cd
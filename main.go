@@ -2,38 +2,81 @@ package main
 
 import (
 	"context"
+	"flag"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/cloudbees/lighthouse-githubapp/pkg/admin"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/cmd"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
 	"github.com/cloudbees/lighthouse-githubapp/pkg/loghelpers"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tracing"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/util"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/version"
 
-	"github.com/cloudbees/lighthouse-githubapp/pkg/flags"
 	"github.com/cloudbees/lighthouse-githubapp/pkg/hook"
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	muxtrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gorilla/mux"
-	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
 func main() {
 	loghelpers.InitLogrus()
 
-	if flags.DebugLogging.Value() {
+	if len(os.Args) > 1 && cmd.Lookup(os.Args[1]) != nil {
+		os.Exit(cmd.Run(context.Background(), &cmd.IO{In: os.Stdin, Out: os.Stdout, Err: os.Stderr}, os.Args[1:]))
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		logrus.WithError(err).Fatalf("failed to load the configuration")
+	}
+	err = cfg.Validate()
+	if err != nil {
+		logrus.Fatal(err.Error())
+	}
+	util.ConfigureTransport(cfg.HTTP.TransportSettings())
+	if cfg.Preflight {
+		report := hook.Doctor(context.Background(), cfg)
+		report.Write(os.Stderr)
+		if !report.OK {
+			logrus.Fatal("the preflight checks failed")
+		}
+	}
+
+	if cfg.DebugLogging {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 
 	logrus.Info("Lighthouse GitHub App is starting")
 
-	if flags.DataDogEnabled.Value() {
-		tracer.Start()
-		defer tracer.Stop()
+	exporter := cfg.TracingExporter
+	if exporter == "" && cfg.DataDogEnabled {
+		exporter = tracing.ExporterDatadog
+	}
+	tracer, err := tracing.Init(context.Background(), exporter, *version.GetBuildVersion())
+	if err != nil {
+		logrus.WithError(err).Fatalf("failed to initialise tracing")
+	}
+	shutdownTracing := func(ctx context.Context) {
+		// flushes the spans buffered by the exporter
+		err := tracer.Shutdown(ctx)
+		if err != nil {
+			logrus.WithError(err).Warn("failed to shutdown tracing")
+		}
 	}
 
-	router := muxtrace.NewRouter(muxtrace.WithServiceName("lighthouse-githubapp"))
+	router := muxtrace.NewRouter(muxtrace.WithServiceName(tracing.ServiceName))
+	router.Use(tracing.Middleware)
 
-	handler, err := hook.NewHook()
+	handler, err := hook.NewHook(cfg)
 	if err != nil {
 		logrus.WithError(err).Fatalf("failed to create hook")
 	}
@@ -44,20 +87,60 @@ func main() {
 	http.Handle("/", router)
 	server := &http.Server{Addr: ":" + handler.Port, Handler: router}
 
+	adminRouter := mux.NewRouter()
+	adminServer := admin.NewServer(cfg.AdminPort, cfg.Redacted)
+	adminServer.Handle(adminRouter)
+	adminRouter.Handle(hook.MetricsPath, metrics.Handler())
+	handler.RegisterAdmin(adminServer)
+	adminHTTPServer := &http.Server{Addr: ":" + adminServer.Port, Handler: adminRouter}
+	go func() {
+		logrus.Infof("admin endpoints are listening on port %s", adminServer.Port)
+		err := adminHTTPServer.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).Errorf("admin server failed")
+		}
+	}()
+
+	recheckCtx, stopRecheck := context.WithCancel(context.Background())
+	go handler.RunPendingRecheck(recheckCtx, time.Duration(cfg.PendingRecheckInterval)*time.Second)
+	if cfg.RateLimitPollInterval > 0 {
+		go handler.RunRateLimitPoll(recheckCtx, time.Duration(cfg.RateLimitPollInterval)*time.Second)
+	}
+
 	// Shutdown gracefully on SIGTERM or SIGINT
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		<-sig
 		logrus.Info("lighthouse github app is shutting down...")
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 		defer cancel()
-		err = server.Shutdown(ctx)
+		stopRecheck()
+		// stop taking webhooks before the queued and held ones are flushed
+		// so none arrive after the sinks are closed
+		err := server.Shutdown(ctx)
 		if err != nil {
 			logrus.Errorf("unable to shutdown cleanly: %s", err)
 		}
+		err = adminHTTPServer.Shutdown(ctx)
+		if err != nil {
+			logrus.Errorf("unable to shutdown the admin server cleanly: %s", err)
+		}
+		err = handler.Close()
+		if err != nil {
+			logrus.WithError(err).Warn("failed to close the relay sinks")
+		}
+		shutdownTracing(ctx)
 	}()
 
 	err = server.ListenAndServe()
-	logrus.Fatalf(err.Error())
+	if err != http.ErrServerClosed {
+		shutdownTracing(context.Background())
+		logrus.Fatalf(err.Error())
+	}
+	// ListenAndServe returns as soon as the shutdown starts so wait for it to finish
+	<-stopped
+	logrus.Info("lighthouse github app has shut down")
 }
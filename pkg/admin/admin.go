@@ -0,0 +1,218 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// PprofPath URL path prefix for the pprof endpoints
+	PprofPath = "/debug/pprof/"
+	// ConfigPath URL path for the HTTP endpoint which returns the redacted effective configuration
+	ConfigPath = "/debug/config"
+	// LogLevelPath URL path for the HTTP endpoint to view and change the log level
+	LogLevelPath = "/debug/loglevel"
+	// CachesPath URL path for the HTTP endpoint which lists the caches
+	CachesPath = "/debug/caches"
+	// CachePath URL path for the HTTP endpoint to purge a cache
+	CachePath = "/debug/caches/{name}"
+	// InspectPath URL path for the HTTP endpoint which returns the state of all the inspectors
+	InspectPath = "/debug/inspect"
+	// InspectorPath URL path for the HTTP endpoint which returns the state of an inspector
+	InspectorPath = "/debug/inspect/{name}"
+	// ActionPath URL path for the HTTP endpoint to run an action
+	ActionPath = "/debug/actions/{name}"
+)
+
+// invalidRequestError an error caused by the request to an action rather than the action failing
+type invalidRequestError struct {
+	err error
+}
+
+func (e *invalidRequestError) Error() string {
+	return e.err.Error()
+}
+
+// InvalidRequest marks the error of an action as caused by its request so that HTTP 400 is returned
+func InvalidRequest(err error) error {
+	return &invalidRequestError{err: err}
+}
+
+// Server the admin endpoints which are served on a private port that is not exposed via the ingress
+type Server struct {
+	Port       string
+	configFn   func() map[string]interface{}
+	lock       sync.RWMutex
+	caches     map[string]func()
+	inspectors map[string]func() interface{}
+	actions    map[string]func(r *http.Request) (interface{}, error)
+}
+
+// NewServer creates a new admin server for the port using the function to return the effective configuration
+func NewServer(port string, configFn func() map[string]interface{}) *Server {
+	return &Server{
+		Port:       port,
+		configFn:   configFn,
+		caches:     map[string]func(){},
+		inspectors: map[string]func() interface{}{},
+		actions:    map[string]func(r *http.Request) (interface{}, error){},
+	}
+}
+
+// RegisterCache registers a cache which can be purged at runtime
+func (s *Server) RegisterCache(name string, purge func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.caches[name] = purge
+}
+
+// RegisterInspector registers a function which returns some internal state such as queues or circuit breakers
+func (s *Server) RegisterInspector(name string, fn func() interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.inspectors[name] = fn
+}
+
+// RegisterAction registers a function which can be triggered at runtime such as by another service. The function
+// can read the body and query parameters of the request and should wrap errors caused by them with InvalidRequest.
+func (s *Server) RegisterAction(name string, fn func(r *http.Request) (interface{}, error)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.actions[name] = fn
+}
+
+// Handle registers the admin endpoints on the router
+func (s *Server) Handle(router *mux.Router) {
+	router.HandleFunc(PprofPath+"cmdline", pprof.Cmdline)
+	router.HandleFunc(PprofPath+"profile", pprof.Profile)
+	router.HandleFunc(PprofPath+"symbol", pprof.Symbol)
+	router.HandleFunc(PprofPath+"trace", pprof.Trace)
+	router.PathPrefix(PprofPath).HandlerFunc(pprof.Index)
+
+	router.HandleFunc(ConfigPath, s.config).Methods(http.MethodGet)
+	router.HandleFunc(LogLevelPath, s.getLogLevel).Methods(http.MethodGet)
+	router.HandleFunc(LogLevelPath, s.setLogLevel).Methods(http.MethodPut, http.MethodPost)
+	router.HandleFunc(CachesPath, s.listCaches).Methods(http.MethodGet)
+	router.HandleFunc(CachePath, s.purgeCache).Methods(http.MethodDelete)
+	router.HandleFunc(InspectPath, s.inspectAll).Methods(http.MethodGet)
+	router.HandleFunc(InspectorPath, s.inspect).Methods(http.MethodGet)
+	router.HandleFunc(ActionPath, s.runAction).Methods(http.MethodPost)
+}
+
+// config returns the effective configuration with any secrets redacted
+func (s *Server) config(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.configFn())
+}
+
+// getLogLevel returns the current log level
+func (s *Server) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"level": logrus.GetLevel().String()})
+}
+
+// setLogLevel changes the log level using the level query parameter
+func (s *Server) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	text := r.URL.Query().Get("level")
+	level, err := logrus.ParseLevel(text)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid log level '%s': %s", text, err.Error()), http.StatusBadRequest)
+		return
+	}
+	logrus.SetLevel(level)
+	logrus.Infof("log level changed to %s", level.String())
+	writeJSON(w, map[string]string{"level": level.String()})
+}
+
+// listCaches returns the names of the caches which can be purged
+func (s *Server) listCaches(w http.ResponseWriter, r *http.Request) {
+	s.lock.RLock()
+	names := make([]string, 0, len(s.caches))
+	for name := range s.caches {
+		names = append(names, name)
+	}
+	s.lock.RUnlock()
+	sort.Strings(names)
+	writeJSON(w, names)
+}
+
+// purgeCache purges the named cache
+func (s *Server) purgeCache(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	s.lock.RLock()
+	purge := s.caches[name]
+	s.lock.RUnlock()
+	if purge == nil {
+		http.Error(w, fmt.Sprintf("unknown cache %s", name), http.StatusNotFound)
+		return
+	}
+	purge()
+	logrus.Infof("purged cache %s", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// inspectAll returns the state of all the inspectors keyed by name
+func (s *Server) inspectAll(w http.ResponseWriter, r *http.Request) {
+	s.lock.RLock()
+	results := map[string]interface{}{}
+	for name, fn := range s.inspectors {
+		results[name] = fn()
+	}
+	s.lock.RUnlock()
+	writeJSON(w, results)
+}
+
+// inspect returns the state of the named inspector
+func (s *Server) inspect(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	s.lock.RLock()
+	fn := s.inspectors[name]
+	s.lock.RUnlock()
+	if fn == nil {
+		http.Error(w, fmt.Sprintf("unknown inspector %s", name), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, fn())
+}
+
+// runAction runs the named action and returns its result
+func (s *Server) runAction(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	s.lock.RLock()
+	fn := s.actions[name]
+	s.lock.RUnlock()
+	if fn == nil {
+		http.Error(w, fmt.Sprintf("unknown action %s", name), http.StatusNotFound)
+		return
+	}
+	result, err := fn(r)
+	if invalid, ok := err.(*invalidRequestError); ok {
+		http.Error(w, fmt.Sprintf("invalid request for action %s: %s", name, invalid.Error()), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).Warnf("action %s failed", name)
+		http.Error(w, fmt.Sprintf("action %s failed: %s", name, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("ran action %s", name)
+	writeJSON(w, result)
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	if err != nil {
+		logrus.WithError(err).Debug("failed to write the admin response")
+	}
+}
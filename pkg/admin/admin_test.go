@@ -0,0 +1,147 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminEndpoints(t *testing.T) {
+	purged := false
+	server := NewServer("8081", func() map[string]interface{} {
+		return map[string]interface{}{"LHA_HMAC_TOKEN": "*****"}
+	})
+	server.RegisterCache("tokens", func() {
+		purged = true
+	})
+	server.RegisterInspector("relay", func() interface{} {
+		return map[string]int{"depth": 3}
+	})
+	server.RegisterAction("recheck", func(r *http.Request) (interface{}, error) {
+		return map[string]int{"delivered": 2}, nil
+	})
+	server.RegisterAction("fail", func(r *http.Request) (interface{}, error) {
+		if r.URL.Query().Get("sample") == "" {
+			return nil, InvalidRequest(errors.New("missing sample"))
+		}
+		return nil, errors.New("tenant service unavailable")
+	})
+	router := mux.NewRouter()
+	server.Handle(router)
+
+	level := logrus.GetLevel()
+	defer logrus.SetLevel(level)
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedBody   interface{}
+	}{
+		{
+			name:           "config",
+			method:         http.MethodGet,
+			path:           "/debug/config",
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]interface{}{"LHA_HMAC_TOKEN": "*****"},
+		},
+		{
+			name:           "set log level",
+			method:         http.MethodPut,
+			path:           "/debug/loglevel?level=debug",
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]interface{}{"level": "debug"},
+		},
+		{
+			name:           "invalid log level",
+			method:         http.MethodPut,
+			path:           "/debug/loglevel?level=chatty",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "list caches",
+			method:         http.MethodGet,
+			path:           "/debug/caches",
+			expectedStatus: http.StatusOK,
+			expectedBody:   []interface{}{"tokens"},
+		},
+		{
+			name:           "purge unknown cache",
+			method:         http.MethodDelete,
+			path:           "/debug/caches/unknown",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "purge cache",
+			method:         http.MethodDelete,
+			path:           "/debug/caches/tokens",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "inspect",
+			method:         http.MethodGet,
+			path:           "/debug/inspect/relay",
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]interface{}{"depth": float64(3)},
+		},
+		{
+			name:           "run action",
+			method:         http.MethodPost,
+			path:           "/debug/actions/recheck",
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]interface{}{"delivered": float64(2)},
+		},
+		{
+			name:           "failed action",
+			method:         http.MethodPost,
+			path:           "/debug/actions/fail?sample=push",
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "invalid action request",
+			method:         http.MethodPost,
+			path:           "/debug/actions/fail",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown action",
+			method:         http.MethodPost,
+			path:           "/debug/actions/unknown",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "pprof",
+			method:         http.MethodGet,
+			path:           "/debug/pprof/",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			if tc.expectedBody != nil {
+				var body interface{}
+				err = json.Unmarshal(rr.Body.Bytes(), &body)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedBody, body)
+			}
+		})
+	}
+
+	assert.True(t, purged, "the tokens cache should have been purged")
+	assert.Equal(t, logrus.DebugLevel, logrus.GetLevel())
+}
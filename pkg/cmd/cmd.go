@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hmac"
+	"github.com/pkg/errors"
+)
+
+// IO the streams of a command
+type IO struct {
+	In  io.Reader
+	Out io.Writer
+	Err io.Writer
+}
+
+// Command an operator subcommand of the binary which is run instead of the server
+type Command struct {
+	Name        string
+	Description string
+	Run         func(ctx context.Context, streams *IO, args []string) error
+}
+
+// errUsage returned when a command was invoked with invalid arguments after printing its usage
+var errUsage = errors.New("invalid arguments")
+
+// Commands the subcommands of the binary
+func Commands() []*Command {
+	return []*Command{
+		{Name: "sign", Description: "print the signature headers of a payload", Run: runSign},
+		{Name: "verify", Description: "verify the signature of a payload", Run: runVerify},
+		{Name: "send", Description: "send a payload to a Lighthouse URL as a signed webhook", Run: runSend},
+		{Name: "replay", Description: "fetch a delivery of the App from GitHub and send it again", Run: runReplay},
+		{Name: "routes", Description: "resolve the workspaces a repository is routed to", Run: runRoutes},
+		{Name: "doctor", Description: "check the configuration, App credentials and the services the App depends on", Run: runDoctor},
+	}
+}
+
+// Lookup returns the command with the name or nil if there is no such command
+func Lookup(name string) *Command {
+	for _, c := range Commands() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Run runs the command named by the first argument returning the exit code of the process
+func Run(ctx context.Context, streams *IO, args []string) int {
+	if len(args) == 0 {
+		writeUsage(streams.Err)
+		return 2
+	}
+	c := Lookup(args[0])
+	if c == nil {
+		fmt.Fprintf(streams.Err, "unknown command %q\n\n", args[0])
+		writeUsage(streams.Err)
+		return 2
+	}
+	err := c.Run(ctx, streams, args[1:])
+	switch {
+	case err == nil:
+		return 0
+	case err == flag.ErrHelp:
+		return 0
+	case err == errUsage:
+		return 2
+	}
+	fmt.Fprintf(streams.Err, "%s: %s\n", c.Name, err.Error())
+	return 1
+}
+
+func writeUsage(out io.Writer) {
+	fmt.Fprintf(out, "Usage: lighthouse-githubapp <command> [flags]\n\nCommands:\n")
+	for _, c := range Commands() {
+		fmt.Fprintf(out, "  %-8s %s\n", c.Name, c.Description)
+	}
+	fmt.Fprintf(out, "\nWithout a command the server is started. Use lighthouse-githubapp <command> -h for the flags of a command.\n")
+}
+
+// newFlagSet creates the flags of a command
+func newFlagSet(streams *IO, name string, arguments string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(streams.Err)
+	fs.Usage = func() {
+		fmt.Fprintf(streams.Err, "Usage: lighthouse-githubapp %s [flags] %s\n\n", name, arguments)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags returning errUsage if they are invalid or there are more than the maximum number of
+// arguments
+func parse(fs *flag.FlagSet, args []string, maxArgs int) error {
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return err
+	}
+	if err != nil {
+		return errUsage
+	}
+	if fs.NArg() > maxArgs {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// secretFlags the flags of the HMAC secret which signs or verifies a payload
+type secretFlags struct {
+	algorithm string
+	secret    string
+	file      string
+	base64    bool
+}
+
+func (f *secretFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.algorithm, "algorithm", "sha256", "the HMAC algorithm which is either sha1, sha256 or sha512")
+	fs.StringVar(&f.secret, "secret", "", "the HMAC secret")
+	fs.StringVar(&f.file, "secret-file", "", "the file containing the HMAC secret")
+	fs.BoolVar(&f.base64, "base64", false, "the secret is base64 encoded as the tenant service stores the HMAC of a workspace")
+}
+
+// set returns true if the secret was specified
+func (f *secretFlags) set() bool {
+	return f.secret != "" || f.file != ""
+}
+
+// generator returns the generator of the secret
+func (f *secretFlags) generator() (*hmac.Generator, error) {
+	secret := f.secret
+	if f.file != "" {
+		data, err := ioutil.ReadFile(f.file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read the secret file %s", f.file)
+		}
+		secret = strings.TrimSpace(string(data))
+	}
+	if secret == "" {
+		return nil, errors.New("the secret must be specified with --secret or --secret-file")
+	}
+	key := []byte(secret)
+	if f.base64 {
+		decoded, err := base64.StdEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, errors.Wrap(err, "the secret is not base64 encoded")
+		}
+		key = decoded
+	}
+	return hmac.NewGenerator(f.algorithm, key)
+}
+
+// openPayload opens the payload file or the standard input if the name is empty or -
+func openPayload(streams *IO, name string) (io.ReadCloser, error) {
+	if name == "" || name == "-" {
+		return ioutil.NopCloser(streams.In), nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open the payload %s", name)
+	}
+	return f, nil
+}
+
+// readPayload reads the whole payload file or the standard input if the name is empty or -
+func readPayload(streams *IO, name string) ([]byte, error) {
+	r, err := openPayload(streams, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the payload")
+	}
+	return data, nil
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hmac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func run(input string, args ...string) (int, string, string) {
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	code := Run(context.Background(), &IO{In: strings.NewReader(input), Out: out, Err: errOut}, args)
+	return code, out.String(), errOut.String()
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := `{"action":"opened"}`
+	g, err := hmac.NewGenerator("sha256", []byte("1234"))
+	require.NoError(t, err)
+	signature := g.HubSignature([]byte(body))
+
+	code, out, errOut := run(body, "sign", "--secret", "MTIzNA==", "--base64")
+	require.Equal(t, 0, code, errOut)
+	assert.Equal(t, "X-Hub-Signature-256: "+signature+"\n", out)
+
+	code, out, _ = run(body, "sign", "--secret", "1234", "--delivery", "f2467dea", "--timestamp", "1600000000")
+	require.Equal(t, 0, code)
+	assert.Contains(t, out, hmac.HeaderTimestamp+": 1600000000\n")
+	assert.Contains(t, out, hmac.HeaderSignature+": "+g.TimestampedSignature(time.Unix(1600000000, 0), "f2467dea", []byte(body)))
+
+	code, out, _ = run(body, "verify", "--secret", "1234", "--signature", signature)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, out, "valid")
+
+	code, _, errOut = run(body+" ", "verify", "--secret", "1234", "--signature", signature)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "the signature is invalid")
+
+	code, _, errOut = run(body, "sign", "--secret", "1234", "--algorithm", "md5")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "unknown HMAC algorithm")
+
+	code, _, errOut = run(body, "unknown")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, errOut, "Usage:")
+}
+
+func TestSend(t *testing.T) {
+	body := `{"ref":"refs/heads/master"}`
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		data, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, body, string(data))
+		received = req
+		_, err = rw.Write([]byte("OK"))
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+
+	code, out, errOut := run(body, "send", "--url", server.URL, "--event", "push", "--secret", "1234", "--timestamps")
+	require.Equal(t, 0, code, errOut)
+	assert.Equal(t, "200 OK\nOK\n", out)
+	require.NotNil(t, received)
+	assert.Equal(t, "push", received.Header.Get("X-GitHub-Event"))
+	assert.Len(t, received.Header.Get("X-GitHub-Delivery"), 36)
+
+	g, err := hmac.NewGenerator("sha256", []byte("1234"))
+	require.NoError(t, err)
+	assert.True(t, g.VerifySignature(received.Header.Get("X-Hub-Signature-256"), []byte(body)))
+	verifier, err := hmac.NewVerifier("sha256", []byte("1234"), 0)
+	require.NoError(t, err)
+	assert.NoError(t, verifier.VerifyRequest(received.Header, []byte(body)))
+
+	code, _, errOut = run(body, "send", "--url", server.URL, "--secret", "1234")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, errOut, "--event")
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hook"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/util"
+	"github.com/pkg/errors"
+)
+
+// errChecksFailed returned by doctor so that the exit code is non zero if any of the checks failed
+var errChecksFailed = errors.New("some checks failed")
+
+// runDoctor checks the configuration loaded from the same flags, environment variables and YAML file as the server
+// and prints a report of the checks with hints on how to fix the checks which failed
+func runDoctor(ctx context.Context, streams *IO, args []string) error {
+	cfg, err := config.Load(args)
+	if err == flag.ErrHelp {
+		return err
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to load the configuration")
+	}
+	// check GitHub and the workspaces with the same transport as the server, an invalid configuration is reported by
+	// the configuration check instead
+	if cfg.Validate() == nil {
+		util.ConfigureTransport(cfg.HTTP.TransportSettings())
+	}
+	report := hook.Doctor(ctx, cfg)
+	report.Write(streams.Out)
+	if !report.OK {
+		return errChecksFailed
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hook"
+	"github.com/pkg/errors"
+)
+
+// runRoutes prints how the webhooks of a repository are routed to the workspaces the configured tenant service
+// resolves for the installation
+func runRoutes(ctx context.Context, streams *IO, args []string) error {
+	fs := newFlagSet(streams, "routes", "<repository URL>")
+	installation := fs.Int64("installation", 0, "the ID of the installation of the App")
+	err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *installation <= 0 {
+		fs.Usage()
+		return errUsage
+	}
+	cfg, err := config.Load(nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to load the configuration")
+	}
+	handler, err := hook.NewHook(cfg)
+	if err != nil {
+		return err
+	}
+	defer handler.Close()
+
+	decisions, err := handler.Routes(ctx, *installation, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(streams.Out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(decisions)
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hmac"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hook"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/pkg/errors"
+)
+
+// sendFlags the flags of the commands which send a webhook
+type sendFlags struct {
+	secretFlags
+	url        string
+	timestamps bool
+	insecure   bool
+	timeout    time.Duration
+}
+
+func (f *sendFlags) register(fs *flag.FlagSet) {
+	f.secretFlags.register(fs)
+	fs.StringVar(&f.url, "url", "", "the Lighthouse URL the webhook is sent to")
+	fs.BoolVar(&f.timestamps, "timestamps", false, "also send the X-Lighthouse-Signature timestamped signature headers")
+	fs.BoolVar(&f.insecure, "insecure", false, "skip the verification of the TLS certificate of the URL")
+	fs.DurationVar(&f.timeout, "timeout", 30*time.Second, "the timeout of the request")
+}
+
+// runSend sends a payload file as a signed webhook with the same headers which are used when relaying a webhook
+func runSend(ctx context.Context, streams *IO, args []string) error {
+	fs := newFlagSet(streams, "send", "[payload file, default stdin]")
+	flags := &sendFlags{}
+	flags.register(fs)
+	event := fs.String("event", "", "the event type of the webhook such as push or pull_request")
+	delivery := fs.String("delivery", "", "the delivery ID of the webhook, default a random ID")
+	err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *event == "" {
+		return errors.New("the event type must be specified with --event")
+	}
+	body, err := readPayload(streams, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *delivery == "" {
+		*delivery, err = randomDelivery()
+		if err != nil {
+			return err
+		}
+	}
+	return sendWebhook(ctx, streams, flags, *event, *delivery, http.Header{}, body)
+}
+
+// runReplay fetches a delivery of the App from GitHub and sends it again with its original event type, delivery ID
+// and forwarded headers. The App is configured like the server with the environment variables and YAML file and the
+// secret defaults to the HMAC token of the App so that a delivery can be replayed through the relay.
+func runReplay(ctx context.Context, streams *IO, args []string) error {
+	fs := newFlagSet(streams, "replay", "<delivery ID or GUID>")
+	flags := &sendFlags{}
+	flags.register(fs)
+	err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	cfg, err := config.Load(nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to load the configuration")
+	}
+	if !flags.set() {
+		flags.secret = cfg.HmacToken
+	}
+
+	delivery, err := hook.FetchDelivery(ctx, cfg, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	headers := http.Header{}
+	for name, value := range delivery.Request.Headers {
+		headers.Set(name, value)
+	}
+	forwarded := http.Header{}
+	for _, name := range relay.ForwardedHeaders {
+		if value := headers.Get(name); value != "" {
+			forwarded.Set(name, value)
+		}
+	}
+	fmt.Fprintf(streams.Err, "replaying %s delivery %s of installation %d\n", delivery.Event, delivery.GUID, delivery.Installation)
+	return sendWebhook(ctx, streams, flags, delivery.Event, delivery.GUID, forwarded, delivery.Request.Payload)
+}
+
+// sendWebhook signs the webhook and sends it printing the status and body of the response
+func sendWebhook(ctx context.Context, streams *IO, flags *sendFlags, event string, delivery string, headers http.Header, body []byte) error {
+	if flags.url == "" {
+		return errors.New("the URL must be specified with --url")
+	}
+	g, err := flags.generator()
+	if err != nil {
+		return err
+	}
+	signature := g.HubSignature(body)
+	headers.Set("Content-Type", "application/json")
+	headers.Set("X-GitHub-Event", event)
+	headers.Set(hmac.HeaderDelivery, delivery)
+	headers.Set("X-Hub-Signature", signature)
+	if flags.algorithm == "sha256" {
+		headers.Set(relay.HeaderSignature256, signature)
+	}
+	if flags.timestamps {
+		g.SignRequest(headers, time.Now(), body)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, flags.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create the request for %s", flags.url)
+	}
+	req.Header = headers
+	ctx, cancel := context.WithTimeout(ctx, flags.timeout)
+	defer cancel()
+	client := &http.Client{}
+	if flags.insecure {
+		// #nosec G402
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "failed to send the webhook to %s", flags.url)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1000000))
+	if err != nil {
+		return errors.Wrap(err, "failed to read the response")
+	}
+	fmt.Fprintf(streams.Out, "%s\n", resp.Status)
+	if len(data) > 0 {
+		fmt.Fprintf(streams.Out, "%s\n", strings.TrimSpace(string(data)))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("delivery %s was rejected with %s", delivery, resp.Status)
+	}
+	return nil
+}
+
+// randomDelivery returns a random delivery ID in the same format as the GUIDs GitHub uses
+func randomDelivery() (string, error) {
+	data := make([]byte, 16)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate a delivery ID")
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", data[0:4], data[4:6], data[6:8], data[8:10], data[10:]), nil
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hmac"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/pkg/errors"
+)
+
+// errInvalidSignature returned by verify so that the exit code of an invalid signature is non zero
+var errInvalidSignature = errors.New("the signature is invalid")
+
+// runSign prints the signature headers of a payload. The payload is streamed unless a delivery ID is specified for
+// the timestamped signature which covers the delivery ID.
+func runSign(ctx context.Context, streams *IO, args []string) error {
+	fs := newFlagSet(streams, "sign", "[payload file, default stdin]")
+	secret := &secretFlags{}
+	secret.register(fs)
+	delivery := fs.String("delivery", "", "the delivery ID which also prints the X-Lighthouse-Signature timestamped signature headers")
+	timestamp := fs.Int64("timestamp", 0, "the timestamp of the timestamped signature in seconds since the epoch, default now")
+	err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	g, err := secret.generator()
+	if err != nil {
+		return err
+	}
+
+	var signature string
+	var body []byte
+	if *delivery == "" {
+		r, err := openPayload(streams, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		signature, err = g.HubSignatureReader(r)
+		if err != nil {
+			return err
+		}
+	} else {
+		body, err = readPayload(streams, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		signature = g.HubSignature(body)
+	}
+
+	fmt.Fprintf(streams.Out, "%s: %s\n", signatureHeader(secret.algorithm), signature)
+	if *delivery != "" {
+		signedAt := time.Now()
+		if *timestamp > 0 {
+			signedAt = time.Unix(*timestamp, 0)
+		}
+		fmt.Fprintf(streams.Out, "%s: %d\n", hmac.HeaderTimestamp, signedAt.Unix())
+		fmt.Fprintf(streams.Out, "%s: %s\n", hmac.HeaderSignature, g.TimestampedSignature(signedAt, *delivery, body))
+	}
+	return nil
+}
+
+// runVerify verifies the signature of a payload in the format <algorithm>=<hex> streaming the payload
+func runVerify(ctx context.Context, streams *IO, args []string) error {
+	fs := newFlagSet(streams, "verify", "[payload file, default stdin]")
+	secret := &secretFlags{}
+	secret.register(fs)
+	signature := fs.String("signature", "", "the signature such as the value of the X-Hub-Signature-256 header")
+	err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *signature == "" {
+		return errors.New("the signature must be specified with --signature")
+	}
+	algorithm, _, err := hmac.ParseSignature(*signature)
+	if err != nil {
+		return err
+	}
+	// the algorithm is the one of the signature
+	secret.algorithm = algorithm
+	g, err := secret.generator()
+	if err != nil {
+		return err
+	}
+
+	r, err := openPayload(streams, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	ok, err := g.VerifyReader(*signature, r)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidSignature
+	}
+	fmt.Fprintln(streams.Out, "the signature is valid")
+	return nil
+}
+
+// signatureHeader returns the header GitHub uses for a signature with the algorithm
+func signatureHeader(algorithm string) string {
+	if algorithm == "sha256" {
+		return relay.HeaderSignature256
+	}
+	return "X-Hub-Signature"
+}
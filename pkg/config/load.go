@@ -0,0 +1,275 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// FileEnvVar the environment variable for the location of the YAML configuration file
+	FileEnvVar = "LHA_CONFIG_FILE"
+
+	// fileFlag the command line flag for the location of the YAML configuration file
+	fileFlag = "config"
+
+	// fileSuffix the suffix of the environment variable naming a file which contains the value of a secret
+	fileSuffix = "_FILE"
+)
+
+// option a single configuration option bound to a field of the Config
+type option struct {
+	name   string
+	env    string
+	flag   string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+// Load loads the configuration from the defaults, the YAML configuration file, the environment variables
+// and the command line arguments in increasing order of precedence. Returns flag.ErrHelp if the usage was requested.
+func Load(args []string) (*Config, error) {
+	return load(args, os.LookupEnv, os.Stderr)
+}
+
+func load(args []string, lookupEnv func(string) (string, bool), out io.Writer) (*Config, error) {
+	c := Default()
+	options := c.options()
+
+	fs := flag.NewFlagSet("lighthouse-githubapp", flag.ContinueOnError)
+	fs.SetOutput(out)
+	configFile := fs.String(fileFlag, "", "the location of the YAML configuration file")
+	values := map[string]string{}
+	for _, o := range options {
+		o := o
+		fs.Var(&flagValue{option: &o, values: values}, o.flag, o.usage)
+	}
+	fs.Usage = func() {
+		writeUsage(out, options)
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	fileName := *configFile
+	if fileName == "" {
+		fileName, _ = lookupEnv(FileEnvVar)
+	}
+	if fileName != "" {
+		err = c.loadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, o := range options {
+		text, ok, err := lookupOption(o, lookupEnv)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		err = o.set(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for environment variable %s", o.env)
+		}
+	}
+
+	// the explicitly set flags take precedence over everything else
+	for _, o := range options {
+		text, ok := values[o.flag]
+		if !ok {
+			continue
+		}
+		err = o.set(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for flag --%s", o.flag)
+		}
+	}
+	return c, nil
+}
+
+// loadFile loads the YAML configuration file over the current values
+func (c *Config) loadFile(fileName string) error {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read the configuration file %s", fileName)
+	}
+	err = yaml.UnmarshalStrict(data, c)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse the configuration file %s", fileName)
+	}
+	return nil
+}
+
+// lookupOption returns the value of the option from its environment variable or, for secrets, from the file
+// named by the environment variable with the _FILE suffix
+func lookupOption(o option, lookupEnv func(string) (string, bool)) (string, bool, error) {
+	text, ok := lookupEnv(o.env)
+	if !o.secret {
+		return text, ok, nil
+	}
+	fileEnv := o.env + fileSuffix
+	fileName, fileOk := lookupEnv(fileEnv)
+	if !fileOk {
+		return text, ok, nil
+	}
+	if ok {
+		return "", false, errors.Errorf("only one of the environment variables %s and %s can be set", o.env, fileEnv)
+	}
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "failed to read the file %s from environment variable %s", fileName, fileEnv)
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+// options returns the options for every field of the configuration
+func (c *Config) options() []option {
+	return appendOptions(nil, "", reflect.ValueOf(c).Elem())
+}
+
+func appendOptions(options []option, prefix string, v reflect.Value) []option {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			options = appendOptions(options, prefix+field.Name+".", value)
+			continue
+		}
+		if field.Tag.Get("env") == "" {
+			// only configurable via the YAML file
+			continue
+		}
+		options = append(options, option{
+			name:   prefix + field.Name,
+			env:    field.Tag.Get("env"),
+			flag:   field.Tag.Get("flag"),
+			usage:  field.Tag.Get("usage"),
+			secret: field.Tag.Get("secret") == "true",
+			value:  value,
+		})
+	}
+	return options
+}
+
+// set parses the text into the value of the option
+func (o *option) set(text string) error {
+	switch o.value.Kind() {
+	case reflect.String:
+		o.value.SetString(text)
+	case reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return errors.Errorf("%q is not an integer", text)
+		}
+		o.value.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return errors.Errorf("%q is not a boolean", text)
+		}
+		o.value.SetBool(b)
+	default:
+		return errors.Errorf("unsupported type %s for option %s", o.value.Type(), o.name)
+	}
+	return nil
+}
+
+// flagValue records the value of an explicitly set flag so it can be applied after the environment variables
+type flagValue struct {
+	option *option
+	values map[string]string
+}
+
+// String returns the default value of the option
+func (f *flagValue) String() string {
+	if f == nil || f.option == nil {
+		return ""
+	}
+	return fmt.Sprint(f.option.value.Interface())
+}
+
+// Set validates and records the value
+func (f *flagValue) Set(text string) error {
+	copied := reflect.New(f.option.value.Type()).Elem()
+	o := *f.option
+	o.value = copied
+	err := o.set(text)
+	if err != nil {
+		return err
+	}
+	f.values[f.option.flag] = text
+	return nil
+}
+
+// IsBoolFlag allows boolean flags to be specified without a value
+func (f *flagValue) IsBoolFlag() bool {
+	return f.option.value.Kind() == reflect.Bool
+}
+
+// writeUsage writes the help listing every option
+func writeUsage(out io.Writer, options []option) {
+	fmt.Fprintf(out, "Usage: lighthouse-githubapp [flags]\n")
+	fmt.Fprintf(out, "       lighthouse-githubapp sign|verify|send|replay|routes|doctor [flags] to run an operator command\n\n")
+	fmt.Fprintf(out, "Options are read from the flags, the environment variables and the YAML file from --%s or %s in that order of precedence.\n", fileFlag, FileEnvVar)
+	fmt.Fprintf(out, "Secrets can also be read from the file named by the environment variable with the %s suffix.\n\n", fileSuffix)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "FLAG\tENVIRONMENT VARIABLE\tDEFAULT\tDESCRIPTION\n")
+	fmt.Fprintf(w, "--%s\t%s\t\t%s\n", fileFlag, FileEnvVar, "the location of the YAML configuration file")
+	for _, o := range options {
+		env := o.env
+		defaultValue := fmt.Sprint(o.value.Interface())
+		if o.secret {
+			env += " or " + o.env + fileSuffix
+			defaultValue = redact(o.value.String())
+		}
+		fmt.Fprintf(w, "--%s\t%s\t%s\t%s\n", o.flag, env, defaultValue, o.usage)
+	}
+	w.Flush()
+}
+
+// validator collects the validation errors of the configuration
+type validator struct {
+	messages []string
+}
+
+func (v *validator) check(valid bool, name string, message string) {
+	if !valid {
+		v.messages = append(v.messages, name+" "+message)
+	}
+}
+
+// err returns an error listing every invalid option with how it can be configured
+func (v *validator) err(c *Config) error {
+	if len(v.messages) == 0 {
+		return nil
+	}
+	sources := map[string]option{}
+	for _, o := range c.options() {
+		sources[o.name] = o
+	}
+	lines := []string{"invalid configuration:"}
+	for _, m := range v.messages {
+		name := strings.SplitN(m, " ", 2)[0]
+		o, ok := sources[name]
+		if ok {
+			m = fmt.Sprintf("%s (flag --%s or environment variable %s)", m, o.flag, o.env)
+		}
+		lines = append(lines, "  * "+m)
+	}
+	return errors.New(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,249 @@
+package debounce
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+)
+
+// FlushFunc relays the latest webhook once its coalescing window ends
+type FlushFunc func(event *relay.Event, fullName string)
+
+// Pending a webhook held until its coalescing window ends
+type Pending struct {
+	Key        string    `json:"key"`
+	Delivery   string    `json:"delivery"`
+	FullName   string    `json:"fullName"`
+	Superseded int       `json:"superseded"`
+	First      time.Time `json:"first"`
+	Due        time.Time `json:"due"`
+}
+
+// Coalescer collapses bursts of near-identical webhooks, such as repeatedly editing the description of a pull
+// request or toggling the same label, so that only the latest webhook of each repository, pull request or issue,
+// event type, action and label is relayed once its window ends. Webhooks which carry commands are never coalesced.
+type Coalescer struct {
+	windows map[string]time.Duration
+	flush   FlushFunc
+	lock    sync.Mutex
+	pending map[string]*pending
+	wg      sync.WaitGroup
+}
+
+type pending struct {
+	Pending
+	event *relay.Event
+	timer *time.Timer
+}
+
+// New creates a new coalescer whose windows are keyed by event type or event type and action such as
+// pull_request.edited, where the event type and action takes precedence
+func New(windows map[string]time.Duration, flush FlushFunc) *Coalescer {
+	return &Coalescer{
+		windows: windows,
+		flush:   flush,
+		pending: map[string]*pending{},
+	}
+}
+
+// Window returns the coalescing window of the event type and action or zero if they are not coalesced
+func (c *Coalescer) Window(eventType string, action string) time.Duration {
+	if action != "" {
+		window, ok := c.windows[eventType+"."+action]
+		if ok {
+			return window
+		}
+	}
+	return c.windows[eventType]
+}
+
+// Offer holds the webhook if it is coalesced returning true, in which case it supersedes any webhook already held
+// for the same key and is relayed when the window of the first webhook ends. Otherwise false is returned and the
+// webhook should be relayed as usual, after every webhook held for the same repository and pull request or issue
+// has been relayed so they stay in order.
+func (c *Coalescer) Offer(event *relay.Event, fullName string) bool {
+	payload := parsePayload(event.Body)
+	item := event.Source + "#" + strconv.Itoa(payload.number())
+	window := c.Window(event.Type, payload.Action)
+	if window <= 0 {
+		c.flushItem(item)
+		return false
+	}
+	parts := []string{item, event.Type, payload.Action}
+	if payload.Label != nil {
+		parts = append(parts, payload.Label.Name)
+	}
+	key := strings.Join(parts, "#")
+	if payload.hasCommands() {
+		metrics.DebounceEvents.WithLabelValues(event.Type, metrics.DebounceOutcomeCommand).Inc()
+		c.flushItem(item)
+		return false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	p := c.pending[key]
+	if p != nil {
+		p.event = event
+		p.Delivery = event.Delivery
+		p.FullName = fullName
+		p.Superseded++
+		metrics.DebounceEvents.WithLabelValues(event.Type, metrics.DebounceOutcomeSuperseded).Inc()
+		return true
+	}
+	now := time.Now()
+	p = &pending{
+		Pending: Pending{
+			Key:      key,
+			Delivery: event.Delivery,
+			FullName: fullName,
+			First:    now,
+			Due:      now.Add(window),
+		},
+		event: event,
+	}
+	c.wg.Add(1)
+	p.timer = time.AfterFunc(window, func() {
+		defer c.wg.Done()
+		c.relay(key, p)
+	})
+	c.pending[key] = p
+	metrics.DebounceEvents.WithLabelValues(event.Type, metrics.DebounceOutcomeHeld).Inc()
+	metrics.DebouncePending.Set(float64(len(c.pending)))
+	return true
+}
+
+// Flush relays every held webhook without waiting for their windows to end, such as on shutdown
+func (c *Coalescer) Flush() {
+	c.lock.Lock()
+	keys := make([]string, 0, len(c.pending))
+	for key := range c.pending {
+		keys = append(keys, key)
+	}
+	c.lock.Unlock()
+	for _, key := range keys {
+		c.flushKey(key)
+	}
+	c.wg.Wait()
+}
+
+// Snapshot returns the held webhooks sorted by when they are due
+func (c *Coalescer) Snapshot() []Pending {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	answer := make([]Pending, 0, len(c.pending))
+	for _, p := range c.pending {
+		answer = append(answer, p.Pending)
+	}
+	sort.Slice(answer, func(i, j int) bool {
+		return answer[i].Due.Before(answer[j].Due)
+	})
+	return answer
+}
+
+// flushItem relays the webhooks held for a repository and pull request or issue now in the order they were first held
+func (c *Coalescer) flushItem(item string) {
+	c.lock.Lock()
+	var held []*pending
+	for key, p := range c.pending {
+		if strings.HasPrefix(key, item+"#") {
+			held = append(held, p)
+		}
+	}
+	c.lock.Unlock()
+	sort.Slice(held, func(i, j int) bool {
+		return held[i].First.Before(held[j].First)
+	})
+	for _, p := range held {
+		c.flushKey(p.Key)
+	}
+}
+
+// flushKey relays the webhook held for the key now if there is one
+func (c *Coalescer) flushKey(key string) {
+	c.lock.Lock()
+	p := c.pending[key]
+	if p == nil || !p.timer.Stop() {
+		c.lock.Unlock()
+		return
+	}
+	c.lock.Unlock()
+	defer c.wg.Done()
+	c.relay(key, p)
+}
+
+// relay removes the held webhook and relays the latest webhook for the key
+func (c *Coalescer) relay(key string, p *pending) {
+	c.lock.Lock()
+	if c.pending[key] != p {
+		c.lock.Unlock()
+		return
+	}
+	delete(c.pending, key)
+	event := p.event
+	fullName := p.FullName
+	metrics.DebouncePending.Set(float64(len(c.pending)))
+	c.lock.Unlock()
+
+	c.flush(event, fullName)
+}
+
+// payload the fields of a webhook payload used to coalesce it
+type payload struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest *item  `json:"pull_request"`
+	Issue       *item  `json:"issue"`
+	Comment     *item  `json:"comment"`
+	Review      *item  `json:"review"`
+	Label       *label `json:"label"`
+}
+
+type label struct {
+	Name string `json:"name"`
+}
+
+type item struct {
+	Number int    `json:"number"`
+	Body   string `json:"body"`
+}
+
+func parsePayload(body []byte) *payload {
+	answer := &payload{}
+	_ = json.Unmarshal(body, answer)
+	return answer
+}
+
+// number returns the number of the pull request or issue of the webhook or zero if it has none
+func (p *payload) number() int {
+	if p.Number != 0 {
+		return p.Number
+	}
+	for _, i := range []*item{p.PullRequest, p.Issue} {
+		if i != nil && i.Number != 0 {
+			return i.Number
+		}
+	}
+	return 0
+}
+
+// hasCommands returns true if a body of the webhook has a line starting with a / such as /retest or /approve
+func (p *payload) hasCommands() bool {
+	for _, i := range []*item{p.Comment, p.Review, p.PullRequest, p.Issue} {
+		if i == nil {
+			continue
+		}
+		for _, line := range strings.Split(i.Body, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "/") {
+				return true
+			}
+		}
+	}
+	return false
+}
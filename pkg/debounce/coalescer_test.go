@@ -0,0 +1,143 @@
+package debounce
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	lock       sync.Mutex
+	deliveries []string
+}
+
+func (r *recorder) flush(event *relay.Event, fullName string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.deliveries = append(r.deliveries, event.Delivery)
+}
+
+func (r *recorder) relayed() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string{}, r.deliveries...)
+}
+
+func labeled(delivery string, number int, body string) *relay.Event {
+	return &relay.Event{
+		Type:     "pull_request",
+		Delivery: delivery,
+		Source:   "https://github.com/myorg/myrepo",
+		Body:     []byte(fmt.Sprintf(`{"action": "labeled", "number": %d, "pull_request": {"number": %d, "body": %q}}`, number, number, body)),
+	}
+}
+
+func TestCoalesceRelaysTheLatestWebhook(t *testing.T) {
+	t.Parallel()
+
+	r := &recorder{}
+	c := New(map[string]time.Duration{"pull_request.labeled": 50 * time.Millisecond}, r.flush)
+
+	assert.True(t, c.Offer(labeled("1", 1, ""), "myorg/myrepo"))
+	assert.True(t, c.Offer(labeled("2", 1, ""), "myorg/myrepo"))
+	assert.True(t, c.Offer(labeled("3", 2, ""), "myorg/myrepo"))
+	assert.True(t, c.Offer(labeled("4", 1, ""), "myorg/myrepo"))
+
+	held := c.Snapshot()
+	require.Len(t, held, 2)
+	assert.Equal(t, "4", held[0].Delivery)
+	assert.Equal(t, 2, held[0].Superseded)
+	assert.Empty(t, r.relayed(), "webhooks should be held until their window ends")
+
+	assert.Eventually(t, func() bool {
+		return len(r.relayed()) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{"3", "4"}, r.relayed())
+	assert.Empty(t, c.Snapshot())
+}
+
+func TestCommandsAreNotCoalesced(t *testing.T) {
+	t.Parallel()
+
+	r := &recorder{}
+	c := New(map[string]time.Duration{"pull_request.labeled": time.Hour}, r.flush)
+
+	assert.True(t, c.Offer(labeled("1", 1, ""), "myorg/myrepo"))
+	assert.False(t, c.Offer(labeled("2", 1, "fixes the build\n/retest"), "myorg/myrepo"))
+	assert.Equal(t, []string{"1"}, r.relayed(), "the held webhook should be relayed before the one with commands")
+	assert.Empty(t, c.Snapshot())
+}
+
+func TestDifferentLabelsAreNotCoalesced(t *testing.T) {
+	t.Parallel()
+
+	r := &recorder{}
+	c := New(map[string]time.Duration{"pull_request.labeled": time.Hour}, r.flush)
+
+	event := func(delivery string, name string) *relay.Event {
+		return &relay.Event{
+			Type:     "pull_request",
+			Delivery: delivery,
+			Source:   "https://github.com/myorg/myrepo",
+			Body:     []byte(fmt.Sprintf(`{"action": "labeled", "number": 1, "label": {"name": %q}}`, name)),
+		}
+	}
+	assert.True(t, c.Offer(event("1", "approved"), "myorg/myrepo"))
+	assert.True(t, c.Offer(event("2", "lgtm"), "myorg/myrepo"))
+	assert.True(t, c.Offer(event("3", "lgtm"), "myorg/myrepo"))
+
+	c.Flush()
+	assert.ElementsMatch(t, []string{"1", "3"}, r.relayed(), "only webhooks for the same label should be coalesced")
+}
+
+func TestHeldWebhooksAreRelayedBeforeOthersOfTheSamePullRequest(t *testing.T) {
+	t.Parallel()
+
+	r := &recorder{}
+	c := New(map[string]time.Duration{"pull_request.labeled": time.Hour}, r.flush)
+
+	assert.True(t, c.Offer(labeled("1", 1, ""), "myorg/myrepo"))
+	assert.True(t, c.Offer(labeled("2", 2, ""), "myorg/myrepo"))
+	synchronize := &relay.Event{
+		Type:     "pull_request",
+		Delivery: "3",
+		Source:   "https://github.com/myorg/myrepo",
+		Body:     []byte(`{"action": "synchronize", "number": 1}`),
+	}
+	assert.False(t, c.Offer(synchronize, "myorg/myrepo"))
+	assert.Equal(t, []string{"1"}, r.relayed(), "the held webhook of the pull request should be relayed first")
+	require.Len(t, c.Snapshot(), 1)
+	assert.Equal(t, "2", c.Snapshot()[0].Delivery)
+}
+
+func TestWindow(t *testing.T) {
+	t.Parallel()
+
+	c := New(map[string]time.Duration{
+		"pull_request":        time.Second,
+		"pull_request.edited": 5 * time.Second,
+	}, nil)
+	assert.Equal(t, 5*time.Second, c.Window("pull_request", "edited"))
+	assert.Equal(t, time.Second, c.Window("pull_request", "synchronize"))
+	assert.Zero(t, c.Window("issue_comment", "created"))
+
+	assert.False(t, c.Offer(&relay.Event{Type: "issue_comment", Body: []byte(`{"action": "created"}`)}, "myorg/myrepo"))
+}
+
+func TestFlush(t *testing.T) {
+	t.Parallel()
+
+	r := &recorder{}
+	c := New(map[string]time.Duration{"pull_request": time.Hour}, r.flush)
+	assert.True(t, c.Offer(labeled("1", 1, ""), "myorg/myrepo"))
+	assert.True(t, c.Offer(labeled("2", 2, ""), "myorg/myrepo"))
+
+	c.Flush()
+	assert.ElementsMatch(t, []string{"1", "2"}, r.relayed())
+	assert.Empty(t, c.Snapshot())
+}
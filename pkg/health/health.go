@@ -0,0 +1,149 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Check a named readiness check
+type Check interface {
+	// Name returns the name of the check
+	Name() string
+
+	// Check returns an error if the check fails
+	Check(ctx context.Context) error
+}
+
+// Result the result of running a check
+type Result struct {
+	Name     string `json:"name"`
+	Ready    bool   `json:"ready"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report the results of running all of the checks
+type Report struct {
+	Ready  bool     `json:"ready"`
+	Checks []Result `json:"checks"`
+}
+
+// Checker runs a number of checks to determine if the service is ready
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+// NewChecker creates a new checker which runs the checks concurrently with the given timeout
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{
+		checks:  checks,
+		timeout: timeout,
+	}
+}
+
+// Run runs all the checks returning the report
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i := range c.checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			check := c.checks[i]
+			start := time.Now()
+			err := check.Check(ctx)
+			result := Result{
+				Name:     check.Name(),
+				Ready:    err == nil,
+				Duration: time.Since(start).String(),
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}(i)
+	}
+	wg.Wait()
+
+	report := Report{
+		Ready:  true,
+		Checks: results,
+	}
+	for _, r := range results {
+		if !r.Ready {
+			report.Ready = false
+		}
+	}
+	return report
+}
+
+// CheckFunc adapts a function into a check
+type CheckFunc struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// NewCheckFunc creates a new named check from the function
+func NewCheckFunc(name string, fn func(ctx context.Context) error) *CheckFunc {
+	return &CheckFunc{
+		name: name,
+		fn:   fn,
+	}
+}
+
+// Name returns the name of the check
+func (c *CheckFunc) Name() string {
+	return c.name
+}
+
+// Check invokes the function
+func (c *CheckFunc) Check(ctx context.Context) error {
+	return c.fn(ctx)
+}
+
+// CachedCheck caches the result of a check which is expensive or rate limited
+type CachedCheck struct {
+	check   Check
+	ttl     time.Duration
+	lock    sync.Mutex
+	checked time.Time
+	err     error
+}
+
+// NewCachedCheck wraps the check so that its result is reused for the given duration
+func NewCachedCheck(check Check, ttl time.Duration) *CachedCheck {
+	return &CachedCheck{
+		check: check,
+		ttl:   ttl,
+	}
+}
+
+// Name returns the name of the wrapped check
+func (c *CachedCheck) Name() string {
+	return c.check.Name()
+}
+
+// Check returns the cached result or invokes the wrapped check if the cached result has expired
+func (c *CachedCheck) Check(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.checked.IsZero() && time.Since(c.checked) < c.ttl {
+		return c.err
+	}
+	c.err = c.check.Check(ctx)
+	c.checked = time.Now()
+	return c.err
+}
+
+// Purge clears the cached result so that the next check invokes the wrapped check
+func (c *CachedCheck) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.checked = time.Time{}
+	c.err = nil
+}
@@ -0,0 +1,53 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker(t *testing.T) {
+	t.Parallel()
+
+	ok := NewCheckFunc("ok", func(ctx context.Context) error {
+		return nil
+	})
+	failing := NewCheckFunc("failing", func(ctx context.Context) error {
+		return errors.New("cannot connect")
+	})
+
+	report := NewChecker(time.Second, ok).Run(context.Background())
+	assert.True(t, report.Ready)
+
+	report = NewChecker(time.Second, ok, failing).Run(context.Background())
+	assert.False(t, report.Ready)
+	require.Len(t, report.Checks, 2)
+	assert.Equal(t, "ok", report.Checks[0].Name)
+	assert.True(t, report.Checks[0].Ready)
+	assert.Equal(t, "failing", report.Checks[1].Name)
+	assert.False(t, report.Checks[1].Ready)
+	assert.Equal(t, "cannot connect", report.Checks[1].Error)
+}
+
+func TestCachedCheck(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	check := NewCachedCheck(NewCheckFunc("counting", func(ctx context.Context) error {
+		calls++
+		return nil
+	}), time.Hour)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, check.Check(context.Background()))
+	}
+	assert.Equal(t, 1, calls)
+
+	check.Purge()
+	assert.NoError(t, check.Check(context.Background()))
+	assert.Equal(t, 2, calls)
+}
@@ -4,34 +4,71 @@ import (
 	"crypto/hmac"
 	"crypto/sha1" // #nosec G505
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
-	"fmt"
 	"hash"
+	"io"
 	"strings"
 
 	"github.com/jenkins-x/jx-logging/pkg/log"
+	"github.com/pkg/errors"
 )
 
+var (
+	// ErrUnknownAlgorithm returned when a generator is created or a signature is parsed with an unsupported algorithm
+	ErrUnknownAlgorithm = errors.New("unknown HMAC algorithm")
+	// ErrMalformedSignature returned when a signature header is not in the format <algorithm>=<hex>
+	ErrMalformedSignature = errors.New("the signature must be in the format <algorithm>=<hex>")
+)
+
+// algorithms the hash functions of the supported algorithms
+var algorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// Generator signs and verifies the HMAC of request bodies with one of the sha1, sha256 or sha512 algorithms
 type Generator struct {
 	algo   string
 	secret []byte
+	hash   func() hash.Hash
 }
 
-func NewGenerator(algo string, s []byte) *Generator {
-	return &Generator{algo: algo, secret: s}
+// NewGenerator creates a new generator returning ErrUnknownAlgorithm if the algorithm is not supported
+func NewGenerator(algo string, s []byte) (*Generator, error) {
+	h, ok := algorithms[algo]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownAlgorithm, "%q", algo)
+	}
+	return &Generator{algo: algo, secret: s, hash: h}, nil
 }
 
-func (g *Generator) SignBody(body []byte) []byte {
-	var computed hash.Hash
-	switch g.algo {
-	case "sha1":
-		computed = hmac.New(sha1.New, g.secret)
-	case "sha256":
-		computed = hmac.New(sha256.New, g.secret)
-	default:
-		panic("unknown algorithm")
+// ParseSignature parses a signature header in the format <algorithm>=<hex> such as the X-Hub-Signature and
+// X-Hub-Signature-256 headers returning the algorithm and the decoded HMAC
+func ParseSignature(signature string) (string, []byte, error) {
+	parts := strings.SplitN(signature, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", nil, ErrMalformedSignature
+	}
+	algo := parts[0]
+	h, ok := algorithms[algo]
+	if !ok {
+		return "", nil, errors.Wrapf(ErrUnknownAlgorithm, "%q", algo)
 	}
+	sum, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, errors.Wrap(ErrMalformedSignature, err.Error())
+	}
+	if len(sum) != h().Size() {
+		return "", nil, errors.Wrapf(ErrMalformedSignature, "a %s signature must be %d bytes", algo, h().Size())
+	}
+	return algo, sum, nil
+}
 
+// SignBody returns the HMAC of the body
+func (g *Generator) SignBody(body []byte) []byte {
+	computed := hmac.New(g.hash, g.secret)
 	_, err := computed.Write(body)
 	if err != nil {
 		log.Logger().Errorf("unable to write to hmac: %s", err)
@@ -39,36 +76,61 @@ func (g *Generator) SignBody(body []byte) []byte {
 	return computed.Sum(nil)
 }
 
+// SignReader returns the HMAC of the body read from the reader without holding the whole body in memory
+func (g *Generator) SignReader(r io.Reader) ([]byte, error) {
+	computed := hmac.New(g.hash, g.secret)
+	_, err := io.Copy(computed, r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the body to sign")
+	}
+	return computed.Sum(nil), nil
+}
+
+// HubSignature returns the signature of the body in the format <algorithm>=<hex>
 func (g *Generator) HubSignature(body []byte) string {
-	signature := g.SignBody(body)
-	signatureString := fmt.Sprintf("%x", signature)
-	return fmt.Sprintf("%s=%s", g.algo, signatureString)
+	return g.format(g.SignBody(body))
+}
+
+// HubSignatureReader returns the signature of the body read from the reader in the format <algorithm>=<hex>
+func (g *Generator) HubSignatureReader(r io.Reader) (string, error) {
+	sum, err := g.SignReader(r)
+	if err != nil {
+		return "", err
+	}
+	return g.format(sum), nil
 }
 
+// VerifySignature returns true if the signature in the format <algorithm>=<hex> is the HMAC of the body with the
+// algorithm of the generator
 func (g *Generator) VerifySignature(signature string, body []byte) bool {
-	signaturePrefix := fmt.Sprintf("%s=", g.algo)
+	expected, ok := g.parse(signature)
+	return ok && hmac.Equal(g.SignBody(body), expected)
+}
 
-	var signatureLength int // len(SignaturePrefix) + len(hex(sha1))
-	var actual []byte
-	switch g.algo {
-	case "sha1":
-		signatureLength = 45
-		actual = make([]byte, 20)
-	case "sha256":
-		signatureLength = 71
-		actual = make([]byte, 32)
-	default:
-		panic("unknown algorithm")
+// VerifyReader returns true if the signature in the format <algorithm>=<hex> is the HMAC of the body read from the
+// reader with the algorithm of the generator
+func (g *Generator) VerifyReader(signature string, r io.Reader) (bool, error) {
+	expected, ok := g.parse(signature)
+	if !ok {
+		return false, nil
 	}
-
-	if len(signature) != signatureLength || !strings.HasPrefix(signature, signaturePrefix) {
-		return false
+	sum, err := g.SignReader(r)
+	if err != nil {
+		return false, err
 	}
+	return hmac.Equal(sum, expected), nil
+}
+
+func (g *Generator) format(sum []byte) string {
+	return g.algo + "=" + hex.EncodeToString(sum)
+}
 
-	_, err := hex.Decode(actual, []byte(signature[len(signaturePrefix):]))
+// parse returns the decoded HMAC of the signature if it is well formed and uses the algorithm of the generator
+func (g *Generator) parse(signature string) ([]byte, bool) {
+	algo, sum, err := ParseSignature(signature)
 	if err != nil {
-		log.Logger().Errorf("unable to decode: %s", err)
-		return false
+		log.Logger().Debugf("unable to parse the signature: %s", err)
+		return nil, false
 	}
-	return hmac.Equal(g.SignBody(body), actual)
+	return sum, algo == g.algo
 }
@@ -1,16 +1,21 @@
 package hmac
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGenerateHmacSignatureSha1(t *testing.T) {
 	key := "this is the key"
 	body := "this is a much longer message body"
 
-	g := NewGenerator("sha1", []byte(key))
+	g, err := NewGenerator("sha1", []byte(key))
+	require.NoError(t, err)
 
 	AssertSignature(t, g, []byte(body))
 }
@@ -19,11 +24,79 @@ func TestGenerateHmacSignatureSha256(t *testing.T) {
 	key := "this is the key"
 	body := "this is a much longer message body"
 
-	g := NewGenerator("sha256", []byte(key))
+	g, err := NewGenerator("sha256", []byte(key))
+	require.NoError(t, err)
 
 	AssertSignature(t, g, []byte(body))
 }
 
+func TestGenerateHmacSignatureSha512(t *testing.T) {
+	key := "this is the key"
+	body := "this is a much longer message body"
+
+	g, err := NewGenerator("sha512", []byte(key))
+	require.NoError(t, err)
+
+	AssertSignature(t, g, []byte(body))
+	assert.Len(t, g.HubSignature([]byte(body)), len("sha512=")+128)
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	_, err := NewGenerator("md5", []byte("this is the key"))
+	assert.Equal(t, ErrUnknownAlgorithm, errors.Cause(err))
+
+	_, err = NewVerifier("md5", []byte("this is the key"), 0)
+	assert.Equal(t, ErrUnknownAlgorithm, errors.Cause(err))
+}
+
+func TestStreamingSignature(t *testing.T) {
+	g, err := NewGenerator("sha256", []byte("this is the key"))
+	require.NoError(t, err)
+	body := bytes.Repeat([]byte("this is a much longer message body "), 100000)
+
+	signature, err := g.HubSignatureReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, g.HubSignature(body), signature)
+
+	ok, err := g.VerifyReader(signature, bytes.NewReader(body))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = g.VerifyReader(signature, bytes.NewReader(body[1:]))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestParseSignature(t *testing.T) {
+	g, err := NewGenerator("sha1", []byte("this is the key"))
+	require.NoError(t, err)
+	signature := g.HubSignature([]byte("body"))
+
+	algo, sum, err := ParseSignature(signature)
+	require.NoError(t, err)
+	assert.Equal(t, "sha1", algo)
+	assert.Equal(t, g.SignBody([]byte("body")), sum)
+
+	for _, tc := range []struct {
+		signature string
+		expected  error
+	}{
+		{signature: "", expected: ErrMalformedSignature},
+		{signature: "sha1", expected: ErrMalformedSignature},
+		{signature: "sha1=", expected: ErrMalformedSignature},
+		{signature: "sha1=not-hex", expected: ErrMalformedSignature},
+		{signature: "sha256=" + strings.TrimPrefix(signature, "sha1="), expected: ErrMalformedSignature},
+		{signature: "md5=" + strings.TrimPrefix(signature, "sha1="), expected: ErrUnknownAlgorithm},
+	} {
+		_, _, err := ParseSignature(tc.signature)
+		assert.Equal(t, tc.expected, errors.Cause(err), "signature %q", tc.signature)
+	}
+
+	sha256, err := NewGenerator("sha256", []byte("this is the key"))
+	require.NoError(t, err)
+	assert.False(t, sha256.VerifySignature(signature, []byte("body")), "the algorithm of the signature should match")
+}
+
 func AssertSignature(t *testing.T, g *Generator, body []byte) {
 	signature := g.HubSignature(body)
 	assert.NotEmpty(t, signature)
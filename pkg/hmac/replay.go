@@ -0,0 +1,88 @@
+package hmac
+
+import (
+	"container/heap"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReplayGuard rejects signed requests whose timestamp is outside of the clock skew window or which were already
+// accepted within the window. A request is identified by its delivery ID and timestamp so that the relay can retry a
+// delivery, which it signs again with a new timestamp, while a captured request cannot be replayed.
+type ReplayGuard struct {
+	skew   time.Duration
+	now    func() time.Time
+	lock   sync.Mutex
+	seen   map[string]time.Time
+	expiry expiryHeap
+}
+
+// expiring a request which is remembered until it expires
+type expiring struct {
+	key     string
+	expires time.Time
+}
+
+// expiryHeap the remembered requests ordered by when they expire so that the expired requests are forgotten without
+// checking every request
+type expiryHeap []expiring
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[i].expires.Before(h[j].expires) }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiring)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// NewReplayGuard creates a new replay guard with the clock skew window defaulting to DefaultSkew
+func NewReplayGuard(skew time.Duration) *ReplayGuard {
+	if skew <= 0 {
+		skew = DefaultSkew
+	}
+	return &ReplayGuard{
+		skew: skew,
+		now:  time.Now,
+		seen: map[string]time.Time{},
+	}
+}
+
+// ParseTimestamp parses a signature timestamp in seconds since the epoch
+func ParseTimestamp(timestamp string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(ErrSignatureInvalid, "invalid timestamp %q", timestamp)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// Check returns ErrTimestampSkew if the request was signed outside of the clock skew window or ErrReplayed if the
+// request with the delivery ID and timestamp was already accepted, otherwise it records the request. It must only be
+// called once the signature has been verified.
+func (g *ReplayGuard) Check(delivery string, signedAt time.Time) error {
+	now := g.now()
+	if signedAt.Before(now.Add(-g.skew)) || signedAt.After(now.Add(g.skew)) {
+		return errors.Wrapf(ErrTimestampSkew, "signed at %s", signedAt.UTC().Format(time.RFC3339))
+	}
+
+	key := delivery + "." + strconv.FormatInt(signedAt.Unix(), 10)
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for len(g.expiry) > 0 && now.After(g.expiry[0].expires) {
+		delete(g.seen, heap.Pop(&g.expiry).(expiring).key)
+	}
+	if _, ok := g.seen[key]; ok {
+		return errors.Wrapf(ErrReplayed, "delivery %s signed at %s", delivery, signedAt.UTC().Format(time.RFC3339))
+	}
+	// the request only needs to be remembered until its timestamp is outside of the window
+	expires := signedAt.Add(g.skew)
+	g.seen[key] = expires
+	heap.Push(&g.expiry, expiring{key: key, expires: expires})
+	return nil
+}
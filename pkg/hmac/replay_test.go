@@ -0,0 +1,32 @@
+package hmac
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayGuardForgetsExpiredRequests(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	g := NewReplayGuard(time.Minute)
+	g.now = func() time.Time {
+		return now
+	}
+
+	require.NoError(t, g.Check("delivery-1", now.Add(-30*time.Second)))
+	require.NoError(t, g.Check("delivery-2", now))
+	assert.Equal(t, ErrReplayed, errors.Cause(g.Check("delivery-1", now.Add(-30*time.Second))))
+
+	// the first request is outside of the window so it is forgotten while the second is still remembered
+	now = now.Add(45 * time.Second)
+	require.NoError(t, g.Check("delivery-3", now))
+	assert.Len(t, g.seen, 2)
+	assert.Len(t, g.expiry, 2)
+	assert.Equal(t, ErrReplayed, errors.Cause(g.Check("delivery-2", now.Add(-45*time.Second))))
+
+	err := g.Check("delivery-1", now.Add(-75*time.Second))
+	assert.Equal(t, ErrTimestampSkew, errors.Cause(err))
+}
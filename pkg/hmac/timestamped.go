@@ -0,0 +1,93 @@
+package hmac
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// HeaderSignature the header of the timestamped signature which covers the timestamp, delivery ID and body
+	HeaderSignature = "X-Lighthouse-Signature"
+	// HeaderTimestamp the header of the time the request was signed in seconds since the epoch
+	HeaderTimestamp = "X-Lighthouse-Signature-Timestamp"
+	// HeaderDelivery the header of the delivery ID covered by the timestamped signature
+	HeaderDelivery = "X-GitHub-Delivery"
+
+	// DefaultSkew the default maximum difference between the timestamp of a request and the time it is verified
+	DefaultSkew = 5 * time.Minute
+)
+
+var (
+	// ErrSignatureInvalid returned when the timestamped signature does not match the request
+	ErrSignatureInvalid = errors.New("the timestamped signature is invalid")
+	// ErrTimestampSkew returned when the timestamp of the request is outside of the clock skew window
+	ErrTimestampSkew = errors.New("the signature timestamp is outside of the clock skew window")
+	// ErrReplayed returned when a request with the same delivery ID was already verified
+	ErrReplayed = errors.New("the request has already been received")
+)
+
+// SignedContent returns the content covered by a timestamped signature
+func SignedContent(timestamp string, delivery string, body []byte) []byte {
+	content := make([]byte, 0, len(timestamp)+len(delivery)+len(body)+2)
+	content = append(content, timestamp...)
+	content = append(content, '.')
+	content = append(content, delivery...)
+	content = append(content, '.')
+	return append(content, body...)
+}
+
+// TimestampedSignature returns the signature of the timestamp, delivery ID and body in the same format as the
+// HubSignature so that a captured request cannot be replayed with a new timestamp or delivery ID
+func (g *Generator) TimestampedSignature(timestamp time.Time, delivery string, body []byte) string {
+	return g.HubSignature(SignedContent(strconv.FormatInt(timestamp.Unix(), 10), delivery, body))
+}
+
+// SignRequest sets the timestamped signature headers on the headers of a request. The delivery ID is taken from
+// the X-GitHub-Delivery header which must already be set.
+func (g *Generator) SignRequest(headers http.Header, timestamp time.Time, body []byte) {
+	headers.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	headers.Set(HeaderSignature, g.TimestampedSignature(timestamp, headers.Get(HeaderDelivery), body))
+}
+
+// Verifier verifies timestamped signatures rejecting requests whose timestamp is outside of the clock skew window or
+// which were already verified within the window
+type Verifier struct {
+	generator *Generator
+	guard     *ReplayGuard
+}
+
+// NewVerifier creates a new verifier of timestamped signatures returning ErrUnknownAlgorithm if the algorithm is not
+// supported
+func NewVerifier(algo string, secret []byte, skew time.Duration) (*Verifier, error) {
+	generator, err := NewGenerator(algo, secret)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{
+		generator: generator,
+		guard:     NewReplayGuard(skew),
+	}, nil
+}
+
+// VerifyRequest verifies the timestamped signature headers of a request
+func (v *Verifier) VerifyRequest(headers http.Header, body []byte) error {
+	return v.Verify(headers.Get(HeaderSignature), headers.Get(HeaderTimestamp), headers.Get(HeaderDelivery), body)
+}
+
+// Verify verifies the timestamped signature of the timestamp in seconds since the epoch, delivery ID and body
+func (v *Verifier) Verify(signature string, timestamp string, delivery string, body []byte) error {
+	if delivery == "" {
+		return errors.Wrap(ErrSignatureInvalid, "missing delivery ID")
+	}
+	signedAt, err := ParseTimestamp(timestamp)
+	if err != nil {
+		return err
+	}
+	if !v.generator.VerifySignature(signature, SignedContent(timestamp, delivery, body)) {
+		return ErrSignatureInvalid
+	}
+	return v.guard.Check(delivery, signedAt)
+}
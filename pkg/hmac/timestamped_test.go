@@ -0,0 +1,111 @@
+package hmac
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimestampedSignature(t *testing.T) {
+	secret := []byte("this is the key")
+	body := []byte(`{"action": "opened"}`)
+	signedAt := time.Unix(1600000000, 0)
+
+	headers := http.Header{}
+	headers.Set(HeaderDelivery, "f2467dea-70d6-11e8-8955-3c83993e0aef")
+	g, err := NewGenerator("sha256", secret)
+	require.NoError(t, err)
+	g.SignRequest(headers, signedAt, body)
+	assert.Equal(t, "1600000000", headers.Get(HeaderTimestamp))
+	assert.Contains(t, headers.Get(HeaderSignature), "sha256=")
+
+	v, err := NewVerifier("sha256", secret, time.Minute)
+	require.NoError(t, err)
+	v.guard.now = func() time.Time {
+		return signedAt.Add(30 * time.Second)
+	}
+	require.NoError(t, v.VerifyRequest(headers, body))
+
+	err = v.VerifyRequest(headers, body)
+	assert.Equal(t, ErrReplayed, errors.Cause(err), "the same delivery should not be accepted twice")
+
+	tampered := http.Header{}
+	for name, values := range headers {
+		tampered[name] = values
+	}
+	tampered.Set(HeaderDelivery, "another-delivery")
+	err = v.VerifyRequest(tampered, body)
+	assert.Equal(t, ErrSignatureInvalid, errors.Cause(err), "the delivery ID should be signed")
+
+	tampered.Set(HeaderDelivery, headers.Get(HeaderDelivery))
+	tampered.Set(HeaderTimestamp, "1600000010")
+	err = v.VerifyRequest(tampered, body)
+	assert.Equal(t, ErrSignatureInvalid, errors.Cause(err), "the timestamp should be signed")
+
+	another, err := NewVerifier("sha256", []byte("another key"), time.Minute)
+	require.NoError(t, err)
+	err = another.VerifyRequest(headers, body)
+	assert.Equal(t, ErrSignatureInvalid, errors.Cause(err))
+}
+
+func TestTimestampedSignatureSkew(t *testing.T) {
+	secret := []byte("this is the key")
+	body := []byte(`{"action": "opened"}`)
+	now := time.Unix(1600000000, 0)
+	g, err := NewGenerator("sha256", secret)
+	require.NoError(t, err)
+
+	v, err := NewVerifier("sha256", secret, time.Minute)
+	require.NoError(t, err)
+	v.guard.now = func() time.Time {
+		return now
+	}
+	for _, tc := range []struct {
+		signedAt time.Time
+		expected error
+	}{
+		{signedAt: now.Add(-2 * time.Minute), expected: ErrTimestampSkew},
+		{signedAt: now.Add(2 * time.Minute), expected: ErrTimestampSkew},
+		{signedAt: now.Add(-59 * time.Second)},
+		{signedAt: now.Add(59 * time.Second)},
+	} {
+		delivery := tc.signedAt.String()
+		signature := g.TimestampedSignature(tc.signedAt, delivery, body)
+		err := v.Verify(signature, strconv.FormatInt(tc.signedAt.Unix(), 10), delivery, body)
+		assert.Equal(t, tc.expected, errors.Cause(err), "signed at %s", tc.signedAt)
+	}
+
+	err = v.Verify(g.TimestampedSignature(now, "", body), strconv.FormatInt(now.Unix(), 10), "", body)
+	assert.Equal(t, ErrSignatureInvalid, errors.Cause(err), "the delivery ID is required")
+}
+
+func TestTimestampedSignatureRetries(t *testing.T) {
+	secret := []byte("this is the key")
+	body := []byte(`{"action": "opened"}`)
+	now := time.Unix(1600000000, 0)
+	g, err := NewGenerator("sha256", secret)
+	require.NoError(t, err)
+	v, err := NewVerifier("sha256", secret, time.Minute)
+	require.NoError(t, err)
+	v.guard.now = func() time.Time {
+		return now
+	}
+
+	first := http.Header{}
+	first.Set(HeaderDelivery, "f2467dea-70d6-11e8-8955-3c83993e0aef")
+	g.SignRequest(first, now.Add(-2*time.Second), body)
+	require.NoError(t, v.VerifyRequest(first, body))
+
+	retry := http.Header{}
+	retry.Set(HeaderDelivery, "f2467dea-70d6-11e8-8955-3c83993e0aef")
+	g.SignRequest(retry, now, body)
+	assert.NoError(t, v.VerifyRequest(retry, body), "a retry of the delivery is signed with a new timestamp")
+
+	assert.Equal(t, ErrReplayed, errors.Cause(v.VerifyRequest(first, body)))
+	assert.Equal(t, ErrReplayed, errors.Cause(v.VerifyRequest(retry, body)))
+}
@@ -0,0 +1,118 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// BotEventsDrop drops the webhooks sent by the bot of the App
+	BotEventsDrop = "drop"
+	// BotEventsMark relays the webhooks sent by the bot of the App with the HeaderBotEvent header
+	BotEventsMark = "mark"
+
+	// HeaderBotEvent the header added to relayed webhooks which were sent by the bot of the App
+	HeaderBotEvent = "X-Lighthouse-Bot-Event"
+
+	// botIdentityRetry how long the configured bot name is used before the bot of the App is looked up again after
+	// the lookup failed
+	botIdentityRetry = 5 * time.Minute
+)
+
+// botIdentity the login of the bot of the App which is resolved from GET /app once
+type botIdentity struct {
+	lock        sync.Mutex
+	login       string
+	resolved    bool
+	resolving   bool
+	nextAttempt time.Time
+}
+
+// botLogin returns the login of the bot of the App. It is resolved from the slug of the App so it is correct even
+// if the configured bot name is not, falling back to the configured bot name until GitHub can be reached. The App is
+// looked up without holding the lock so other webhooks use the configured bot name rather than wait for GitHub.
+func (o *HookOptions) botLogin(ctx context.Context) string {
+	b := o.botIdentity
+	b.lock.Lock()
+	if b.resolved || b.resolving || time.Now().Before(b.nextAttempt) {
+		defer b.lock.Unlock()
+		if b.login == "" {
+			return o.config.BotName
+		}
+		return b.login
+	}
+	b.resolving = true
+	b.lock.Unlock()
+
+	app, err := o.getApp(ctx)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.resolving = false
+	if err != nil || app.Slug == "" {
+		logrus.WithError(err).Warnf("failed to look up the bot of the GitHub App so using the configured bot name %s", o.config.BotName)
+		b.login = o.config.BotName
+		b.nextAttempt = time.Now().Add(botIdentityRetry)
+		return b.login
+	}
+	b.login = app.Slug + "[bot]"
+	b.resolved = true
+	logrus.Infof("the bot of the GitHub App is %s", b.login)
+	return b.login
+}
+
+// filterBotEvent handles a webhook sent by the bot of the App according to the configuration, returning true if the
+// webhook should be dropped. Webhooks matching a rule of BotEventsAllowed are relayed as usual.
+func (o *HookOptions) filterBotEvent(ctx context.Context, log *logrus.Entry, event *relay.Event) bool {
+	if o.config == nil || o.config.BotEvents == "" {
+		return false
+	}
+	sender := webhookSender(event.Body)
+	if sender == "" || !strings.EqualFold(sender, o.botLogin(ctx)) {
+		return false
+	}
+	if botEventAllowed(o.config.BotEventsAllowed, event.Type, webhookAction(event.Body)) {
+		metrics.BotEvents.WithLabelValues(event.Type, metrics.BotOutcomeAllowed).Inc()
+		return false
+	}
+	if o.config.BotEvents == BotEventsDrop {
+		metrics.BotEvents.WithLabelValues(event.Type, metrics.BotOutcomeDropped).Inc()
+		log.Infof("ignoring %s webhook %s sent by the bot %s", event.Type, event.Delivery, sender)
+		return true
+	}
+	metrics.BotEvents.WithLabelValues(event.Type, metrics.BotOutcomeMarked).Inc()
+	event.Bot = true
+	return false
+}
+
+// webhookSender returns the login of the sender of the webhook payload or an empty string if it has none
+func webhookSender(bodyBytes []byte) string {
+	payload := struct {
+		Sender struct {
+			Login string `json:"login"`
+		} `json:"sender"`
+	}{}
+	err := json.Unmarshal(bodyBytes, &payload)
+	if err != nil {
+		return ""
+	}
+	return payload.Sender.Login
+}
+
+// botEventAllowed returns true if one of the rules, which are either an event type such as pull_request or an event
+// type and action such as pull_request.labeled, matches the webhook
+func botEventAllowed(rules []string, eventType string, action string) bool {
+	for _, rule := range rules {
+		if rule == eventType || (action != "" && rule == eventType+"."+action) {
+			return true
+		}
+	}
+	return false
+}
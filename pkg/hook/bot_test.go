@@ -0,0 +1,140 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudbees/jx-tenant-service/pkg/access"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tenant"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBotEvents(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		botName     string
+		botEvents   string
+		allowed     []string
+		relayed     bool
+		expectedBot string
+	}{
+		{name: "relayed as usual by default", botName: "codertocat", relayed: true},
+		{name: "dropped", botName: "codertocat", botEvents: BotEventsDrop},
+		{name: "marked", botName: "codertocat", botEvents: BotEventsMark, relayed: true, expectedBot: "true"},
+		{name: "allowed", botName: "codertocat", botEvents: BotEventsDrop, allowed: []string{"push"}, relayed: true},
+		{name: "other senders", botName: "jenkins-x[bot]", botEvents: BotEventsDrop, relayed: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			relayed := false
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				relayed = true
+				assert.Equal(t, tc.expectedBot, req.Header.Get(HeaderBotEvent))
+			}))
+			defer server.Close()
+
+			cfg := config.Default()
+			cfg.BotName = tc.botName
+			cfg.BotEvents = tc.botEvents
+			cfg.BotEventsAllowed = tc.allowed
+			workspace := &access.WorkspaceAccess{Project: "cbjx-mycluster", LighthouseURL: server.URL, HMAC: "MTIzNA=="}
+			retryDuration := 5 * time.Second
+			handler := newTestHook(t, HookOptions{
+				tenantService: tenant.NewFakeTenantService(workspace),
+				secretFn: func(scm.Webhook) (string, error) {
+					return "", nil
+				},
+				maxRetryDuration: &retryDuration,
+				client:           server.Client(),
+				config:           cfg,
+			})
+
+			body, err := ioutil.ReadFile("testdata/push.json")
+			require.NoError(t, err)
+			r, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+			require.NoError(t, err)
+			r.Header.Set("X-GitHub-Event", "push")
+			r.Header.Set("X-GitHub-Delivery", "f2467dea-70d6-11e8-8955-3c83993e0aef")
+			w := NewFakeRespone(t)
+			handler.handleWebHookRequests(w, r)
+			assert.Equal(t, "OK", string(w.body))
+			assert.Equal(t, tc.relayed, relayed)
+		})
+	}
+}
+
+func TestBotLoginDoesNotWaitForGitHub(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyFile, err := ioutil.TempFile("", "app-key")
+	require.NoError(t, err)
+	defer os.Remove(keyFile.Name())
+	_, err = keyFile.Write(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	require.NoError(t, err)
+	require.NoError(t, keyFile.Close())
+
+	requested := make(chan struct{})
+	respond := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !strings.HasSuffix(req.URL.Path, "/app") {
+			http.NotFound(rw, req)
+			return
+		}
+		close(requested)
+		<-respond
+		rw.Header().Set("Content-Type", "application/json")
+		_, err := rw.Write([]byte(`{"id": 1234, "slug": "jenkins-x"}`))
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.GitHubAppID = 1234
+	cfg.AppPrivateKeyFile = keyFile.Name()
+	cfg.GitServer = server.URL
+	cfg.BotName = "codertocat"
+	o := &HookOptions{config: cfg, botIdentity: &botIdentity{}}
+
+	resolved := make(chan string)
+	go func() {
+		resolved <- o.botLogin(context.Background())
+	}()
+	<-requested
+	assert.Equal(t, "codertocat", o.botLogin(context.Background()), "the configured bot name should be used while the App is looked up")
+
+	close(respond)
+	assert.Equal(t, "jenkins-x[bot]", <-resolved)
+	assert.Equal(t, "jenkins-x[bot]", o.botLogin(context.Background()))
+}
+
+func TestBotEventAllowed(t *testing.T) {
+	t.Parallel()
+
+	rules := []string{"status", "pull_request.labeled"}
+	assert.True(t, botEventAllowed(rules, "status", ""))
+	assert.True(t, botEventAllowed(rules, "pull_request", "labeled"))
+	assert.False(t, botEventAllowed(rules, "pull_request", "opened"))
+	assert.False(t, botEventAllowed(rules, "issue_comment", "created"))
+	assert.False(t, botEventAllowed(nil, "status", ""))
+}
@@ -11,6 +11,10 @@ const (
 	HealthPath = "/health"
 	// ReadyPath URL path for the HTTP endpoint that returns ready status.
 	ReadyPath = "/ready"
+	// MetricsPath URL path for the HTTP endpoint on the admin port that exposes the Prometheus metrics.
+	MetricsPath = "/metrics"
+	// JWKSPath URL path for the HTTP endpoint that publishes the public keys which verify the relayed webhooks
+	JWKSPath = "/.well-known/jwks.json"
 
 	// GitHubAppPathWithoutRepository path query endpoint for cases where no repository is specified
 	GitHubAppPathWithoutRepository = "/installed/{owner}/"
@@ -20,4 +24,10 @@ const (
 
 	// tokenCacheExpiration how long should the tokens be cached for
 	tokenCacheExpiration = 10 * time.Minute
+
+	// readinessTimeout the maximum time to wait for the readiness checks
+	readinessTimeout = 10 * time.Second
+
+	// appCheckCacheDuration how long the result of the GitHub App readiness check is cached for
+	appCheckCacheDuration = 5 * time.Minute
 )
@@ -0,0 +1,38 @@
+package hook
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/debounce"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/sirupsen/logrus"
+)
+
+// newCoalescer creates the coalescer of the webhooks if any coalescing windows are configured
+func (o *HookOptions) newCoalescer() *debounce.Coalescer {
+	if o.config == nil || len(o.config.Debounce) == 0 {
+		return nil
+	}
+	windows := map[string]time.Duration{}
+	for event, seconds := range o.config.Debounce {
+		windows[event] = time.Duration(seconds) * time.Second
+	}
+	return debounce.New(windows, o.relayCoalesced)
+}
+
+// relayCoalesced relays the latest webhook of a burst once its coalescing window ends
+func (o *HookOptions) relayCoalesced(event *relay.Event, fullName string) {
+	log := logrus.WithFields(map[string]interface{}{
+		"InstallationID": event.Installation,
+		"FullName":       fullName,
+		"Link":           event.Source,
+		"Delivery":       event.Delivery,
+		"Function":       "relayCoalesced",
+	})
+	log.Debugf("relaying the latest %s webhook after its coalescing window", event.Type)
+	err := o.route(context.Background(), log, event, fullName)
+	if err != nil {
+		log.WithError(err).Errorf("failed to relay the coalesced webhook for '%s'", fullName)
+	}
+}
@@ -0,0 +1,116 @@
+package hook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxDeliveryPages the number of pages of recent deliveries searched for a delivery GUID
+const maxDeliveryPages = 10
+
+// Delivery a webhook delivery of the App which GitHub has stored
+type Delivery struct {
+	ID           int64           `json:"id"`
+	GUID         string          `json:"guid"`
+	Event        string          `json:"event"`
+	Action       string          `json:"action"`
+	Installation int64           `json:"installation_id"`
+	Repository   int64           `json:"repository_id"`
+	Request      DeliveryRequest `json:"request"`
+}
+
+// DeliveryRequest the request GitHub sent for a delivery
+type DeliveryRequest struct {
+	Headers map[string]string `json:"headers"`
+	Payload json.RawMessage   `json:"payload"`
+}
+
+// FetchDelivery fetches a webhook delivery of the App from GitHub by either its numeric ID or its GUID, which is
+// the X-GitHub-Delivery header. A GUID is looked up in the most recent deliveries.
+func FetchDelivery(ctx context.Context, cfg *config.Config, id string) (*Delivery, error) {
+	scmClient, _, err := createAppsScmClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		id, err = findDelivery(ctx, scmClient, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	u := scmClient.BaseURL.ResolveReference(&url.URL{Path: "app/hook/deliveries/" + id})
+	delivery := &Delivery{}
+	_, err = getAppJSON(ctx, scmClient, u.String(), delivery)
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// findDelivery returns the numeric ID of the recent delivery with the GUID
+func findDelivery(ctx context.Context, scmClient *scm.Client, guid string) (string, error) {
+	next := scmClient.BaseURL.ResolveReference(&url.URL{Path: "app/hook/deliveries", RawQuery: "per_page=100"}).String()
+	for page := 0; page < maxDeliveryPages && next != ""; page++ {
+		deliveries := []*Delivery{}
+		link, err := getAppJSON(ctx, scmClient, next, &deliveries)
+		if err != nil {
+			return "", err
+		}
+		for _, d := range deliveries {
+			if d.GUID == guid {
+				return strconv.FormatInt(d.ID, 10), nil
+			}
+		}
+		next = nextLink(link)
+	}
+	return "", errors.Errorf("no delivery %s found in the %d most recent deliveries", guid, maxDeliveryPages*100)
+}
+
+// getAppJSON invokes GET on the URL authenticated by the App JWT and parses the JSON response returning its Link header
+func getAppJSON(ctx context.Context, scmClient *scm.Client, u string, value interface{}) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create request for %s", u)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	resp, err := scmClient.Client.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to invoke GET %s", u)
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			logrus.WithError(err).Debug("failed to close the response body")
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("GET %s returned %s", u, resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(value)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse the response of GET %s", u)
+	}
+	return resp.Header.Get("Link"), nil
+}
+
+// nextLink returns the URL of the next page from a Link header
+func nextLink(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		sections := strings.Split(part, ";")
+		if len(sections) < 2 || strings.TrimSpace(sections[1]) != `rel="next"` {
+			continue
+		}
+		return strings.Trim(strings.TrimSpace(sections[0]), "<>")
+	}
+	return ""
+}
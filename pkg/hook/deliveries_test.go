@@ -0,0 +1,96 @@
+package hook
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cloudbees/jx-tenant-service/pkg/access"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchDelivery(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyFile, err := ioutil.TempFile("", "app-key")
+	require.NoError(t, err)
+	defer os.Remove(keyFile.Name())
+	_, err = keyFile.Write(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	require.NoError(t, err)
+	require.NoError(t, keyFile.Close())
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/app/hook/deliveries") && req.URL.Query().Get("cursor") == "":
+			rw.Header().Set("Link", `<`+server.URL+req.URL.Path+`?per_page=100&cursor=next>; rel="next"`)
+			_, err := rw.Write([]byte(`[{"id": 1, "guid": "another"}]`))
+			assert.NoError(t, err)
+		case strings.HasSuffix(req.URL.Path, "/app/hook/deliveries"):
+			_, err := rw.Write([]byte(`[{"id": 12345, "guid": "f2467dea-70d6-11e8-8955-3c83993e0aef"}]`))
+			assert.NoError(t, err)
+		case strings.HasSuffix(req.URL.Path, "/app/hook/deliveries/12345"):
+			_, err := rw.Write([]byte(`{"id": 12345, "guid": "f2467dea-70d6-11e8-8955-3c83993e0aef", "event": "push", "installation_id": 7486037,
+				"request": {"headers": {"X-GitHub-Hook-ID": "292430182"}, "payload": {"ref": "refs/heads/master"}}}`))
+			assert.NoError(t, err)
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.GitHubAppID = 1234
+	cfg.AppPrivateKeyFile = keyFile.Name()
+	cfg.GitServer = server.URL
+
+	for _, id := range []string{"12345", "f2467dea-70d6-11e8-8955-3c83993e0aef"} {
+		delivery, err := FetchDelivery(context.Background(), cfg, id)
+		require.NoError(t, err, id)
+		assert.Equal(t, "push", delivery.Event, id)
+		assert.Equal(t, int64(7486037), delivery.Installation, id)
+		assert.Equal(t, "292430182", delivery.Request.Headers["X-GitHub-Hook-ID"], id)
+		assert.JSONEq(t, `{"ref": "refs/heads/master"}`, string(delivery.Request.Payload), id)
+	}
+
+	_, err = FetchDelivery(context.Background(), cfg, "unknown")
+	assert.Error(t, err)
+}
+
+func TestRoutes(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.Workspaces = map[string]config.WorkspaceConfig{
+		"cbjx-mycluster": {Endpoints: []string{"https://standby.example.com/hook"}},
+	}
+	workspace := &access.WorkspaceAccess{Project: "cbjx-mycluster", Cluster: "mycluster", LighthouseURL: "https://lighthouse.example.com/hook", HMAC: "MTIzNA=="}
+	handler := newTestHook(t, HookOptions{
+		tenantService: tenant.NewFakeTenantService(workspace),
+		sinks:         newSinks(nil, http.DefaultClient, "", nil, 0),
+		config:        cfg,
+	})
+
+	decisions, err := handler.Routes(context.Background(), 7486037, "https://github.com/cbjx/example")
+	require.NoError(t, err)
+	require.Len(t, decisions, 1)
+	assert.Equal(t, "cbjx-mycluster", decisions[0].Workspace)
+	assert.Equal(t, routeModeRelay, decisions[0].Mode)
+	assert.Equal(t, "http", decisions[0].Sink)
+	assert.Equal(t, []string{"https://standby.example.com/hook"}, decisions[0].Standby)
+	assert.Empty(t, decisions[0].Headers)
+}
@@ -0,0 +1,193 @@
+package hook
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tenant"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DoctorPass the status of a doctor check which passed
+	DoctorPass = "pass"
+	// DoctorFail the status of a doctor check which failed
+	DoctorFail = "fail"
+	// DoctorSkip the status of a doctor check which was not run as a check it depends on failed
+	DoctorSkip = "skip"
+)
+
+// DoctorResult the result of a doctor check
+type DoctorResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Hint     string `json:"hint,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// DoctorReport the results of the doctor checks in the order they were run
+type DoctorReport struct {
+	OK      bool           `json:"ok"`
+	Results []DoctorResult `json:"results"`
+}
+
+// doctorCheck a check of the configuration and the services the App depends on with a hint on how to fix it
+type doctorCheck struct {
+	name     string
+	hint     string
+	requires []string
+	fn       func(ctx context.Context) error
+}
+
+// Doctor checks the configuration, the App private key and credentials and that GitHub and the tenant service are
+// reachable so that a misconfiguration is reported before the first webhook fails
+func Doctor(ctx context.Context, cfg *config.Config) *DoctorReport {
+	o := &HookOptions{
+		tenantService: tenant.NewTenantService(""),
+		config:        cfg,
+	}
+	return o.doctor(ctx)
+}
+
+func (o *HookOptions) doctor(ctx context.Context) *DoctorReport {
+	checks := []doctorCheck{
+		{
+			name: "configuration",
+			hint: "fix the settings above which can be set with the flags, environment variables or YAML file listed by --help",
+			fn: func(ctx context.Context) error {
+				return o.config.Validate()
+			},
+		},
+		{
+			name: "private-key",
+			hint: "set LHA_PRIVATE_KEY_FILE to a readable PEM encoded RSA private key generated on the settings page of the GitHub App",
+			fn:   o.checkPrivateKey,
+		},
+		{
+			name:     "app-jwt",
+			hint:     "set LHA_APP_ID to the App ID shown on the settings page of the GitHub App",
+			requires: []string{"private-key"},
+			fn:       o.checkAppJWT,
+		},
+		{
+			name:     "github-app",
+			hint:     "check LHA_APP_ID is the ID of the App the private key was generated for, the private key has not been revoked and LHA_GIT_SERVER is reachable",
+			requires: []string{"app-jwt"},
+			fn:       o.checkAppIdentity,
+		},
+		{
+			name: "tenant-service",
+			hint: "check the tenant service is running and reachable from the App",
+			fn:   o.checkTenantService,
+		},
+	}
+
+	report := &DoctorReport{OK: true, Results: []DoctorResult{}}
+	passed := map[string]bool{}
+	for _, check := range checks {
+		result := DoctorResult{Name: check.name, Status: DoctorPass}
+		for _, name := range check.requires {
+			if !passed[name] {
+				result.Status = DoctorSkip
+				result.Error = fmt.Sprintf("the %s check failed", name)
+			}
+		}
+		if result.Status != DoctorSkip {
+			checkCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+			start := time.Now()
+			err := check.fn(checkCtx)
+			cancel()
+			result.Duration = time.Since(start).String()
+			if err != nil {
+				result.Status = DoctorFail
+				result.Error = err.Error()
+				result.Hint = check.hint
+				report.OK = false
+			}
+		}
+		passed[check.name] = result.Status == DoctorPass
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// Write writes the report as a table of the checks with the hints of the checks which failed
+func (r *DoctorReport) Write(out io.Writer) {
+	for _, result := range r.Results {
+		fmt.Fprintf(out, "%-4s  %s\n", strings.ToUpper(result.Status), result.Name)
+		if result.Error != "" {
+			for _, line := range strings.Split(result.Error, "\n") {
+				fmt.Fprintf(out, "      %s\n", line)
+			}
+		}
+		if result.Hint != "" {
+			fmt.Fprintf(out, "      hint: %s\n", result.Hint)
+		}
+	}
+	if r.OK {
+		fmt.Fprintln(out, "all checks passed")
+	} else {
+		fmt.Fprintln(out, "some checks failed")
+	}
+}
+
+// checkAppJWT verifies the Apps transport of the server can mint an App JWT with the App ID and private key. The
+// request is recorded rather than sent so GitHub is only invoked by the github-app check.
+func (o *HookOptions) checkAppJWT(ctx context.Context) error {
+	if o.config.GitHubAppID <= 0 {
+		return errors.New("missing App ID environment variable LHA_APP_ID")
+	}
+	recorder := &authorizationRecorder{}
+	tr, err := newAppsTransport(recorder, o.config.GitHubAppID, o.config.AppPrivateKeyFile)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/app", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := tr.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "failed to mint the App JWT")
+	}
+	resp.Body.Close()
+	if !strings.HasPrefix(recorder.authorization, "Bearer ") {
+		return errors.New("the Apps transport did not authenticate the request with an App JWT")
+	}
+	return nil
+}
+
+// authorizationRecorder records the Authorization header of a request rather than sending it
+type authorizationRecorder struct {
+	authorization string
+}
+
+// RoundTrip records the Authorization header and returns an empty response
+func (r *authorizationRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.authorization = req.Header.Get("Authorization")
+	return &http.Response{
+		StatusCode: http.StatusNoContent,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+// checkAppIdentity verifies GitHub accepts the App JWT and that it authenticates the configured App
+func (o *HookOptions) checkAppIdentity(ctx context.Context) error {
+	app, err := o.getApp(ctx)
+	if err != nil {
+		return err
+	}
+	if app.ID != int64(o.config.GitHubAppID) {
+		return errors.Errorf("the private key belongs to the App %s with ID %d rather than the App ID %d", app.Slug, app.ID, o.config.GitHubAppID)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoctor(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyFile, err := ioutil.TempFile("", "app-key")
+	require.NoError(t, err)
+	defer os.Remove(keyFile.Name())
+	_, err = keyFile.Write(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	require.NoError(t, err)
+	require.NoError(t, keyFile.Close())
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !strings.HasSuffix(req.URL.Path, "/app") {
+			http.NotFound(rw, req)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		_, err := rw.Write([]byte(`{"id": 1234, "slug": "jenkins-x"}`))
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.GitHubAppID = 1234
+	cfg.AppPrivateKeyFile = keyFile.Name()
+	cfg.HmacToken = "1234"
+	cfg.GitServer = server.URL
+	o := &HookOptions{
+		tenantService: tenant.NewFakeTenantService(nil),
+		config:        cfg,
+	}
+
+	report := o.doctor(context.Background())
+	out := &bytes.Buffer{}
+	report.Write(out)
+	assert.True(t, report.OK, out.String())
+	require.Len(t, report.Results, 5)
+	for _, result := range report.Results {
+		assert.Equal(t, DoctorPass, result.Status, result.Name)
+	}
+
+	cfg.GitHubAppID = 4321
+	cfg.HmacToken = ""
+	report = o.doctor(context.Background())
+	assert.False(t, report.OK)
+	assert.Equal(t, DoctorFail, report.Results[0].Status)
+	assert.Contains(t, report.Results[0].Error, "HmacToken must be set")
+	assert.NotEmpty(t, report.Results[0].Hint)
+	assert.Equal(t, DoctorPass, report.Results[2].Status)
+	assert.Equal(t, DoctorFail, report.Results[3].Status)
+	assert.Contains(t, report.Results[3].Error, "rather than the App ID 4321")
+
+	cfg.AppPrivateKeyFile = keyFile.Name() + ".missing"
+	report = o.doctor(context.Background())
+	out.Reset()
+	report.Write(out)
+	assert.Equal(t, DoctorFail, report.Results[1].Status)
+	assert.Equal(t, DoctorSkip, report.Results[2].Status)
+	assert.Equal(t, DoctorSkip, report.Results[3].Status)
+	assert.Equal(t, DoctorPass, report.Results[4].Status)
+	assert.Contains(t, out.String(), "hint: set LHA_PRIVATE_KEY_FILE")
+	assert.Contains(t, out.String(), "some checks failed")
+}
@@ -0,0 +1,277 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudbees/jx-tenant-service/pkg/access"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/admin"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hmac"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/signing"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxDryRunPlans the number of the most recent dry-run routing plans which are kept
+	maxDryRunPlans = 100
+
+	// routeModeRelay the mode of a workspace whose webhooks are relayed to its Lighthouse
+	routeModeRelay = "relay"
+	// routeModePull the mode of a workspace which pulls its webhooks
+	routeModePull = "pull"
+)
+
+// RoutingPlan the workspaces a webhook is routed to and the requests which are relayed to them
+type RoutingPlan struct {
+	Time         time.Time         `json:"time"`
+	Event        string            `json:"event"`
+	Delivery     string            `json:"delivery"`
+	Installation int64             `json:"installation"`
+	Repository   string            `json:"repository"`
+	Decisions    []RoutingDecision `json:"decisions"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// RoutingDecision how a webhook is routed to a workspace
+type RoutingDecision struct {
+	Workspace string `json:"workspace"`
+	Cluster   string `json:"cluster,omitempty"`
+	Mode      string `json:"mode"`
+	URL       string `json:"url,omitempty"`
+	// Standby the endpoints the webhook fails over to if the URL is unhealthy
+	Standby  []string `json:"standby,omitempty"`
+	Sink     string   `json:"sink,omitempty"`
+	Insecure bool     `json:"insecure,omitempty"`
+	// Headers the headers of the request which is relayed without its signatures
+	Headers http.Header `json:"headers,omitempty"`
+	// BodySize the size of the body of the request which is relayed
+	BodySize int    `json:"bodySize,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// dryRunLog keeps the most recent routing plans of the webhooks which were not relayed due to dry-run mode
+type dryRunLog struct {
+	lock  sync.Mutex
+	plans []*RoutingPlan
+}
+
+func newDryRunLog() *dryRunLog {
+	return &dryRunLog{}
+}
+
+// record records the plan, dropping the oldest plan if there are too many
+func (l *dryRunLog) record(plan *RoutingPlan) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.plans = append(l.plans, plan)
+	if len(l.plans) > maxDryRunPlans {
+		l.plans = l.plans[len(l.plans)-maxDryRunPlans:]
+	}
+}
+
+// snapshot returns the recorded plans, most recent first
+func (l *dryRunLog) snapshot() []*RoutingPlan {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	answer := make([]*RoutingPlan, 0, len(l.plans))
+	for i := len(l.plans) - 1; i >= 0; i-- {
+		answer = append(answer, l.plans[i])
+	}
+	return answer
+}
+
+// isDryRun returns true if the webhooks of the installation are routed without being relayed
+func (o *HookOptions) isDryRun(installation int64) bool {
+	return o.config != nil && o.config.IsDryRun(installation)
+}
+
+// recordDryRun records the plan of a webhook which is not relayed due to dry-run mode
+func (o *HookOptions) recordDryRun(log *logrus.Entry, plan *RoutingPlan) {
+	if o.dryRuns == nil {
+		o.dryRuns = newDryRunLog()
+	}
+	o.dryRuns.record(plan)
+	for _, decision := range plan.Decisions {
+		metrics.RelayOutcomes.WithLabelValues(decision.Workspace, metrics.OutcomeDryRun).Inc()
+	}
+	log.WithField("Decisions", len(plan.Decisions)).Infof("dry-run: not relaying webhook %s for %s", plan.Delivery, plan.Repository)
+}
+
+// planRouting decides how the webhook is routed to each workspace and builds the signed requests without relaying them
+func (o *HookOptions) planRouting(ctx context.Context, workspaces []*access.WorkspaceAccess, event *relay.Event) *RoutingPlan {
+	plan := &RoutingPlan{
+		Time:         time.Now(),
+		Event:        event.Type,
+		Delivery:     event.Delivery,
+		Installation: event.Installation,
+		Repository:   event.Source,
+		Decisions:    []RoutingDecision{},
+	}
+	for _, ws := range workspaces {
+		decision := o.routingDecision(ws)
+		if decision.Error != "" {
+			plan.Decisions = append(plan.Decisions, decision)
+			continue
+		}
+
+		decodedHmac, err := base64.StdEncoding.DecodeString(ws.HMAC)
+		if err != nil {
+			decision.Error = errors.Wrap(err, "unable to decode hmac").Error()
+			plan.Decisions = append(plan.Decisions, decision)
+			continue
+		}
+		signed, err := o.signedEvent(ctx, ws.Project, event, decodedHmac)
+		if err != nil {
+			decision.Error = err.Error()
+			plan.Decisions = append(plan.Decisions, decision)
+			continue
+		}
+		decision.Headers = withoutSignatures(signed.Headers)
+		decision.BodySize = len(signed.Body)
+		plan.Decisions = append(plan.Decisions, decision)
+	}
+	return plan
+}
+
+// signatureHeaders the headers which sign a relayed webhook for a workspace
+var signatureHeaders = []string{
+	"X-Hub-Signature",
+	relay.HeaderSignature256,
+	hmac.HeaderSignature,
+	hmac.HeaderTimestamp,
+	signing.HeaderSignature,
+	signing.HeaderKeyID,
+}
+
+// withoutSignatures returns a copy of the headers without the signatures so that a plan, which can be requested for
+// any payload, cannot be used to forge webhooks the workspaces would accept
+func withoutSignatures(headers http.Header) http.Header {
+	answer := headers.Clone()
+	for _, header := range signatureHeaders {
+		answer.Del(header)
+	}
+	return answer
+}
+
+// routingDecision decides whether the webhooks of the workspace are relayed or pulled and which sink relays them
+func (o *HookOptions) routingDecision(ws *access.WorkspaceAccess) RoutingDecision {
+	decision := RoutingDecision{
+		Workspace: ws.Project,
+		Cluster:   ws.Cluster,
+		Mode:      routeModeRelay,
+		URL:       ws.LighthouseURL,
+		Insecure:  ws.Insecure,
+	}
+	if o.config != nil && o.config.Workspace(ws.Project).Pull {
+		decision.Mode = routeModePull
+		decision.URL = ""
+		decision.Insecure = false
+	} else if o.sinks != nil {
+		sink, err := o.sinks.For(ws.LighthouseURL)
+		if err != nil {
+			decision.Error = err.Error()
+			return decision
+		}
+		decision.Sink = sink.Name()
+		decision.Standby = o.workspaceEndpoints(ws)[1:]
+	}
+	return decision
+}
+
+// Routes returns how the webhooks of the repository are routed to the workspaces which the tenant service resolves
+// for the installation without signing or relaying anything
+func (o *HookOptions) Routes(ctx context.Context, installation int64, gitURL string) ([]RoutingDecision, error) {
+	log := logrus.WithFields(map[string]interface{}{
+		"Installation": installation,
+		"GitURL":       gitURL,
+	})
+	workspaces, err := o.tenantService.FindWorkspaces(ctx, log, installation, gitURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find the workspaces of %s", gitURL)
+	}
+	decisions := []RoutingDecision{}
+	for _, ws := range workspaces {
+		decisions = append(decisions, o.routingDecision(ws))
+	}
+	return decisions, nil
+}
+
+// planRoute parses the sample webhook in the body of the request and returns its routing plan. The event type is
+// taken from the X-GitHub-Event header or the event query parameter and the signature is not verified.
+func (o *HookOptions) planRoute(r *http.Request) (interface{}, error) {
+	eventType := r.Header.Get("X-GitHub-Event")
+	if eventType == "" {
+		eventType = r.URL.Query().Get("event")
+	}
+	if eventType == "" {
+		return nil, admin.InvalidRequest(errors.New("the event type must be specified with the X-GitHub-Event header or event query parameter"))
+	}
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	if delivery == "" {
+		delivery = "dry-run"
+	}
+	bodyBytes, err := ioutil.ReadAll(io.LimitReader(r.Body, 10000000))
+	if err != nil {
+		return nil, admin.InvalidRequest(errors.Wrap(err, "failed to read the sample webhook"))
+	}
+
+	scmClient, _, _, err := o.createSCMClient("")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create SCM client")
+	}
+	req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-GitHub-Event", eventType)
+	req.Header.Set("X-GitHub-Delivery", delivery)
+	webhook, err := scmClient.Webhooks.Parse(req, func(scm.Webhook) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		return nil, admin.InvalidRequest(errors.Wrap(err, "failed to parse the sample webhook"))
+	}
+	if webhook == nil {
+		return nil, admin.InvalidRequest(errors.New("no webhook could be parsed"))
+	}
+	install := webhook.GetInstallationRef()
+	if install == nil || install.ID == 0 {
+		return nil, admin.InvalidRequest(errors.New("no installation in the sample webhook"))
+	}
+	repo := webhook.Repository()
+	if repo.Link == "" {
+		return nil, admin.InvalidRequest(errors.New("no repository URL in the sample webhook"))
+	}
+
+	event := &relay.Event{
+		Type:         eventType,
+		Delivery:     delivery,
+		Source:       repo.Link,
+		Installation: install.ID,
+		Body:         bodyBytes,
+	}
+	log := logrus.WithFields(map[string]interface{}{
+		"InstallationID": install.ID,
+		"Link":           repo.Link,
+		"Function":       "planRoute",
+	})
+	workspaces, err := o.tenantService.FindWorkspaces(r.Context(), log, install.ID, repo.Link)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find the workspaces of %s", repo.Link)
+	}
+	plan := o.planRouting(r.Context(), workspaces, event)
+	if len(workspaces) == 0 {
+		plan.Error = "no workspaces interested in repository " + repo.FullName
+	}
+	return plan, nil
+}
@@ -0,0 +1,118 @@
+package hook
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudbees/jx-tenant-service/pkg/access"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/admin"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tenant"
+	"github.com/gorilla/mux"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pushSignature = "sha256=99a6c7b0894b25577f26d06d94c320bc5e234ae72e414b038436877ccef02652"
+
+func TestDryRunRecordsRoutingPlan(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Errorf("webhook relayed in dry-run mode")
+	}))
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.DryRun = true
+	cfg.Workspaces = map[string]config.WorkspaceConfig{
+		"cbjx-mycluster": {CloudEvents: "binary"},
+	}
+	workspace := &access.WorkspaceAccess{Project: "cbjx-mycluster", Cluster: "mycluster", LighthouseURL: server.URL, HMAC: "MTIzNA=="}
+	retryDuration := 5 * time.Second
+	handler := newTestHook(t, HookOptions{
+		tenantService: tenant.NewFakeTenantService(workspace),
+		secretFn: func(scm.Webhook) (string, error) {
+			return "", nil
+		},
+		maxRetryDuration: &retryDuration,
+		client:           server.Client(),
+		dryRuns:          newDryRunLog(),
+		config:           cfg,
+	})
+
+	body, err := ioutil.ReadFile("testdata/push.json")
+	require.NoError(t, err)
+	r, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+	require.NoError(t, err)
+	r.Header.Set("X-GitHub-Event", "push")
+	r.Header.Set("X-GitHub-Delivery", "f2467dea-70d6-11e8-8955-3c83993e0aef")
+	r.Header.Set("X-Hub-Signature", "sha1=e9c4409d39729236fda483f22e7fb7513e5cd273")
+	w := NewFakeRespone(t)
+	handler.handleWebHookRequests(w, r)
+	assert.Equal(t, "OK", string(w.body))
+
+	plans := handler.dryRuns.snapshot()
+	require.Len(t, plans, 1)
+	plan := plans[0]
+	assert.Equal(t, "push", plan.Event)
+	assert.Equal(t, "f2467dea-70d6-11e8-8955-3c83993e0aef", plan.Delivery)
+	require.Len(t, plan.Decisions, 1)
+	decision := plan.Decisions[0]
+	assert.Equal(t, "cbjx-mycluster", decision.Workspace)
+	assert.Equal(t, routeModeRelay, decision.Mode)
+	assert.Equal(t, server.URL, decision.URL)
+	assert.Equal(t, "http", decision.Sink)
+	assert.Empty(t, decision.Headers.Get("X-Hub-Signature"), "the plan should not contain the signatures")
+	assert.Empty(t, decision.Headers.Get("X-Hub-Signature-256"))
+	assert.Equal(t, "com.github.push", decision.Headers.Get("ce-type"))
+	assert.Equal(t, len(body), decision.BodySize)
+	assert.Empty(t, decision.Error)
+}
+
+func TestPlanRouteAdminAction(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.Workspaces = map[string]config.WorkspaceConfig{
+		"cbjx-mycluster": {Pull: true, PullTokenFile: "token"},
+	}
+	workspace := &access.WorkspaceAccess{Project: "cbjx-mycluster", Cluster: "mycluster", LighthouseURL: "http://unreachable-lighthouse-url/hook", HMAC: "MTIzNA=="}
+	handler := &HookOptions{
+		tenantService: tenant.NewFakeTenantService(workspace),
+		config:        cfg,
+	}
+	server := admin.NewServer("8081", cfg.Redacted)
+	server.RegisterAction("plan-route", handler.planRoute)
+	router := mux.NewRouter()
+	server.Handle(router)
+
+	body, err := ioutil.ReadFile("testdata/push.json")
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, "/debug/actions/plan-route?event=push", bytes.NewReader(body))
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	plan := RoutingPlan{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &plan))
+	assert.Equal(t, "push", plan.Event)
+	assert.NotZero(t, plan.Installation)
+	require.Len(t, plan.Decisions, 1)
+	assert.Equal(t, routeModePull, plan.Decisions[0].Mode)
+	assert.Equal(t, "push", plan.Decisions[0].Headers.Get("X-GitHub-Event"))
+	assert.Empty(t, plan.Decisions[0].Headers.Get("X-Hub-Signature"), "the plan should not contain the signatures")
+
+	req, err = http.NewRequest(http.MethodPost, "/debug/actions/plan-route", bytes.NewReader(body))
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
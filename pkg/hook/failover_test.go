@@ -0,0 +1,114 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudbees/jx-tenant-service/pkg/access"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tenant"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayFailsOverToStandbyEndpoint(t *testing.T) {
+	t.Parallel()
+
+	primary := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	standbyRequests := 0
+	standby := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		standbyRequests++
+		assert.Equal(t, pushSignature, req.Header.Get("X-Hub-Signature"))
+	}))
+	defer standby.Close()
+
+	cfg := config.Default()
+	cfg.Workspaces = map[string]config.WorkspaceConfig{
+		"cbjx-mycluster": {Endpoints: []string{standby.URL}},
+	}
+	workspace := &access.WorkspaceAccess{Project: "cbjx-mycluster", Cluster: "mycluster", LighthouseURL: primary.URL, HMAC: "MTIzNA=="}
+	retryDuration := 5 * time.Second
+	handler := newTestHook(t, HookOptions{
+		tenantService: tenant.NewFakeTenantService(workspace),
+		secretFn: func(scm.Webhook) (string, error) {
+			return "", nil
+		},
+		maxRetryDuration: &retryDuration,
+		client:           http.DefaultClient,
+		relays:           newRelayTracker(),
+		endpointHealth:   relay.NewEndpointHealth(relay.HealthOptions{FailureThreshold: 1}),
+		config:           cfg,
+	})
+
+	body, err := ioutil.ReadFile("testdata/push.json")
+	require.NoError(t, err)
+	r, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+	require.NoError(t, err)
+	r.Header.Set("X-GitHub-Event", "push")
+	r.Header.Set("X-GitHub-Delivery", "f2467dea-70d6-11e8-8955-3c83993e0aef")
+	r.Header.Set("X-Hub-Signature", "sha1=e9c4409d39729236fda483f22e7fb7513e5cd273")
+	w := NewFakeRespone(t)
+	handler.handleWebHookRequests(w, r)
+	assert.Equal(t, "OK", string(w.body))
+
+	assert.Equal(t, 1, standbyRequests)
+	status := handler.relays.snapshot().Workspaces["cbjx-mycluster"]
+	assert.Equal(t, relay.EndpointSecondary, status.LastEndpoint)
+	assert.Equal(t, standby.URL, status.LastURL)
+	assert.Zero(t, status.ConsecutiveFailures)
+}
+
+func TestRelayOutlivesTheGitHubRequest(t *testing.T) {
+	t.Parallel()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	workspace := &access.WorkspaceAccess{Project: "cbjx-mycluster", Cluster: "mycluster", LighthouseURL: server.URL, HMAC: "MTIzNA=="}
+	retryDuration := 5 * time.Second
+	handler := newTestHook(t, HookOptions{
+		tenantService: tenant.NewFakeTenantService(workspace),
+		secretFn: func(scm.Webhook) (string, error) {
+			return "", nil
+		},
+		maxRetryDuration: &retryDuration,
+		client:           http.DefaultClient,
+		relays:           newRelayTracker(),
+		config:           config.Default(),
+	})
+
+	body, err := ioutil.ReadFile("testdata/push.json")
+	require.NoError(t, err)
+	// GitHub has already dropped the connection so the context of the request is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+	require.NoError(t, err)
+	r = r.WithContext(ctx)
+	r.Header.Set("X-GitHub-Event", "push")
+	r.Header.Set("X-GitHub-Delivery", "f2467dea-70d6-11e8-8955-3c83993e0aef")
+	r.Header.Set("X-Hub-Signature", "sha1=e9c4409d39729236fda483f22e7fb7513e5cd273")
+	w := NewFakeRespone(t)
+	handler.handleWebHookRequests(w, r)
+	assert.Equal(t, "OK", string(w.body))
+
+	assert.Equal(t, 2, requests, "the relay should be retried after the request was cancelled")
+	status := handler.relays.snapshot().Workspaces["cbjx-mycluster"]
+	assert.Zero(t, status.ConsecutiveFailures)
+}
@@ -5,9 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
 	"github.com/gorilla/mux"
 	"github.com/jenkins-x/go-scm/scm"
 	"github.com/sirupsen/logrus"
@@ -18,7 +18,8 @@ type ghaClient interface {
 }
 
 type GithubApp struct {
-	ctx context.Context
+	ctx    context.Context
+	config *config.Config
 }
 
 type GithubAppResponse struct {
@@ -28,12 +29,13 @@ type GithubAppResponse struct {
 	AppName      string
 }
 
-func NewGithubApp() (*GithubApp, error) {
+func NewGithubApp(cfg *config.Config) (*GithubApp, error) {
 	ctx := context.Background()
 
 	logrus.Info("Initializing Github App")
 	return &GithubApp{
-		ctx,
+		ctx:    ctx,
+		config: cfg,
 	}, nil
 }
 
@@ -46,7 +48,7 @@ func (o *GithubApp) handleInstalledRequests(w http.ResponseWriter, r *http.Reque
 
 	l.Debugf("request received for owner %s and repository %s", owner, repository)
 
-	scmClient, _, err := createAppsScmClient()
+	scmClient, _, err := createAppsScmClient(o.config)
 	if err != nil {
 		logrus.Errorf("error creating Apps SCM client %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -90,25 +92,25 @@ func (o *GithubApp) handleInstalledRequests(w http.ResponseWriter, r *http.Reque
 				l.Debugf("didn't find the installation via the user account - github app not installed")
 				githubAppResponse.Installed = false
 				githubAppResponse.AccessToRepo = false
-				githubAppResponse.URL = getGitHubAppInstalltionURL()
-				githubAppResponse.AppName = getGitHubAppName()
+				githubAppResponse.URL = getGitHubAppInstalltionURL(o.config.BotName)
+				githubAppResponse.AppName = getGitHubAppName(o.config.BotName)
 			} else {
 				githubAppResponse.Installed = true
 				githubAppResponse.AccessToRepo = false
 				githubAppResponse.URL = installation.Link
-				githubAppResponse.AppName = getGitHubAppName()
+				githubAppResponse.AppName = getGitHubAppName(o.config.BotName)
 			}
 		} else {
 			githubAppResponse.Installed = true
 			githubAppResponse.AccessToRepo = false
 			githubAppResponse.URL = installation.Link
-			githubAppResponse.AppName = getGitHubAppName()
+			githubAppResponse.AppName = getGitHubAppName(o.config.BotName)
 		}
 	} else {
 		githubAppResponse.Installed = true
 		githubAppResponse.AccessToRepo = true
 		githubAppResponse.URL = installation.Link
-		githubAppResponse.AppName = getGitHubAppName()
+		githubAppResponse.AppName = getGitHubAppName(o.config.BotName)
 	}
 
 	res, err := json.Marshal(githubAppResponse)
@@ -148,25 +150,20 @@ func (o *GithubApp) findRepositoryInstallation(scmClient *scm.Client, owner stri
 	return scmClient.Apps.GetRepositoryInstallation(o.ctx, fullName)
 }
 
-func getGitHubAppInstalltionURL() string {
-	return fmt.Sprintf("https://github.com/apps/%s/installations/new", getBotName())
+func getGitHubAppInstalltionURL(configuredBotName string) string {
+	return fmt.Sprintf("https://github.com/apps/%s/installations/new", getBotName(configuredBotName))
 }
 
-func getBotName() string {
-	botEnvVar := os.Getenv("BOT_NAME")
-	if botEnvVar != "" {
-		botEnvVar = strings.ReplaceAll(botEnvVar, "[bot]", "")
+func getBotName(configuredBotName string) string {
+	botName := strings.ReplaceAll(configuredBotName, "[bot]", "")
+	if botName == "" {
+		botName = "jenkins-x"
 	}
-
-	if botEnvVar == "" {
-		botEnvVar = "jenkins-x"
-	}
-
-	return botEnvVar
+	return botName
 }
 
-func getGitHubAppName() string {
-	botName := strings.ReplaceAll(getBotName(), "-", " ")
+func getGitHubAppName(configuredBotName string) string {
+	botName := strings.ReplaceAll(getBotName(configuredBotName), "-", " ")
 
 	return strings.Title(strings.ToLower(botName))
 }
@@ -64,9 +64,9 @@ func TestHandleInstalledRequests_Routing(t *testing.T) {
 			rr := httptest.NewRecorder()
 			router := muxtrace.NewRouter()
 
-			options := HookOptions{
+			options := newTestHook(t, HookOptions{
 				githubApp: &testGhaClient{},
-			}
+			})
 
 			options.Handle(router)
 
@@ -6,7 +6,10 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tracing"
 	"github.com/cloudbees/lighthouse-githubapp/pkg/util"
 
 	"github.com/jenkins-x/go-scm/scm"
@@ -45,7 +48,15 @@ func (o *HookOptions) handleWebHookRequests(w http.ResponseWriter, r *http.Reque
 
 	r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
 
+	_, span := tracing.StartSpan(r.Context(), "verify_signature")
 	webhook, err := scmClient.Webhooks.Parse(r, o.secretFn)
+	if err == scm.ErrSignatureInvalid {
+		metrics.SignatureFailures.Inc()
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
 	if err != nil {
 		util.TraceLogger(r.Context()).Warnf("failed to parse webhook: %s", err.Error())
 		responseHTTPError(w, http.StatusInternalServerError, fmt.Sprintf("500 Internal Server Error: Failed to parse webhook: %s", err.Error()))
@@ -57,6 +68,9 @@ func (o *HookOptions) handleWebHookRequests(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	githubEventType := r.Header.Get("X-GitHub-Event")
+	metrics.WebhooksReceived.WithLabelValues(githubEventType, webhookAction(bodyBytes), strconv.FormatInt(installationID(webhook), 10)).Inc()
+
 	repository := webhook.Repository()
 	l := util.TraceLogger(r.Context()).WithFields(map[string]interface{}{
 		"FullName": repository.FullName,
@@ -106,8 +120,7 @@ func (o *HookOptions) handleWebHookRequests(w http.ResponseWriter, r *http.Reque
 	}
 
 	githubDeliveryEvent := r.Header.Get("X-GitHub-Delivery")
-	githubEventType := r.Header.Get("X-GitHub-Event")
-	err = o.onGeneralHook(r.Context(), l, installRef, webhook, githubEventType, githubDeliveryEvent, bodyBytes)
+	err = o.onGeneralHook(r.Context(), l, installRef, webhook, githubEventType, githubDeliveryEvent, bodyBytes, r.Header)
 
 	if err != nil {
 		l.WithError(err).Errorf("failed to process webhook for '%s'", repository.FullName)
@@ -2,6 +2,7 @@ package hook
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -10,8 +11,15 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/cloudbees/jx-tenant-service/pkg/access"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hmac"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/lanes"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/pull"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/signing"
 	"github.com/cloudbees/lighthouse-githubapp/pkg/tenant"
 	"github.com/jenkins-x/go-scm/scm"
 )
@@ -40,6 +48,13 @@ func TestWebhooks(t *testing.T) {
 				assert.Equal(t, req.URL.String(), "/")
 
 				assert.Equal(t, req.Header.Get("X-Hub-Signature"), "sha256=99a6c7b0894b25577f26d06d94c320bc5e234ae72e414b038436877ccef02652")
+				assert.Equal(t, req.Header.Get("X-Hub-Signature-256"), "sha256=99a6c7b0894b25577f26d06d94c320bc5e234ae72e414b038436877ccef02652")
+				assert.Equal(t, "GitHub-Hookshot/044aadd", req.Header.Get("User-Agent"))
+				assert.Equal(t, "292430182", req.Header.Get("X-GitHub-Hook-ID"))
+				assert.Equal(t, "integration", req.Header.Get("X-GitHub-Hook-Installation-Target-Type"))
+				assert.Equal(t, "1", req.Header.Get("X-Lighthouse-Relay-Hop"))
+				assert.Equal(t, "7486037", req.Header.Get("X-Lighthouse-Relay-Installation"))
+				assert.NotEmpty(t, req.Header.Get("X-Lighthouse-Relay-Received-At"))
 				// Send response to be tested
 				_, err := rw.Write([]byte(`OK`))
 				assert.NoError(t, err)
@@ -73,6 +88,34 @@ func TestWebhooks(t *testing.T) {
 				assert.NoError(t, err)
 			},
 		},
+		// error which should not be retried
+		{
+			name:             "error contract not retryable",
+			event:            "push",
+			before:           "testdata/push.json",
+			multipleAttempts: false,
+			workspace:        &access.WorkspaceAccess{Project: "cbjx-mycluster", Cluster: "mycluster", LighthouseURL: "http://dummy-lighthouse-url/hook", HMAC: "MTIzNA==", Insecure: insecure},
+			handlerFunc: func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("Content-Type", "application/json")
+				rw.WriteHeader(400)
+				_, err := rw.Write([]byte(`{"version": 1, "code": "unsupported_event", "retryable": false}`))
+				assert.NoError(t, err)
+			},
+		},
+		// error which should be retried
+		{
+			name:             "error contract retryable",
+			event:            "push",
+			before:           "testdata/push.json",
+			multipleAttempts: true,
+			workspace:        &access.WorkspaceAccess{Project: "cbjx-mycluster", Cluster: "mycluster", LighthouseURL: "http://dummy-lighthouse-url/hook", HMAC: "MTIzNA==", Insecure: insecure},
+			handlerFunc: func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("Content-Type", "application/json")
+				rw.WriteHeader(503)
+				_, err := rw.Write([]byte(`{"version": 1, "code": "starting", "retryable": true, "retryAfter": 1}`))
+				assert.NoError(t, err)
+			},
+		},
 		// any other error
 		{
 			name:             "any other error",
@@ -108,15 +151,19 @@ func TestWebhooks(t *testing.T) {
 			r.Header.Set("X-GitHub-Event", test.event)
 			r.Header.Set("X-GitHub-Delivery", "f2467dea-70d6-11e8-8955-3c83993e0aef")
 			r.Header.Set("X-Hub-Signature", "sha1=e9c4409d39729236fda483f22e7fb7513e5cd273")
+			r.Header.Set("User-Agent", "GitHub-Hookshot/044aadd")
+			r.Header.Set("X-GitHub-Hook-ID", "292430182")
+			r.Header.Set("X-GitHub-Hook-Installation-Target-Type", "integration")
 
 			retryDuration := 5 * time.Second
-			handler := HookOptions{
+			handler := newTestHook(t, HookOptions{
 				tenantService: tenant.NewFakeTenantService(test.workspace),
 				secretFn: func(scm.Webhook) (string, error) {
 					return "", nil
 				},
 				maxRetryDuration: &retryDuration,
-			}
+				config:           config.Default(),
+			})
 
 			attempts := 0
 			if test.workspace != nil {
@@ -150,6 +197,37 @@ type FakeResponse struct {
 	status  int
 }
 
+// newTestHook returns the handler of the options with the state which NewHook creates for the handler filled in
+func newTestHook(t *testing.T, o HookOptions) *HookOptions {
+	if o.maxRetryDuration == nil {
+		o.maxRetryDuration = &defaultMaxRetryDuration
+	}
+	if o.relays == nil {
+		o.relays = newRelayTracker()
+	}
+	if o.relayClients == nil {
+		relayClients, err := relay.NewClientFactory(relay.Options{})
+		require.NoError(t, err)
+		o.relayClients = relayClients
+	}
+	if o.pull == nil {
+		o.pull = pull.NewBroker(pull.Options{})
+	}
+	if o.sinks == nil {
+		o.sinks = newSinks(o.relayClients, o.client, "", nil, 0)
+	}
+	if o.endpointHealth == nil {
+		o.endpointHealth = relay.NewEndpointHealth(relay.HealthOptions{})
+	}
+	if o.lanes == nil {
+		o.lanes = lanes.New(lanes.Options{})
+	}
+	if o.botIdentity == nil {
+		o.botIdentity = &botIdentity{}
+	}
+	return &o
+}
+
 func NewFakeRespone(t *testing.T) *FakeResponse {
 	return &FakeResponse{
 		t:       t,
@@ -169,3 +247,90 @@ func (r *FakeResponse) Write(body []byte) (int, error) {
 func (r *FakeResponse) WriteHeader(status int) {
 	r.status = status
 }
+
+func TestSignedEventWithTimestamps(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.Workspaces = map[string]config.WorkspaceConfig{"cbjx-mycluster": {SignTimestamps: true}}
+	handler := HookOptions{config: cfg}
+	webhook := &relay.Event{Type: "push", Delivery: "f2467dea-70d6-11e8-8955-3c83993e0aef", Body: []byte(`{}`)}
+	secret := []byte("1234")
+
+	signed, err := handler.signedEvent(context.Background(), "cbjx-mycluster", webhook, secret)
+	require.NoError(t, err)
+	assert.NotEmpty(t, signed.Headers.Get(hmac.HeaderSignature))
+	verifier, err := hmac.NewVerifier("sha256", secret, 0)
+	require.NoError(t, err)
+	assert.NoError(t, verifier.VerifyRequest(signed.Headers, signed.Body))
+
+	signed, err = handler.signedEvent(context.Background(), "another", webhook, secret)
+	require.NoError(t, err)
+	assert.Empty(t, signed.Headers.Get(hmac.HeaderSignature), "only the configured workspaces should be sent timestamped signatures")
+}
+
+func TestSignedEventWithSigningKeys(t *testing.T) {
+	t.Parallel()
+
+	keys, err := signing.NewKeySet(signing.Options{Algorithm: signing.AlgorithmEd25519})
+	require.NoError(t, err)
+	handler := HookOptions{config: config.Default(), signingKeys: keys}
+	webhook := &relay.Event{Type: "push", Delivery: "f2467dea-70d6-11e8-8955-3c83993e0aef", Body: []byte(`{}`)}
+
+	signed, err := handler.signedEvent(context.Background(), "cbjx-mycluster", webhook, []byte("1234"))
+	require.NoError(t, err)
+	verifier, err := signing.NewVerifier(keys.JWKS(), 0)
+	require.NoError(t, err)
+	assert.NoError(t, verifier.VerifyRequest(signed.Headers, signed.Body))
+}
+
+func TestSignedCloudEvents(t *testing.T) {
+	t.Parallel()
+
+	keys, err := signing.NewKeySet(signing.Options{Algorithm: signing.AlgorithmES256})
+	require.NoError(t, err)
+	secret := []byte("1234")
+	g, err := hmac.NewGenerator("sha256", secret)
+	require.NoError(t, err)
+	webhook := &relay.Event{Type: "push", Delivery: "f2467dea-70d6-11e8-8955-3c83993e0aef", Source: "https://github.com/cbjx/example", Body: []byte(`{"ref": "refs/heads/master"}`)}
+
+	for _, mode := range []string{relay.CloudEventsBinary, relay.CloudEventsStructured} {
+		cfg := config.Default()
+		cfg.Workspaces = map[string]config.WorkspaceConfig{"cbjx-mycluster": {CloudEvents: mode, SignTimestamps: true}}
+		handler := HookOptions{config: cfg, signingKeys: keys}
+
+		signed, err := handler.signedEvent(context.Background(), "cbjx-mycluster", webhook, secret)
+		require.NoError(t, err, mode)
+
+		// the request as the workspace receives it
+		var received *http.Request
+		var body []byte
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			data, err := ioutil.ReadAll(req.Body)
+			assert.NoError(t, err)
+			received = req
+			body = data
+		}))
+		req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(signed.Body))
+		require.NoError(t, err, mode)
+		req.Header = signed.Headers
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err, mode)
+		resp.Body.Close()
+		server.Close()
+
+		require.NotNil(t, received, mode)
+		if mode == relay.CloudEventsBinary {
+			assert.Equal(t, "com.github.push", received.Header.Get("ce-type"))
+		} else {
+			assert.Contains(t, received.Header.Get("Content-Type"), "application/cloudevents+json")
+		}
+		assert.True(t, g.VerifySignature(received.Header.Get("X-Hub-Signature-256"), body), mode)
+		hmacVerifier, err := hmac.NewVerifier("sha256", secret, 0)
+		require.NoError(t, err, mode)
+		assert.NoError(t, hmacVerifier.VerifyRequest(received.Header, body), mode)
+		keysVerifier, err := signing.NewVerifier(keys.JWKS(), 0)
+		require.NoError(t, err, mode)
+		assert.NoError(t, keysVerifier.VerifyRequest(received.Header, body), mode)
+	}
+}
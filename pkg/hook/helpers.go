@@ -1,11 +1,13 @@
 package hook
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 
+	"github.com/jenkins-x/go-scm/scm"
 	"github.com/sirupsen/logrus"
 )
 
@@ -30,3 +32,30 @@ func responseHTTPError(w http.ResponseWriter, statusCode int, message string, ar
 func ParseInt64(text string) (int64, error) {
 	return strconv.ParseInt(text, 10, 64)
 }
+
+// webhookAction returns the action of the webhook payload or an empty string if it has none
+func webhookAction(bodyBytes []byte) string {
+	payload := struct {
+		Action string `json:"action"`
+	}{}
+	err := json.Unmarshal(bodyBytes, &payload)
+	if err != nil {
+		return ""
+	}
+	return payload.Action
+}
+
+// installationID returns the ID of the installation the webhook was sent for or 0 if there is none
+func installationID(webhook scm.Webhook) int64 {
+	switch hook := webhook.(type) {
+	case *scm.InstallationHook:
+		return hook.Installation.ID
+	case *scm.InstallationRepositoryHook:
+		return hook.Installation.ID
+	}
+	installRef := webhook.GetInstallationRef()
+	if installRef == nil {
+		return 0
+	}
+	return installRef.ID
+}
@@ -1,27 +1,35 @@
 package hook
 
 import (
-	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/base64"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/cloudbees/lighthouse-githubapp/pkg/admin"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/health"
 	"github.com/cloudbees/lighthouse-githubapp/pkg/version"
 
 	"github.com/cenkalti/backoff"
 	"github.com/cloudbees/jx-tenant-service/pkg/access"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/debounce"
 	"github.com/cloudbees/lighthouse-githubapp/pkg/hmac"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/lanes"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/mirror"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/pending"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/pull"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/ratelimit"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/signing"
 	"github.com/cloudbees/lighthouse-githubapp/pkg/tenant"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tracing"
 
 	"github.com/cloudbees/lighthouse-githubapp/pkg/util"
 
-	"github.com/cloudbees/lighthouse-githubapp/pkg/flags"
 	"github.com/jenkins-x/go-scm/scm"
 	"github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
@@ -30,8 +38,8 @@ import (
 )
 
 const (
-	repoNotConfiguredMessage       = "repository not configured"
-	noGithubAppSecretFoundForOwner = "no github app secret found for owner" // #nosec G101
+	repoNotConfiguredMessage       = relay.RepoNotConfiguredMessage
+	noGithubAppSecretFoundForOwner = relay.NoGitHubAppSecretFoundMessage
 )
 
 var (
@@ -47,32 +55,152 @@ type HookOptions struct {
 	githubApp        ghaClient
 	secretFn         func(webhook scm.Webhook) (string, error)
 	client           *http.Client
+	relayClients     *relay.ClientFactory
+	pull             *pull.Broker
+	pending          *pending.Store
+	sinks            *relay.Sinks
+	endpointHealth   *relay.EndpointHealth
+	mirror           *mirror.Mirror
+	lanes            *lanes.Lanes
+	limiter          *ratelimit.Limiter
 	maxRetryDuration *time.Duration
+	relays           *relayTracker
+	dryRuns          *dryRunLog
+	botIdentity      *botIdentity
+	coalescer        *debounce.Coalescer
+	signingKeys      *signing.KeySet
+	readiness        *health.Checker
+	appCheck         *health.CachedCheck
+	config           *config.Config
 }
 
 // NewHook create a new hook handler
-func NewHook() (*HookOptions, error) {
+func NewHook(cfg *config.Config) (*HookOptions, error) {
 	tokenCache := cache.New(tokenCacheExpiration, tokenCacheExpiration)
 	tenantService := tenant.NewTenantService("")
-	githubApp, err := NewGithubApp()
+	githubApp, err := NewGithubApp(cfg)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to create hook")
 	}
 
+	transport := cfg.HTTP.TransportSettings()
+	relayClients, err := relay.NewClientFactory(relay.Options{
+		Transport: &transport,
+		Timeout:   cfg.RelayTimeoutDuration(),
+		ProxyURL:  cfg.RelayProxy,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the relay clients")
+	}
+
+	sinks := newSinks(relayClients, nil, cfg.RelayFileDir, cfg.RelayNATSServers, cfg.RelayTimeoutDuration())
+	buildVersion := *version.GetBuildVersion()
+	mirrors, err := newMirror(cfg, sinks, buildVersion)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the mirrors")
+	}
+
+	signingKeys, err := newSigningKeys(cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the signing keys")
+	}
+
 	secretFn := func(webhook scm.Webhook) (string, error) {
-		return flags.HmacToken.Value(), nil
+		return cfg.HmacToken, nil
 	}
 
-	return &HookOptions{
+	o := &HookOptions{
 		Path:             HookPath,
-		Port:             flags.HttpPort.Value(),
-		Version:          *version.GetBuildVersion(),
+		Port:             cfg.HTTPPort,
+		Version:          buildVersion,
 		tokenCache:       tokenCache,
 		tenantService:    tenantService,
 		githubApp:        githubApp,
 		secretFn:         secretFn,
 		maxRetryDuration: &defaultMaxRetryDuration,
-	}, nil
+		relays:           newRelayTracker(),
+		dryRuns:          newDryRunLog(),
+		botIdentity:      &botIdentity{},
+		relayClients:     relayClients,
+		sinks:            sinks,
+		endpointHealth: relay.NewEndpointHealth(relay.HealthOptions{
+			FailureThreshold: cfg.RelayFailureThreshold,
+			RecoveryInterval: time.Duration(cfg.RelayRecoveryInterval) * time.Second,
+		}),
+		mirror: mirrors,
+		lanes: lanes.New(lanes.Options{
+			HighWorkers:        cfg.LaneHighWorkers,
+			LowWorkers:         cfg.LaneLowWorkers,
+			HighPriorityEvents: cfg.HighPriorityEvents,
+		}),
+		limiter:     newLimiter(cfg),
+		signingKeys: signingKeys,
+		pull: pull.NewBroker(pull.Options{
+			AckTimeout: time.Duration(cfg.PullAckTimeout) * time.Second,
+			TTL:        time.Duration(cfg.PullEventTTL) * time.Second,
+			MaxQueued:  cfg.PullMaxQueued,
+		}),
+		pending: pending.NewStore(pending.Options{
+			TTL:              time.Duration(cfg.PendingEventTTL) * time.Second,
+			MaxPerRepository: cfg.PendingMaxEvents,
+			MaxEvents:        cfg.PendingMaxTotal,
+			RecheckLimit:     cfg.PendingRecheckLimit,
+		}),
+		config: cfg,
+	}
+	o.coalescer = o.newCoalescer()
+	o.readiness = o.newReadinessChecker()
+	return o, nil
+}
+
+// RegisterAdmin registers the caches and relay state with the admin server
+func (o *HookOptions) RegisterAdmin(server *admin.Server) {
+	server.RegisterCache("tokens", o.tokenCache.Flush)
+	server.RegisterCache("readiness", o.appCheck.Purge)
+	server.RegisterCache("relay-clients", o.relayClients.Purge)
+	server.RegisterInspector("pending", func() interface{} {
+		return o.pending.Repositories()
+	})
+	server.RegisterAction("recheck-pending", func(r *http.Request) (interface{}, error) {
+		return o.RecheckPending(r.Context())
+	})
+	server.RegisterInspector("dry-run", func() interface{} {
+		return o.dryRuns.snapshot()
+	})
+	server.RegisterAction("plan-route", o.planRoute)
+	server.RegisterInspector("relay-endpoints", func() interface{} {
+		return o.endpointHealth.Snapshot()
+	})
+	server.RegisterInspector("debounce", func() interface{} {
+		if o.coalescer == nil {
+			return []debounce.Pending{}
+		}
+		return o.coalescer.Snapshot()
+	})
+	server.RegisterInspector("lanes", func() interface{} {
+		return o.lanes.Snapshot()
+	})
+	server.RegisterInspector("installations", func() interface{} {
+		return o.limiter.Snapshot()
+	})
+	server.RegisterInspector("mirrors", func() interface{} {
+		return o.mirror.Snapshot()
+	})
+	server.RegisterInspector("pull", func() interface{} {
+		return o.pull.Snapshot()
+	})
+	server.RegisterInspector("signing-keys", func() interface{} {
+		if o.signingKeys == nil {
+			return &signing.JWKS{Keys: []signing.JWK{}}
+		}
+		return o.signingKeys.JWKS()
+	})
+	server.RegisterInspector("relay-certificates", func() interface{} {
+		return o.relayClients.Certificates()
+	})
+	server.RegisterInspector("relay", func() interface{} {
+		return o.relays.snapshot()
+	})
 }
 
 func (o *HookOptions) Handle(mux *muxtrace.Router) {
@@ -81,6 +209,12 @@ func (o *HookOptions) Handle(mux *muxtrace.Router) {
 	mux.Handle(HealthPath, http.HandlerFunc(o.health))
 	mux.Handle(ReadyPath, http.HandlerFunc(o.ready))
 	mux.Handle(SetupPath, http.HandlerFunc(o.setup))
+	if o.pull != nil {
+		pull.NewHandler(o.pull, o.authenticatePull).Handle(mux.Router)
+	}
+	if o.signingKeys != nil {
+		mux.Handle(JWKSPath, o.signingKeys)
+	}
 
 	mux.Handle("/", http.HandlerFunc(o.defaultHandler))
 	mux.Handle(o.Path, http.HandlerFunc(o.handleWebHookRequests))
@@ -92,16 +226,6 @@ func (o *HookOptions) health(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// ready returns either HTTP 204 if the service is ready to serve requests, otherwise HTTP 503.
-func (o *HookOptions) ready(w http.ResponseWriter, r *http.Request) {
-	util.TraceLogger(r.Context()).Debug("Ready check")
-	if o.isReady() {
-		w.WriteHeader(http.StatusNoContent)
-	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-	}
-}
-
 // setup handle the setup URL
 func (o *HookOptions) setup(w http.ResponseWriter, r *http.Request) {
 	util.TraceLogger(r.Context()).Debug("setup")
@@ -142,11 +266,6 @@ func (o *HookOptions) getIndex(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (o *HookOptions) isReady() bool {
-	// TODO a better readiness check
-	return true
-}
-
 func (o *HookOptions) onInstallHook(ctx context.Context, log *logrus.Entry, hook *scm.InstallationHook) error {
 	install := hook.Installation
 	id := install.ID
@@ -190,12 +309,8 @@ func (o *HookOptions) onInstallRepositoryHook(ctx context.Context, log *logrus.E
 	return nil
 }
 
-func (o *HookOptions) onGeneralHook(ctx context.Context, log *logrus.Entry, install *scm.InstallationRef, webhook scm.Webhook, githubEventType string, githubDeliveryEvent string, bodyBytes []byte) error {
-	// Set a default max retry duration of 30 seconds if it's not set.
-	if o.maxRetryDuration == nil {
-		o.maxRetryDuration = &defaultMaxRetryDuration
-	}
-
+func (o *HookOptions) onGeneralHook(ctx context.Context, log *logrus.Entry, install *scm.InstallationRef, webhook scm.Webhook, githubEventType string, githubDeliveryEvent string, bodyBytes []byte, headers http.Header) error {
+	receivedAt := time.Now()
 	id := install.ID
 	repo := webhook.Repository()
 
@@ -217,34 +332,126 @@ func (o *HookOptions) onGeneralHook(ctx context.Context, log *logrus.Entry, inst
 	}
 
 	log.Debugf("onGeneralHook - %+v", webhook)
+	event := &relay.Event{
+		Type:         githubEventType,
+		Delivery:     githubDeliveryEvent,
+		Source:       u,
+		Installation: id,
+		Body:         bodyBytes,
+	}
+	event.Received(headers, receivedAt)
+	if o.limiter != nil {
+		// the webhooks of a noisy installation are queued here so it slows down without delaying the webhooks of
+		// other installations or holding the request until GitHub gives up on it
+		return o.limiter.Ingest(ctx, id, func(ctx context.Context) error {
+			return o.ingest(ctx, log, event, repo.FullName)
+		})
+	}
+	return o.ingest(ctx, log, event, repo.FullName)
+}
+
+// ingest relays the webhook unless it is dropped as it was sent by the bot or held to coalesce it with later webhooks
+func (o *HookOptions) ingest(ctx context.Context, log *logrus.Entry, event *relay.Event, fullName string) error {
+	if o.filterBotEvent(ctx, log, event) {
+		return nil
+	}
+	dryRun := o.isDryRun(event.Installation)
+	if o.mirror != nil && !dryRun {
+		// mirrored deliveries are sent in the background so they do not affect the delivery to the workspaces
+		o.mirror.Mirror(event, fullName)
+	}
+
+	if o.coalescer != nil && o.coalescer.Offer(event, fullName) {
+		log.Debugf("holding %s webhook %s to coalesce it with any later webhooks", event.Type, event.Delivery)
+		return nil
+	}
+	return o.route(ctx, log, event, fullName)
+}
+
+// route finds the workspaces interested in the repository of the event and relays the event to them
+func (o *HookOptions) route(ctx context.Context, log *logrus.Entry, event *relay.Event, fullName string) error {
+	id := event.Installation
+	u := event.Source
+	dryRun := o.isDryRun(id)
+
 	var workspaces []*access.WorkspaceAccess
+	noWorkspaces := false
 
 	getWsFunc := func() error {
+		noWorkspaces = false
+		ctx, span := tracing.StartSpan(ctx, "find_workspaces")
+		defer span.End()
+		span.SetAttribute("installation", id)
+		span.SetAttribute("repository", fullName)
+
+		start := time.Now()
 		ws, err := o.tenantService.FindWorkspaces(ctx, log, id, u)
+		metrics.FindWorkspacesDuration.Observe(time.Since(start).Seconds())
 		if err != nil {
-			log.WithError(err).Errorf("Unable to find workspaces for %s", repo.FullName)
+			span.RecordError(err)
+			metrics.FindWorkspacesErrors.Inc()
+			log.WithError(err).Errorf("Unable to find workspaces for %s", fullName)
 			return err
 		}
-		log.Infof("%d workspaces interested in repository %s", len(ws), repo.FullName)
+		log.Infof("%d workspaces interested in repository %s", len(ws), fullName)
 
 		if len(ws) == 0 {
-			return errors.Errorf("no workspaces interested in repository '%s', backing off...", repo.FullName)
+			noWorkspaces = true
+			return errors.Errorf("no workspaces interested in repository '%s', backing off...", fullName)
 		}
 		workspaces = append(workspaces, ws...)
 		return nil
 	}
 
 	err := o.retryGetWorkspaces(getWsFunc, func(e error, d time.Duration) {
+		metrics.BackoffRetries.WithLabelValues(metrics.OperationFindWorkspaces).Inc()
 		log.Infof("get workspaces failed with '%s', backing off for %s", e, d)
 	})
 	if err != nil {
-		log.WithError(err).Errorf("failed to find any workspaces after %s seconds for '%s'", o.maxRetryDuration, repo.FullName)
+		if noWorkspaces && dryRun {
+			plan := o.planRouting(ctx, nil, event)
+			plan.Error = err.Error()
+			o.recordDryRun(log, plan)
+			return nil
+		}
+		if noWorkspaces && o.pending != nil {
+			// the tenant service may not know about a newly imported repository yet so keep the event until it does
+			return o.park(log, event, fullName)
+		}
+		log.WithError(err).Errorf("failed to find any workspaces after %s seconds for '%s'", o.maxRetryDuration, fullName)
 		return err
 	}
 
+	if dryRun {
+		o.recordDryRun(log, o.planRouting(ctx, workspaces, event))
+		return nil
+	}
+	if o.pending != nil {
+		// relay any events parked before the repository was routable first so the workspaces see them in order
+		o.relayParked(ctx, log, u, workspaces)
+	}
+	err = o.relayToWorkspaces(ctx, log, workspaces, event, fullName)
+	if err != nil {
+		log.WithError(err).Warnf("the webhook for '%s' was not relayed to every workspace", fullName)
+	}
+	return nil
+}
+
+// relayToWorkspaces relays the event to each workspace or queues it for the workspaces which pull their events. The
+// relays wait until the installation is within its limits and for a worker in the priority lane of the event so
+// neither a noisy installation nor bulk events can delay the others. An error is returned if the event could not be
+// relayed to or queued for any of the workspaces, each failure is logged.
+func (o *HookOptions) relayToWorkspaces(ctx context.Context, log *logrus.Entry, workspaces []*access.WorkspaceAccess, event *relay.Event, fullName string) error {
+	failed := 0
+	var release func()
+	defer func() {
+		if release != nil {
+			release()
+		}
+	}()
 	for _, ws := range workspaces {
 		log := log.WithFields(ws.LogFields())
-		log.Infof("notifying workspace %s for %s", ws.Project, repo.FullName)
+		log.Infof("notifying workspace %s for %s", ws.Project, fullName)
 
 		log.Infof("invoking webhook relay here! url=%s, db insecure=%t", ws.LighthouseURL, ws.Insecure)
 		useInsecureRelay := ws.Insecure
@@ -252,98 +459,242 @@ func (o *HookOptions) onGeneralHook(ctx context.Context, log *logrus.Entry, inst
 		decodedHmac, err := base64.StdEncoding.DecodeString(ws.HMAC)
 		if err != nil {
 			log.WithError(err).Errorf("unable to decode hmac")
+			failed++
+			continue
+		}
+
+		if o.config != nil && o.config.Workspace(ws.Project).Pull {
+			err = o.enqueuePull(ctx, ws.Project, event, decodedHmac)
+			if err != nil {
+				metrics.RelayOutcomes.WithLabelValues(ws.Project, metrics.OutcomeFailure).Inc()
+				log.WithError(err).Errorf("failed to queue webhook for workspace %s to pull", ws.Project)
+				failed++
+				continue
+			}
+			metrics.RelayOutcomes.WithLabelValues(ws.Project, metrics.PullOutcomeQueued).Inc()
+			log.Infof("webhook queued for workspace %s to pull for %s", ws.Project, fullName)
 			continue
 		}
 
-		err = o.retryWebhookDelivery(ws.LighthouseURL, githubEventType, githubDeliveryEvent, decodedHmac, useInsecureRelay, bodyBytes, log)
+		if release == nil {
+			release, err = o.acquireRelay(ctx, event)
+			if err != nil {
+				metrics.RelayOutcomes.WithLabelValues(ws.Project, metrics.OutcomeFailure).Inc()
+				log.WithError(err).Errorf("failed to relay webhook to workspace %s", ws.Project)
+				failed++
+				continue
+			}
+		}
+
+		relayID := o.relays.start(ws.Project, ws.LighthouseURL, event.Type, event.Delivery)
+		err = o.retryWebhookDelivery(ctx, relayID, ws.Project, o.workspaceEndpoints(ws), event, decodedHmac, useInsecureRelay, log)
+		o.relays.finish(relayID, err)
 		if err != nil {
+			metrics.RelayOutcomes.WithLabelValues(ws.Project, metrics.OutcomeFailure).Inc()
 			log.WithError(err).Errorf("failed to deliver webhook after %s", o.maxRetryDuration)
+			failed++
 			continue
 		}
-		log.Infof("webhook delivery ok for %s", repo.FullName)
+		metrics.RelayOutcomes.WithLabelValues(ws.Project, metrics.OutcomeSuccess).Inc()
+		log.Infof("webhook delivery ok for %s", fullName)
+	}
+	if failed > 0 {
+		return errors.Errorf("failed to relay the webhook to %d of %d workspaces", failed, len(workspaces))
 	}
-
 	return nil
 }
 
 // retryWebhookDelivery attempts to deliver the relayed webhook, but will retry a few times if the response is a 500 with
 // "repository not configured" in the body, in case the remote Lighthouse doesn't yet have this repository in its configuration.
-func (o *HookOptions) retryWebhookDelivery(lighthouseURL string, githubEventType string, githubDeliveryEvent string, decodedHmac []byte, useInsecureRelay bool, bodyBytes []byte, log *logrus.Entry) error {
-	f := func() error {
-		log.Debugf("relaying %s", string(bodyBytes))
-		g := hmac.NewGenerator("sha256", decodedHmac)
-		signature := g.HubSignature(bodyBytes)
-
-		var httpClient *http.Client
+func (o *HookOptions) retryWebhookDelivery(ctx context.Context, relayID int64, workspace string, endpoints []string, webhook *relay.Event, decodedHmac []byte, useInsecureRelay bool, log *logrus.Entry) error {
+	// GitHub stops waiting for the response after 10 seconds which cancels the context of the request, keep retrying
+	// for the whole retry duration regardless and only carry over its span
+	ctx = tracing.Detach(ctx)
+	sinks := map[string]relay.Sink{}
+	for _, endpoint := range endpoints {
+		sink, err := o.sinks.For(endpoint)
+		if err != nil {
+			return err
+		}
+		sinks[endpoint] = sink
+	}
+	tlsProfile := o.relayTLSProfile(workspace, useInsecureRelay)
 
-		if o.client != nil {
-			httpClient = o.client
-		} else {
-			if useInsecureRelay {
-				// #nosec G402
-				tr := &http.Transport{
-					TLSClientConfig: &tls.Config{
-						InsecureSkipVerify: true,
-					},
-				}
-
-				httpClient = &http.Client{Transport: tr}
-			} else {
-				httpClient = &http.Client{}
+	exponential := backoff.NewExponentialBackOff()
+	// Try again after 2/4/8/... seconds if necessary, for up to 90 seconds, may take up to a minute to for the secret to replicate
+	exponential.InitialInterval = 2 * time.Second
+	exponential.MaxElapsedTime = 2 * (*o.maxRetryDuration)
+	exponential.Reset()
+	bo := newRetryAfterBackOff(exponential, exponential.MaxElapsedTime)
+
+	attempt := 0
+	f := func() (err error) {
+		attempt++
+		ctx, span := tracing.StartSpan(ctx, "relay_attempt")
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
 			}
+			span.End()
+		}()
+		// fail over to the next endpoint of the workspace while the primary is unhealthy
+		lighthouseURL, index := o.endpointHealth.Select(endpoints)
+		role := relay.EndpointRole(index)
+		o.relays.attempting(relayID, lighthouseURL, role)
+		span.SetAttribute("workspace", workspace)
+		span.SetAttribute("url", lighthouseURL)
+		span.SetAttribute("endpoint", role)
+		span.SetAttribute("attempt", attempt)
+
+		log.Debugf("relaying %s", string(webhook.Body))
+		event, err := o.signedEvent(ctx, workspace, webhook, decodedHmac)
+		if err != nil {
+			return backoff.Permanent(err)
 		}
 
-		req, err := http.NewRequest("POST", lighthouseURL, bytes.NewReader(bodyBytes))
-		req.Header.Add("X-GitHub-Event", githubEventType)
-		req.Header.Add("X-GitHub-Delivery", githubDeliveryEvent)
-		req.Header.Add("X-Hub-Signature", signature)
-
-		resp, err := httpClient.Do(req)
-		log.Infof("got resp code %d from url '%s'", resp.StatusCode, lighthouseURL)
+		metrics.RelayAttempts.WithLabelValues(workspace).Inc()
+		start := time.Now()
+		target := &relay.Target{
+			Workspace: workspace,
+			URL:       lighthouseURL,
+			TLS:       tlsProfile,
+		}
+		resp, err := sinks[lighthouseURL].Deliver(ctx, event, target)
+		metrics.RelayDuration.WithLabelValues(workspace).Observe(time.Since(start).Seconds())
 		if err != nil {
+			if relay.IsPermanent(err) {
+				return backoff.Permanent(err)
+			}
+			o.endpointHealth.Failure(lighthouseURL, err)
 			return err
 		}
+		if resp.StatusCode != 0 {
+			log.Infof("got resp code %d from url '%s'", resp.StatusCode, lighthouseURL)
+			span.SetAttribute("http.status_code", resp.StatusCode)
+		}
 
-		// If we got a 500, check if it's got the "repository not configured" string in the body. If so, we retry.
-		if resp.StatusCode == 500 {
-			respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, 10000000))
-			if err != nil {
-				return backoff.Permanent(errors.Wrap(err, "parsing resp.body"))
+		decision := relay.Decide(lighthouseURL, resp, time.Now())
+		if decision.Code == relay.ErrorCodeUnavailable && resp.StatusCode >= 500 {
+			o.endpointHealth.Failure(lighthouseURL, decision.Err)
+		} else {
+			// the endpoint is up even if the workspace could not accept the webhook
+			o.endpointHealth.Success(lighthouseURL)
+		}
+		if decision.Delivered {
+			if resp.StatusCode == 0 {
+				log.Infof("delivered to url '%s' using the %s sink", lighthouseURL, resp.Sink)
 			}
-			err = resp.Body.Close()
-			if err != nil {
-				return backoff.Permanent(errors.Wrap(err, "closing resp.body"))
+			metrics.RelayEndpointDeliveries.WithLabelValues(workspace, role).Inc()
+			if index > 0 {
+				log.Warnf("delivered to the %s endpoint '%s' as the primary endpoint is unhealthy", role, lighthouseURL)
 			}
-			log.Infof("got error respBody '%s'", string(respBody))
+			return nil
+		}
+		log.WithField("Code", decision.Code).Infof("got error respBody '%s'", string(resp.Body))
+		span.SetAttribute("relay.error_code", decision.Code)
+		if !decision.Retryable {
+			return backoff.Permanent(decision.Err)
+		}
+		bo.retryAfter(decision.RetryAfter)
+		return decision.Err
+	}
 
-			if strings.Contains(string(respBody), repoNotConfiguredMessage) {
-				return errors.New("repository not configured in Lighthouse")
-			}
+	return backoff.RetryNotify(f, bo, func(e error, t time.Duration) {
+		metrics.BackoffRetries.WithLabelValues(metrics.OperationRelay).Inc()
+		o.relays.retrying(relayID, e)
+		log.Infof("webhook relaying failed: %s, backing off for %s", e, t)
+	})
+}
 
-			if strings.Contains(string(respBody), noGithubAppSecretFoundForOwner) {
-				return errors.New("no github app secret found for owner")
-			}
+// workspaceEndpoints returns the Lighthouse URL of the workspace followed by its standby endpoints
+func (o *HookOptions) workspaceEndpoints(ws *access.WorkspaceAccess) []string {
+	endpoints := []string{ws.LighthouseURL}
+	if o.config != nil {
+		endpoints = append(endpoints, o.config.Workspace(ws.Project).Endpoints...)
+	}
+	return endpoints
+}
+
+// signedEvent returns the request relayed to the workspace for the webhook signed with the HMAC of the workspace
+func (o *HookOptions) signedEvent(ctx context.Context, workspace string, webhook *relay.Event, decodedHmac []byte) (*relay.Event, error) {
+	g, err := hmac.NewGenerator("sha256", decodedHmac)
+	if err != nil {
+		return nil, err
+	}
+
+	event := *webhook
+	event.Headers = http.Header{}
+	event.Headers.Add("X-GitHub-Event", webhook.Type)
+	event.Headers.Add("X-GitHub-Delivery", webhook.Delivery)
+	now := time.Now()
+	cloudEvents := ""
+	if o.config != nil {
+		cloudEvents = o.config.Workspace(workspace).CloudEvents
+	}
+	if cloudEvents != "" {
+		// the signatures cover the body which is relayed so the event is presented as a CloudEvent first
+		ce, err := relay.CloudEvent(&event, cloudEvents, now)
+		if err != nil {
+			return nil, err
 		}
+		event = *ce
+	}
 
-		// If we got anything other than a 2xx, retry as well.
-		// We're leaving this distinct from the "not configured" behavior in case we want to resurrect that later. (apb)
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return errors.Errorf("%s not available, error was %s", req.URL.String(), resp.Status)
+	signature := g.HubSignature(event.Body)
+	event.Headers.Add("X-Hub-Signature", signature)
+	event.Headers.Add(relay.HeaderSignature256, signature)
+	if o.config != nil && o.config.SignTimestamps(workspace) {
+		g.SignRequest(event.Headers, now, event.Body)
+	}
+	if o.signingKeys != nil {
+		err = o.signingKeys.Sign(event.Headers, now, event.Body)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to sign the webhook for workspace %s", workspace)
 		}
+	}
+	webhook.SetRelayHeaders(event.Headers, o.Version)
+	if webhook.Bot {
+		event.Headers.Add(HeaderBotEvent, "true")
+	}
+	tracing.Inject(ctx, event.Headers)
+	return &event, nil
+}
+
+// newSinks creates the sinks which relay to the workspaces by the scheme of their URL
+func newSinks(clients *relay.ClientFactory, client *http.Client, fileDir string, natsServers []string, timeout time.Duration) *relay.Sinks {
+	sinks := relay.NewSinks()
+	httpSink := &relay.HTTPSink{Clients: clients, Client: client}
+	sinks.Register("http", httpSink)
+	sinks.Register("https", httpSink)
+	sinks.Register("file", &relay.FileSink{Dir: fileDir})
+	sinks.Register("nats", &relay.NATSSink{Timeout: timeout, Servers: natsServers})
+	return sinks
+}
 
-		// And finally, if we haven't gotten any errors, just return nil because we're good.
+// Close relays the webhooks held to be coalesced and closes the connections held by the sinks
+func (o *HookOptions) Close() error {
+	if o.limiter != nil {
+		o.limiter.Close()
+	}
+	if o.coalescer != nil {
+		o.coalescer.Flush()
+	}
+	if o.sinks == nil {
 		return nil
 	}
+	return o.sinks.Close()
+}
 
-	bo := backoff.NewExponentialBackOff()
-	// Try again after 2/4/8/... seconds if necessary, for up to 90 seconds, may take up to a minute to for the secret to replicate
-	bo.InitialInterval = 2 * time.Second
-	bo.MaxElapsedTime = 2 * (*o.maxRetryDuration)
-	bo.Reset()
-
-	return backoff.RetryNotify(f, bo, func(e error, t time.Duration) {
-		log.Infof("webhook relaying failed: %s, backing off for %s", e, t)
-	})
+// relayTLSProfile returns the TLS profile used to relay to the workspace
+func (o *HookOptions) relayTLSProfile(workspace string, insecure bool) relay.TLSProfile {
+	profile := relay.TLSProfile{Insecure: insecure}
+	if o.config != nil {
+		ws := o.config.Workspace(workspace)
+		profile.CAFile = ws.CAFile
+		profile.CertFile = ws.CertFile
+		profile.KeyFile = ws.KeyFile
+	}
+	return profile
 }
 
 func (o *HookOptions) retryGetWorkspaces(f func() error, n func(error, time.Duration)) error {
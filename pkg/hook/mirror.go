@@ -0,0 +1,41 @@
+package hook
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/mirror"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/pkg/errors"
+)
+
+// newMirror creates the mirror of the configured canary Lighthouses reading their HMAC tokens
+func newMirror(cfg *config.Config, sinks *relay.Sinks, version string) (*mirror.Mirror, error) {
+	rules := []mirror.Rule{}
+	for _, m := range cfg.Mirrors {
+		data, err := ioutil.ReadFile(m.HMACFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read the HMAC token of mirror %s", m.Name)
+		}
+		secret := strings.TrimSpace(string(data))
+		if secret == "" {
+			return nil, errors.Errorf("the HMAC token file %s of mirror %s is empty", m.HMACFile, m.Name)
+		}
+		percentage := 100
+		if m.Percentage != nil {
+			percentage = *m.Percentage
+		}
+		rules = append(rules, mirror.Rule{
+			Name:          m.Name,
+			URL:           m.URL,
+			Secret:        []byte(secret),
+			TLS:           relay.TLSProfile{Insecure: m.Insecure, CAFile: m.CAFile},
+			Installations: m.Installations,
+			Repositories:  m.Repositories,
+			Events:        m.Events,
+			Percentage:    percentage,
+		})
+	}
+	return mirror.New(rules, sinks, mirror.Options{Timeout: cfg.RelayTimeoutDuration(), Version: version}), nil
+}
@@ -0,0 +1,140 @@
+package hook
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudbees/jx-tenant-service/pkg/access"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/pending"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// PendingRecheck the result of checking whether the repositories with parked events are now routable
+type PendingRecheck struct {
+	Repositories int `json:"repositories"`
+	Routable     int `json:"routable"`
+	Delivered    int `json:"delivered"`
+	Failed       int `json:"failed"`
+	Errors       int `json:"errors"`
+}
+
+// park keeps the event until a workspace is interested in its repository
+func (o *HookOptions) park(log *logrus.Entry, event *relay.Event, fullName string) error {
+	err := o.pending.Park(&pending.Event{
+		Type:         event.Type,
+		Delivery:     event.Delivery,
+		Installation: event.Installation,
+		Repository:   event.Source,
+		FullName:     fullName,
+		Bot:          event.Bot,
+		Forwarded:    event.Forwarded,
+		Hop:          event.Hop,
+		Body:         event.Body,
+		ReceivedAt:   event.ReceivedAt,
+	})
+	if err != nil {
+		log.WithError(err).Errorf("no workspaces interested in '%s' and failed to park the webhook", fullName)
+		return errors.Wrapf(err, "failed to park the webhook for '%s'", fullName)
+	}
+	log.Warnf("no workspaces interested in '%s' yet, parked the webhook until there are", fullName)
+	return nil
+}
+
+// relayParked relays the events parked for the repository in the order they were received returning the number of
+// events relayed to every workspace and the number which failed for some of them. The failed events are not parked
+// again as the workspaces which did receive them would receive them twice.
+func (o *HookOptions) relayParked(ctx context.Context, log *logrus.Entry, repository string, workspaces []*access.WorkspaceAccess) (int, int) {
+	delivered, failed := 0, 0
+	events := o.pending.Take(repository)
+	for _, parked := range events {
+		log := log.WithField("ParkedDelivery", parked.Delivery)
+		log.Infof("relaying the webhook parked at %s for %s", parked.ParkedAt.Format(time.RFC3339), parked.FullName)
+		event := &relay.Event{
+			Type:         parked.Type,
+			Delivery:     parked.Delivery,
+			Source:       parked.Repository,
+			Installation: parked.Installation,
+			Bot:          parked.Bot,
+			Forwarded:    parked.Forwarded,
+			Hop:          parked.Hop,
+			ReceivedAt:   parked.ReceivedAt,
+			Body:         parked.Body,
+		}
+		err := o.relayToWorkspaces(ctx, log, workspaces, event, parked.FullName)
+		if err != nil {
+			failed++
+			metrics.PendingEvents.WithLabelValues(metrics.PendingOutcomeFailed).Inc()
+			log.WithError(err).Warnf("failed to relay the webhook parked for %s", parked.FullName)
+			continue
+		}
+		delivered++
+		metrics.PendingEvents.WithLabelValues(metrics.PendingOutcomeDelivered).Inc()
+	}
+	return delivered, failed
+}
+
+// RecheckPending looks up the workspaces of the repositories with parked events which were rechecked the longest time
+// ago and relays the parked events of the repositories which are now routable. The number of repositories looked up
+// at once is limited so a recheck does not flood the tenant service. It is invoked periodically and can be triggered
+// by the tenant service via the admin endpoint when a repository is imported.
+func (o *HookOptions) RecheckPending(ctx context.Context) (*PendingRecheck, error) {
+	if o.pending == nil {
+		return &PendingRecheck{}, nil
+	}
+	repositories := o.pending.Due()
+	answer := &PendingRecheck{Repositories: len(repositories)}
+	for _, repository := range repositories {
+		log := logrus.WithFields(map[string]interface{}{
+			"InstallationID": repository.Installation,
+			"FullName":       repository.FullName,
+			"Link":           repository.URL,
+			"Function":       "RecheckPending",
+		})
+		workspaces, err := o.tenantService.FindWorkspaces(ctx, log, repository.Installation, repository.URL)
+		if err != nil {
+			answer.Errors++
+			metrics.FindWorkspacesErrors.Inc()
+			log.WithError(err).Warnf("unable to find workspaces for %s with parked webhooks", repository.FullName)
+			continue
+		}
+		if len(workspaces) == 0 {
+			log.Debugf("still no workspaces interested in %s with %d parked webhooks", repository.FullName, repository.Parked)
+			continue
+		}
+		answer.Routable++
+		delivered, failed := o.relayParked(ctx, log, repository.URL, workspaces)
+		answer.Delivered += delivered
+		answer.Failed += failed
+	}
+	if answer.Errors > 0 && answer.Errors == answer.Repositories {
+		return answer, errors.Errorf("failed to find the workspaces of all %d repositories with parked webhooks", answer.Errors)
+	}
+	return answer, nil
+}
+
+// RunPendingRecheck rechecks the repositories with parked events at the interval until the context is done
+func (o *HookOptions) RunPendingRecheck(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if o.pending.Depth() == 0 {
+				continue
+			}
+			result, err := o.RecheckPending(ctx)
+			if err != nil {
+				logrus.WithError(err).Warn("failed to recheck the repositories with parked webhooks")
+				continue
+			}
+			if result.Delivered > 0 || result.Failed > 0 {
+				logrus.Infof("relayed %d parked webhooks and failed to relay %d for %d repositories", result.Delivered, result.Failed, result.Routable)
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudbees/jx-tenant-service/pkg/access"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/pending"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/pull"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tenant"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// importingTenantService a tenant service which knows about no workspaces until the repository is imported
+type importingTenantService struct {
+	tenant.TenantService
+	lock     sync.Mutex
+	imported bool
+}
+
+func (t *importingTenantService) FindWorkspaces(ctx context.Context, log *logrus.Entry, installationID int64, gitURL string) ([]*access.WorkspaceAccess, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.imported {
+		return nil, nil
+	}
+	return t.TenantService.FindWorkspaces(ctx, log, installationID, gitURL)
+}
+
+func (t *importingTenantService) importRepository() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.imported = true
+}
+
+func TestPendingWebhooksRelayedInOrderOnceRoutable(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.Workspaces = map[string]config.WorkspaceConfig{
+		"cbjx-mycluster": {Pull: true, PullTokenFile: "token"},
+	}
+	workspace := &access.WorkspaceAccess{Project: "cbjx-mycluster", Cluster: "mycluster", LighthouseURL: "http://unreachable-lighthouse-url/hook", HMAC: "MTIzNA=="}
+	tenantService := &importingTenantService{TenantService: tenant.NewFakeTenantService(workspace)}
+	retryDuration := 10 * time.Millisecond
+	handler := newTestHook(t, HookOptions{
+		tenantService: tenantService,
+		secretFn: func(scm.Webhook) (string, error) {
+			return "", nil
+		},
+		maxRetryDuration: &retryDuration,
+		pull:             pull.NewBroker(pull.Options{}),
+		pending:          pending.NewStore(pending.Options{}),
+		config:           cfg,
+	})
+
+	body, err := ioutil.ReadFile("testdata/push.json")
+	require.NoError(t, err)
+	send := func(delivery string) {
+		r, err := http.NewRequest("POST", "/", bytes.NewBuffer(body))
+		require.NoError(t, err)
+		r.Header.Set("X-GitHub-Event", "push")
+		r.Header.Set("X-GitHub-Delivery", delivery)
+		r.Header.Set("X-Hub-Signature", "sha1=e9c4409d39729236fda483f22e7fb7513e5cd273")
+		w := NewFakeRespone(t)
+		handler.handleWebHookRequests(w, r)
+		assert.Equal(t, "OK", string(w.body))
+	}
+
+	send("delivery-1")
+	send("delivery-2")
+	require.Equal(t, 2, handler.pending.Depth())
+
+	result, err := handler.RecheckPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &PendingRecheck{Repositories: 1}, result)
+
+	tenantService.importRepository()
+	send("delivery-3")
+	assert.Equal(t, 0, handler.pending.Depth())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	events := handler.pull.Receive(ctx, "cbjx-mycluster", 10)
+	deliveries := []string{}
+	for _, event := range events {
+		deliveries = append(deliveries, event.Headers["X-GitHub-Delivery"])
+	}
+	assert.Equal(t, []string{"delivery-1", "delivery-2", "delivery-3"}, deliveries)
+}
+
+func TestRecheckPending(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.Workspaces = map[string]config.WorkspaceConfig{
+		"cbjx-mycluster": {Pull: true, PullTokenFile: "token"},
+	}
+	workspace := &access.WorkspaceAccess{Project: "cbjx-mycluster", Cluster: "mycluster", LighthouseURL: "http://unreachable-lighthouse-url/hook", HMAC: "MTIzNA=="}
+	handler := newTestHook(t, HookOptions{
+		tenantService: tenant.NewFakeTenantService(workspace),
+		pull:          pull.NewBroker(pull.Options{}),
+		pending:       pending.NewStore(pending.Options{}),
+		config:        cfg,
+	})
+	receivedAt := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+	for _, delivery := range []string{"delivery-1", "delivery-2"} {
+		require.NoError(t, handler.pending.Park(&pending.Event{
+			Type:         "push",
+			Delivery:     delivery,
+			Installation: 1234,
+			Repository:   "https://github.com/cloudbees/lighthouse-githubapp",
+			FullName:     "cloudbees/lighthouse-githubapp",
+			Body:         []byte(`{}`),
+			ReceivedAt:   receivedAt,
+		}))
+	}
+
+	result, err := handler.RecheckPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &PendingRecheck{Repositories: 1, Routable: 1, Delivered: 2}, result)
+	assert.Equal(t, 0, handler.pending.Depth())
+	assert.Equal(t, 2, handler.pull.Depth())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, event := range handler.pull.Receive(ctx, "cbjx-mycluster", 10) {
+		assert.Equal(t, "2020-09-13T12:26:40Z", event.Headers[relay.HeaderRelayReceivedAt], "a parked webhook should keep the time it was received from GitHub")
+	}
+
+	workspace.HMAC = "not base64"
+	require.NoError(t, handler.pending.Park(&pending.Event{
+		Type:         "push",
+		Delivery:     "delivery-3",
+		Installation: 1234,
+		Repository:   "https://github.com/cloudbees/lighthouse-githubapp",
+		FullName:     "cloudbees/lighthouse-githubapp",
+		Body:         []byte(`{}`),
+	}))
+	result, err = handler.RecheckPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &PendingRecheck{Repositories: 1, Routable: 1, Failed: 1}, result)
+	assert.Equal(t, 0, handler.pending.Depth())
+	assert.Equal(t, 2, handler.pull.Depth())
+}
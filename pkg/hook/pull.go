@@ -0,0 +1,70 @@
+package hook
+
+import (
+	"context"
+	"crypto/subtle"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tracing"
+	"github.com/sirupsen/logrus"
+)
+
+// gitHubHeaders the names of the headers which keep the casing GitHub sends them with rather than the canonical one
+var gitHubHeaders = []string{"X-GitHub-Event", "X-GitHub-Delivery"}
+
+// enqueuePull queues the webhook for a workspace in pull mode with the same headers and body that are used when
+// relaying it. The webhook is signed again each time it is delivered so that the workspace can reject stale
+// signatures however long the webhook waited in the queue.
+func (o *HookOptions) enqueuePull(ctx context.Context, workspace string, event *relay.Event, decodedHmac []byte) error {
+	ctx = tracing.Detach(ctx)
+	sign := func() (map[string]string, []byte, error) {
+		signed, err := o.signedEvent(ctx, workspace, event, decodedHmac)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pullHeaders(signed.Headers), signed.Body, nil
+	}
+	headers, body, err := sign()
+	if err != nil {
+		return err
+	}
+	_, err = o.pull.Enqueue(workspace, headers, body, sign)
+	return err
+}
+
+// pullHeaders returns the headers of a pulled event
+func pullHeaders(h http.Header) map[string]string {
+	headers := map[string]string{}
+	for name := range h {
+		headers[name] = h.Get(name)
+	}
+	for _, name := range gitHubHeaders {
+		canonical := http.CanonicalHeaderKey(name)
+		if value, ok := headers[canonical]; ok {
+			delete(headers, canonical)
+			headers[name] = value
+		}
+	}
+	return headers
+}
+
+// authenticatePull returns true if the token matches the pull token of the workspace
+func (o *HookOptions) authenticatePull(workspace string, token string) bool {
+	if o.config == nil {
+		return false
+	}
+	ws := o.config.Workspace(workspace)
+	if !ws.Pull || ws.PullTokenFile == "" {
+		return false
+	}
+	data, err := ioutil.ReadFile(ws.PullTokenFile)
+	if err != nil {
+		logrus.WithError(err).Warnf("failed to read the pull token file %s of workspace %s", ws.PullTokenFile, workspace)
+		return false
+	}
+	expected := strings.TrimSpace(string(data))
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
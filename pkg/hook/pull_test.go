@@ -0,0 +1,93 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudbees/jx-tenant-service/pkg/access"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/pull"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tenant"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullModeQueuesWebhooks(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "pull")
+	require.NoError(t, err)
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("s3cr3t\n"), 0600))
+
+	cfg := config.Default()
+	cfg.Workspaces = map[string]config.WorkspaceConfig{
+		"cbjx-mycluster": {Pull: true, PullTokenFile: tokenFile},
+	}
+	workspace := &access.WorkspaceAccess{Project: "cbjx-mycluster", Cluster: "mycluster", LighthouseURL: "http://unreachable-lighthouse-url/hook", HMAC: "MTIzNA=="}
+	handler := newTestHook(t, HookOptions{
+		tenantService: tenant.NewFakeTenantService(workspace),
+		secretFn: func(scm.Webhook) (string, error) {
+			return "", nil
+		},
+		pull:   pull.NewBroker(pull.Options{}),
+		config: cfg,
+	})
+
+	before, err := ioutil.ReadFile("testdata/push.json")
+	require.NoError(t, err)
+	r, err := http.NewRequest("POST", "/", bytes.NewBuffer(before))
+	require.NoError(t, err)
+	r.Header.Set("X-GitHub-Event", "push")
+	r.Header.Set("X-GitHub-Delivery", "f2467dea-70d6-11e8-8955-3c83993e0aef")
+	r.Header.Set("X-Hub-Signature", "sha1=e9c4409d39729236fda483f22e7fb7513e5cd273")
+
+	w := NewFakeRespone(t)
+	handler.handleWebHookRequests(w, r)
+	assert.Equal(t, "OK", string(w.body))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	events := handler.pull.Receive(ctx, "cbjx-mycluster", 10)
+	require.Len(t, events, 1)
+	assert.Equal(t, before, events[0].Body)
+	assert.Equal(t, "push", events[0].Headers["X-GitHub-Event"])
+	assert.Equal(t, "f2467dea-70d6-11e8-8955-3c83993e0aef", events[0].Headers["X-GitHub-Delivery"])
+	assert.Equal(t, "sha256=99a6c7b0894b25577f26d06d94c320bc5e234ae72e414b038436877ccef02652", events[0].Headers["X-Hub-Signature"])
+
+	assert.True(t, handler.authenticatePull("cbjx-mycluster", "s3cr3t"))
+	assert.False(t, handler.authenticatePull("cbjx-mycluster", "wrong"))
+	assert.False(t, handler.authenticatePull("cbjx-other", "s3cr3t"))
+}
+
+func TestPullModeQueuesTheRelayedRequest(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.Workspaces = map[string]config.WorkspaceConfig{
+		"cbjx-mycluster": {Pull: true, CloudEvents: relay.CloudEventsStructured},
+	}
+	handler := HookOptions{pull: pull.NewBroker(pull.Options{}), config: cfg}
+	event := &relay.Event{
+		Type:     "push",
+		Delivery: "f2467dea-70d6-11e8-8955-3c83993e0aef",
+		Source:   "https://github.com/myorg/myrepo",
+		Body:     []byte(`{"ref":"main"}`),
+		Bot:      true,
+	}
+	require.NoError(t, handler.enqueuePull(context.Background(), "cbjx-mycluster", event, []byte("1234")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	events := handler.pull.Receive(ctx, "cbjx-mycluster", 10)
+	require.Len(t, events, 1)
+	assert.Equal(t, "true", events[0].Headers[HeaderBotEvent])
+	assert.Contains(t, string(events[0].Body), `"specversion"`, "the webhook should be queued as a CloudEvent")
+}
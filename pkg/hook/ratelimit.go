@@ -0,0 +1,126 @@
+package hook
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/ratelimit"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tracing"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// newLimiter creates the limiter of the installations from the configuration
+func newLimiter(cfg *config.Config) *ratelimit.Limiter {
+	overrides := map[int64]ratelimit.Limits{}
+	for id, inst := range cfg.Installations {
+		overrides[id] = ratelimit.Limits{
+			Ingest:              ratelimit.Limit{Rate: inst.IngestRate, Burst: inst.IngestBurst},
+			Relay:               ratelimit.Limit{Rate: inst.RelayRate, Burst: inst.RelayBurst},
+			MaxConcurrentRelays: inst.RelayMaxConcurrent,
+		}
+	}
+	return ratelimit.New(ratelimit.Options{
+		Default: ratelimit.Limits{
+			Ingest:              ratelimit.Limit{Rate: cfg.IngestRate, Burst: cfg.IngestBurst},
+			Relay:               ratelimit.Limit{Rate: cfg.RelayRate, Burst: cfg.RelayBurst},
+			MaxConcurrentRelays: cfg.RelayMaxPerInstallation,
+		},
+		Overrides: overrides,
+		MaxQueued: cfg.IngestMaxQueued,
+	})
+}
+
+// acquireRelay waits until the installation of the event is within its relay limits and then for a worker in the
+// priority lane of the event. The installation is admitted first so that a noisy installation waits without holding
+// workers of the lane the other installations share. The relay outlives the request of the webhook so the event waits
+// for its turn even once GitHub stopped waiting for the response rather than being dropped.
+func (o *HookOptions) acquireRelay(ctx context.Context, event *relay.Event) (func(), error) {
+	ctx = tracing.Detach(ctx)
+	releaseInstallation := func() {}
+	if o.limiter != nil {
+		release, err := o.limiter.AcquireRelay(ctx, event.Installation)
+		if err != nil {
+			return nil, err
+		}
+		releaseInstallation = release
+	}
+	if o.lanes == nil {
+		return releaseInstallation, nil
+	}
+	releaseLane, err := o.lanes.Acquire(ctx, event.Type)
+	if err != nil {
+		releaseInstallation()
+		return nil, err
+	}
+	return func() {
+		releaseLane()
+		releaseInstallation()
+	}, nil
+}
+
+// RunRateLimitPoll records the remaining GitHub API rate limit of each installation which sent webhooks recently at
+// the interval until the context is done
+func (o *HookOptions) RunRateLimitPoll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if o.limiter == nil {
+				continue
+			}
+			for _, inst := range o.limiter.Snapshot() {
+				err := o.pollRateLimit(ctx, inst.Installation)
+				if err != nil {
+					logrus.WithError(err).WithField("installation", inst.Installation).Warn("failed to poll the GitHub API rate limit")
+				}
+			}
+		}
+	}
+}
+
+// pollRateLimit requests the rate limit of the installation with an installation token from the tenant service,
+// as the webhooks themselves only call GitHub as the App. Requests for the rate limit do not count against it.
+func (o *HookOptions) pollRateLimit(ctx context.Context, installation int64) error {
+	log := logrus.WithField("installation", installation)
+	token, err := o.tenantService.GetGithubAppToken(ctx, log, installation)
+	if err != nil {
+		return err
+	}
+	scmClient, _, _, err := o.createSCMClient(token.Token)
+	if err != nil {
+		return errors.Wrap(err, "failed to create the SCM client")
+	}
+	u, err := scmClient.BaseURL.Parse("rate_limit")
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve the rate limit URL of %s", scmClient.BaseURL.String())
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create the request for %s", u.String())
+	}
+	client := &http.Client{
+		Transport: metrics.NewRateLimitTransport(scmClient.Client.Transport, strconv.FormatInt(installation, 10)),
+		Timeout:   time.Duration(o.config.HTTP.RequestTimeout) * time.Second,
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "failed to request %s", u.String())
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		log.WithError(err).Debug("failed to close the response body")
+	}
+	if resp.StatusCode >= 400 {
+		return errors.Errorf("%s returned %s", u.String(), resp.Status)
+	}
+	return nil
+}
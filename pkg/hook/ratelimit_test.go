@@ -0,0 +1,79 @@
+package hook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudbees/jx-tenant-service/pkg/domain"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/lanes"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tenant"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenTenantService a tenant service which returns the same installation token for every installation
+type tokenTenantService struct {
+	tenant.TenantService
+}
+
+func (t *tokenTenantService) GetGithubAppToken(ctx context.Context, log *logrus.Entry, installationID int64) (*domain.InstallationToken, error) {
+	return &domain.InstallationToken{Token: "mytoken"}, nil
+}
+
+func TestAcquireRelayOutlivesTheGitHubRequest(t *testing.T) {
+	t.Parallel()
+
+	handler := HookOptions{lanes: lanes.New(lanes.Options{LowWorkers: 1})}
+	event := &relay.Event{Type: "push", Installation: 1234}
+	releaseFirst, err := handler.acquireRelay(context.Background(), event)
+	require.NoError(t, err)
+
+	// GitHub stops waiting for the second webhook while it waits for a worker
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	acquired := make(chan error, 1)
+	go func() {
+		release, err := handler.acquireRelay(ctx, event)
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	<-ctx.Done()
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case err := <-acquired:
+		t.Fatalf("the webhook should keep waiting for a worker but got %v", err)
+	default:
+	}
+
+	releaseFirst()
+	assert.NoError(t, <-acquired)
+}
+
+func TestPollRateLimitOfAnInstallation(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasSuffix(r.URL.Path, "/rate_limit"), "unexpected path %s", r.URL.Path)
+		assert.Equal(t, "token mytoken", r.Header.Get("Authorization"), "the installation token should be used")
+		w.Header().Set("X-RateLimit-Remaining", "4321")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.GitServer = server.URL
+	handler := HookOptions{config: cfg, tenantService: &tokenTenantService{}}
+	require.NoError(t, handler.pollRateLimit(context.Background(), 5678))
+	assert.Equal(t, float64(4321), testutil.ToFloat64(metrics.GitHubRateLimitRemaining.WithLabelValues("5678")))
+}
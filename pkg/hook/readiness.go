@@ -0,0 +1,158 @@
+package hook
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/health"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// newReadinessChecker creates the readiness checks for the hook
+func (o *HookOptions) newReadinessChecker() *health.Checker {
+	o.appCheck = health.NewCachedCheck(health.NewCheckFunc("github-app", o.checkGitHubApp), appCheckCacheDuration)
+	return health.NewChecker(readinessTimeout,
+		health.NewCheckFunc("private-key", o.checkPrivateKey),
+		o.appCheck,
+		health.NewCheckFunc("tenant-service", o.checkTenantService),
+		health.NewCheckFunc("relay-queue", o.checkRelayQueue),
+	)
+}
+
+// readinessReport runs the readiness checks
+func (o *HookOptions) readinessReport(ctx context.Context) health.Report {
+	if o.readiness == nil {
+		return health.Report{Ready: true, Checks: []health.Result{}}
+	}
+	return o.readiness.Run(ctx)
+}
+
+// ready returns HTTP 200 if the service is ready to serve requests, otherwise HTTP 503. The body contains the
+// result of each readiness check.
+func (o *HookOptions) ready(w http.ResponseWriter, r *http.Request) {
+	l := util.TraceLogger(r.Context())
+	l.Debug("Ready check")
+	report := o.readinessReport(r.Context())
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		l.WithError(err).Error("failed to marshal the readiness report")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if report.Ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		l.WithField("Report", string(data)).Warn("not ready")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeResult(l, w, string(data))
+}
+
+// checkPrivateKey verifies the App private key can be read and parsed
+func (o *HookOptions) checkPrivateKey(ctx context.Context) error {
+	privateKeyFile := o.config.AppPrivateKeyFile
+	if privateKeyFile == "" {
+		return errors.New("missing private key file environment variable LHA_PRIVATE_KEY_FILE")
+	}
+	data, err := ioutil.ReadFile(privateKeyFile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read the private key file %s", privateKeyFile)
+	}
+	_, err = parsePrivateKey(data)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse the private key file %s", privateKeyFile)
+	}
+	return nil
+}
+
+// parsePrivateKey parses the PEM encoded RSA private key of the App
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err == nil {
+		return key, nil
+	}
+	parsed, err2 := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err2 != nil {
+		return nil, err
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// checkGitHubApp verifies GitHub accepts the App JWT by calling GET /app
+func (o *HookOptions) checkGitHubApp(ctx context.Context) error {
+	_, err := o.getApp(ctx)
+	return err
+}
+
+// gitHubApp the fields of the GitHub App returned by GET /app which are used
+type gitHubApp struct {
+	ID   int64  `json:"id"`
+	Slug string `json:"slug"`
+}
+
+// getApp returns the GitHub App authenticated by the App JWT
+func (o *HookOptions) getApp(ctx context.Context) (*gitHubApp, error) {
+	scmClient, _, err := createAppsScmClient(o.config)
+	if err != nil {
+		return nil, err
+	}
+	u := scmClient.BaseURL.ResolveReference(&url.URL{Path: "app"})
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request for %s", u.String())
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/vnd.github.machine-man-preview+json")
+	resp, err := scmClient.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to invoke GET %s", u.String())
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			logrus.WithError(err).Debug("failed to close the response body")
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s returned %s", u.String(), resp.Status)
+	}
+	app := &gitHubApp{}
+	err = json.NewDecoder(resp.Body).Decode(app)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the response of GET %s", u.String())
+	}
+	return app, nil
+}
+
+// checkTenantService verifies the tenant service is reachable
+func (o *HookOptions) checkTenantService(ctx context.Context) error {
+	return o.tenantService.Ping(ctx, util.TraceLogger(ctx))
+}
+
+// checkRelayQueue verifies the number of relays in flight is below the high-water mark
+func (o *HookOptions) checkRelayQueue(ctx context.Context) error {
+	depth := o.relays.depth()
+	highWaterMark := o.config.RelayQueueHighWaterMark
+	if depth >= highWaterMark {
+		return errors.Errorf("%d relays in flight which is at or above the high-water mark of %d", depth, highWaterMark)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package hook
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/health"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReady(t *testing.T) {
+	options := &HookOptions{
+		tenantService: tenant.NewFakeTenantService(nil),
+		relays:        newRelayTracker(),
+		config:        config.Default(),
+	}
+	options.readiness = health.NewChecker(time.Second,
+		health.NewCheckFunc("tenant-service", options.checkTenantService),
+		health.NewCheckFunc("relay-queue", options.checkRelayQueue),
+	)
+	options.relays.start("cbjx-mycluster", "http://dummy-lighthouse-url/hook", "push", "f2467dea-70d6-11e8-8955-3c83993e0aef")
+
+	tests := []struct {
+		name           string
+		highWaterMark  int
+		expectedStatus int
+		expectedReady  bool
+	}{
+		{
+			name:           "below high-water mark",
+			highWaterMark:  10,
+			expectedStatus: http.StatusOK,
+			expectedReady:  true,
+		},
+		{
+			name:           "at high-water mark",
+			highWaterMark:  1,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedReady:  false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			options.config.RelayQueueHighWaterMark = tc.highWaterMark
+			req, err := http.NewRequest("GET", ReadyPath, nil)
+			require.NoError(t, err)
+			rr := httptest.NewRecorder()
+			options.ready(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			report := health.Report{}
+			err = json.Unmarshal(rr.Body.Bytes(), &report)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedReady, report.Ready)
+			require.Len(t, report.Checks, 2)
+			assert.True(t, report.Checks[0].Ready)
+			assert.Equal(t, tc.expectedReady, report.Checks[1].Ready)
+		})
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	parsed, err := parsePrivateKey(data)
+	require.NoError(t, err)
+	assert.Equal(t, key.N, parsed.N)
+
+	_, err = parsePrivateKey([]byte("not a key"))
+	assert.Error(t, err)
+}
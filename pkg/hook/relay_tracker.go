@@ -0,0 +1,146 @@
+package hook
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RelayDelivery a webhook delivery to a workspace which is in flight
+type RelayDelivery struct {
+	ID        int64     `json:"id"`
+	Workspace string    `json:"workspace"`
+	URL       string    `json:"url"`
+	Endpoint  string    `json:"endpoint,omitempty"`
+	Event     string    `json:"event"`
+	Delivery  string    `json:"delivery"`
+	Started   time.Time `json:"started"`
+	Retries   int       `json:"retries"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// WorkspaceRelayStatus the recent delivery history of a workspace
+type WorkspaceRelayStatus struct {
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	LastFailure         *time.Time `json:"lastFailure,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	// LastEndpoint the role of the endpoint which handled the last delivery
+	LastEndpoint string `json:"lastEndpoint,omitempty"`
+	// LastURL the URL of the endpoint which handled the last delivery
+	LastURL string `json:"lastURL,omitempty"`
+}
+
+// RelayState a snapshot of the deliveries in flight and the status of each workspace
+type RelayState struct {
+	InFlight   []RelayDelivery                 `json:"inFlight"`
+	Workspaces map[string]WorkspaceRelayStatus `json:"workspaces"`
+}
+
+// relayTracker keeps track of the webhook deliveries in flight and the delivery status of each workspace
+type relayTracker struct {
+	lock       sync.Mutex
+	nextID     int64
+	inFlight   map[int64]*RelayDelivery
+	workspaces map[string]*WorkspaceRelayStatus
+}
+
+func newRelayTracker() *relayTracker {
+	return &relayTracker{
+		inFlight:   map[int64]*RelayDelivery{},
+		workspaces: map[string]*WorkspaceRelayStatus{},
+	}
+}
+
+// start records a new delivery in flight returning its ID
+func (t *relayTracker) start(workspace string, url string, event string, delivery string) int64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.nextID++
+	t.inFlight[t.nextID] = &RelayDelivery{
+		ID:        t.nextID,
+		Workspace: workspace,
+		URL:       url,
+		Event:     event,
+		Delivery:  delivery,
+		Started:   time.Now(),
+	}
+	return t.nextID
+}
+
+// attempting records the endpoint the delivery is being attempted to
+func (t *relayTracker) attempting(id int64, url string, endpoint string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	d := t.inFlight[id]
+	if d != nil {
+		d.URL = url
+		d.Endpoint = endpoint
+	}
+}
+
+// retrying records that an attempt of the delivery failed and will be retried
+func (t *relayTracker) retrying(id int64, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	d := t.inFlight[id]
+	if d != nil {
+		d.Retries++
+		d.LastError = err.Error()
+	}
+}
+
+// finish removes the delivery from the in flight deliveries and updates the workspace status
+func (t *relayTracker) finish(id int64, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	d := t.inFlight[id]
+	if d == nil {
+		return
+	}
+	delete(t.inFlight, id)
+
+	status := t.workspaces[d.Workspace]
+	if status == nil {
+		status = &WorkspaceRelayStatus{}
+		t.workspaces[d.Workspace] = status
+	}
+	now := time.Now()
+	if err != nil {
+		status.ConsecutiveFailures++
+		status.LastFailure = &now
+		status.LastError = err.Error()
+	} else {
+		status.ConsecutiveFailures = 0
+		status.LastSuccess = &now
+		status.LastEndpoint = d.Endpoint
+		status.LastURL = d.URL
+	}
+}
+
+// depth returns the number of deliveries in flight
+func (t *relayTracker) depth() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.inFlight)
+}
+
+// snapshot returns a copy of the current state
+func (t *relayTracker) snapshot() RelayState {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	state := RelayState{
+		InFlight:   []RelayDelivery{},
+		Workspaces: map[string]WorkspaceRelayStatus{},
+	}
+	for _, d := range t.inFlight {
+		state.InFlight = append(state.InFlight, *d)
+	}
+	sort.Slice(state.InFlight, func(i, j int) bool {
+		return state.InFlight[i].ID < state.InFlight[j].ID
+	})
+	for name, status := range t.workspaces {
+		state.Workspaces[name] = *status
+	}
+	return state
+}
@@ -0,0 +1,43 @@
+package hook
+
+import (
+	"time"
+
+	"github.com/cenkalti/backoff"
+)
+
+// retryAfterBackOff waits at least as long as the workspace asked via Retry-After before the next attempt
+type retryAfterBackOff struct {
+	backoff.BackOff
+	// max the longest delay a workspace can ask for
+	max  time.Duration
+	next time.Duration
+}
+
+func newRetryAfterBackOff(base backoff.BackOff, max time.Duration) *retryAfterBackOff {
+	return &retryAfterBackOff{
+		BackOff: base,
+		max:     max,
+	}
+}
+
+// retryAfter records the delay the workspace asked for before the next attempt
+func (b *retryAfterBackOff) retryAfter(d time.Duration) {
+	if d > b.max {
+		d = b.max
+	}
+	b.next = d
+}
+
+// NextBackOff returns the longer of the exponential backoff and the delay the workspace asked for
+func (b *retryAfterBackOff) NextBackOff() time.Duration {
+	d := b.BackOff.NextBackOff()
+	if d == backoff.Stop {
+		return d
+	}
+	if b.next > d {
+		d = b.next
+	}
+	b.next = 0
+	return d
+}
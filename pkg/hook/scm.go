@@ -4,7 +4,8 @@ import (
 	"net/http"
 
 	"github.com/bradleyfalzon/ghinstallation"
-	"github.com/cloudbees/lighthouse-githubapp/pkg/flags"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
 	"github.com/jenkins-x/go-scm/scm"
 	"github.com/jenkins-x/go-scm/scm/factory"
 	"github.com/jenkins-x/go-scm/scm/transport"
@@ -16,7 +17,8 @@ type Scm struct{}
 
 func defaultScmTransport(scmClient *scm.Client) {
 	if scmClient.Client == nil {
-		scmClient.Client = http.DefaultClient
+		// use a new client rather than http.DefaultClient as we replace the transport
+		scmClient.Client = &http.Client{}
 	}
 	if scmClient.Client.Transport == nil {
 		scmClient.Client.Transport = http.DefaultTransport
@@ -24,10 +26,10 @@ func defaultScmTransport(scmClient *scm.Client) {
 }
 
 func (o *HookOptions) createSCMClient(token string) (*scm.Client, string, string, error) {
-	kind := flags.GitKind.Value()
-	serverURL := flags.GitServer.Value()
+	kind := o.config.GitKind
+	serverURL := o.config.GitServer
 	if token == "" {
-		token = flags.GitToken.Value()
+		token = o.config.GitToken
 	}
 	client, err := factory.NewClient(kind, serverURL, "")
 	if err != nil {
@@ -50,20 +52,20 @@ func (o *HookOptions) createSCMClient(token string) (*scm.Client, string, string
 }
 
 // creates a client for using go-scm using the App's ID and private key
-func createAppsScmClient() (*scm.Client, int, error) {
+func createAppsScmClient(cfg *config.Config) (*scm.Client, int, error) {
 	logrus.Debugf("createAppsScmClient")
-	privateKeyFile := flags.AppPrivateKeyFile.Value()
+	privateKeyFile := cfg.AppPrivateKeyFile
 	if privateKeyFile == "" {
 		logrus.Errorf("missing private key file environment variable LHA_PRIVATE_KEY_FILE")
 		return nil, 0, errors.New("Missing Github APP Private key")
 	}
-	appID := flags.GitHubAppID.Value()
+	appID := cfg.GitHubAppID
 	if appID == 0 {
 		logrus.Errorf("missing environment variable LHA_APP_ID")
 		return nil, 0, errors.New("Missing Github APP ID")
 	}
-	kind := flags.GitKind.Value()
-	serverURL := flags.GitServer.Value()
+	kind := cfg.GitKind
+	serverURL := cfg.GitServer
 	scmClient, err := factory.NewClient(kind, serverURL, "")
 	if err != nil {
 		logrus.Errorf("failed to create scm apps client %v", err)
@@ -72,15 +74,23 @@ func createAppsScmClient() (*scm.Client, int, error) {
 
 	// add Apps installation token
 	defaultScmTransport(scmClient)
-	if err != nil {
-		return nil, appID, errors.Wrapf(err, "failed to create SCM transport")
-	}
 	logrus.Infof("using GitHub App ID %d", appID)
-	tr, err := ghinstallation.NewAppsTransportKeyFromFile(scmClient.Client.Transport, appID, privateKeyFile)
+	base := metrics.NewRateLimitTransport(scmClient.Client.Transport, metrics.AppInstallation)
+	tr, err := newAppsTransport(base, appID, privateKeyFile)
 	if err != nil {
-		logrus.Errorf("failed to create transport %v", err)
-		return nil, appID, errors.Wrapf(err, "failed to create the Apps transport for AppID %v and file %s", appID, privateKeyFile)
+		return nil, appID, err
 	}
 	scmClient.Client.Transport = tr
 	return scmClient, appID, err
 }
+
+// newAppsTransport creates the transport which authenticates each request as the App with a JWT signed by its
+// private key
+func newAppsTransport(base http.RoundTripper, appID int, privateKeyFile string) (http.RoundTripper, error) {
+	tr, err := ghinstallation.NewAppsTransportKeyFromFile(base, appID, privateKeyFile)
+	if err != nil {
+		logrus.Errorf("failed to create transport %v", err)
+		return nil, errors.Wrapf(err, "failed to create the Apps transport for AppID %v and file %s", appID, privateKeyFile)
+	}
+	return tr, nil
+}
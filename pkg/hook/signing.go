@@ -0,0 +1,21 @@
+package hook
+
+import (
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/config"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/signing"
+)
+
+// newSigningKeys creates the keys which sign the relayed webhooks asymmetrically or returns nil if neither a signing
+// algorithm nor a key directory is configured
+func newSigningKeys(cfg *config.Config) (*signing.KeySet, error) {
+	if cfg.RelaySigningAlgorithm == "" && cfg.RelaySigningKeyDir == "" {
+		return nil, nil
+	}
+	return signing.NewKeySet(signing.Options{
+		Algorithm:        cfg.RelaySigningAlgorithm,
+		RotationInterval: time.Duration(cfg.RelaySigningKeyRotation) * time.Second,
+		KeyDir:           cfg.RelaySigningKeyDir,
+	})
+}
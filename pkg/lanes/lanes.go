@@ -0,0 +1,182 @@
+package lanes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/pkg/errors"
+)
+
+const (
+	// High the lane of the interactive events such as ChatOps comments and pull request actions
+	High = "high"
+	// Low the lane of the bulk events such as pushes, statuses and check runs
+	Low = "low"
+)
+
+// DefaultHighPriorityEvents the event types relayed in the high priority lane unless configured otherwise
+var DefaultHighPriorityEvents = []string{
+	"issue_comment",
+	"pull_request",
+	"pull_request_review",
+	"pull_request_review_comment",
+}
+
+// Options the options of the lanes
+type Options struct {
+	// HighWorkers the number of webhooks relayed concurrently in the high priority lane, 0 is unlimited
+	HighWorkers int
+	// LowWorkers the number of webhooks relayed concurrently in the low priority lane, 0 is unlimited
+	LowWorkers int
+	// HighPriorityEvents the event types relayed in the high priority lane, any other event is relayed in the low
+	// priority lane
+	HighPriorityEvents []string
+}
+
+// Status the state of a lane, Workers is 0 when the lane is unlimited
+type Status struct {
+	Name     string `json:"name"`
+	Workers  int    `json:"workers"`
+	InFlight int    `json:"inFlight"`
+	Waiting  int    `json:"waiting"`
+	Admitted int64  `json:"admitted"`
+}
+
+// Lanes limits the number of webhooks relayed concurrently with a separate worker budget per priority so that a
+// storm of bulk events such as a monorepo push cannot delay interactive events such as a /retest comment. A lane
+// without workers admits every webhook immediately and only tracks it.
+type Lanes struct {
+	high  map[string]bool
+	lock  sync.Mutex
+	lanes map[string]*lane
+}
+
+type lane struct {
+	name     string
+	workers  int
+	slots    chan struct{}
+	inFlight int
+	waiting  int
+	admitted int64
+}
+
+// New creates new lanes
+func New(options Options) *Lanes {
+	if len(options.HighPriorityEvents) == 0 {
+		options.HighPriorityEvents = DefaultHighPriorityEvents
+	}
+	high := map[string]bool{}
+	for _, event := range options.HighPriorityEvents {
+		high[event] = true
+	}
+	return &Lanes{
+		high: high,
+		lanes: map[string]*lane{
+			High: newLane(High, options.HighWorkers),
+			Low:  newLane(Low, options.LowWorkers),
+		},
+	}
+}
+
+func newLane(name string, workers int) *lane {
+	if workers <= 0 {
+		return &lane{name: name}
+	}
+	return &lane{
+		name:    name,
+		workers: workers,
+		slots:   make(chan struct{}, workers),
+	}
+}
+
+// wait waits for a free worker, an unlimited lane has no slots and always has one
+func (l *lane) wait(ctx context.Context) error {
+	if l.slots == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// free frees the worker taken by wait
+func (l *lane) free() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// Classify returns the lane the event type is relayed in
+func (l *Lanes) Classify(eventType string) string {
+	if l.high[eventType] {
+		return High
+	}
+	return Low
+}
+
+// Acquire waits for a worker of the lane of the event type to be free. The returned function must be invoked to
+// release the worker once the webhook is relayed.
+func (l *Lanes) Acquire(ctx context.Context, eventType string) (func(), error) {
+	lane := l.lanes[l.Classify(eventType)]
+	metrics.LaneEvents.WithLabelValues(lane.name).Inc()
+
+	start := time.Now()
+	l.update(lane, func() {
+		lane.waiting++
+	})
+	err := lane.wait(ctx)
+	if err != nil {
+		l.update(lane, func() {
+			lane.waiting--
+		})
+		return nil, errors.Wrapf(err, "timed out waiting for a worker in the %s priority lane", lane.name)
+	}
+	metrics.LaneWaitDuration.WithLabelValues(lane.name).Observe(time.Since(start).Seconds())
+	l.update(lane, func() {
+		lane.waiting--
+		lane.inFlight++
+		lane.admitted++
+	})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			lane.free()
+			l.update(lane, func() {
+				lane.inFlight--
+			})
+		})
+	}, nil
+}
+
+// Snapshot returns the state of each lane, the high priority lane first
+func (l *Lanes) Snapshot() []Status {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	answer := []Status{}
+	for _, name := range []string{High, Low} {
+		lane := l.lanes[name]
+		answer = append(answer, Status{
+			Name:     lane.name,
+			Workers:  lane.workers,
+			InFlight: lane.inFlight,
+			Waiting:  lane.waiting,
+			Admitted: lane.admitted,
+		})
+	}
+	return answer
+}
+
+// update changes the state of the lane and updates its metrics
+func (l *Lanes) update(lane *lane, fn func()) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	fn()
+	metrics.LaneWaiting.WithLabelValues(lane.name).Set(float64(lane.waiting))
+	metrics.LaneInFlight.WithLabelValues(lane.name).Set(float64(lane.inFlight))
+}
@@ -0,0 +1,105 @@
+package lanes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	l := New(Options{})
+	assert.Equal(t, High, l.Classify("issue_comment"))
+	assert.Equal(t, High, l.Classify("pull_request_review"))
+	assert.Equal(t, High, l.Classify("pull_request"))
+	assert.Equal(t, Low, l.Classify("push"))
+	assert.Equal(t, Low, l.Classify("status"))
+	assert.Equal(t, Low, l.Classify("check_run"))
+
+	l = New(Options{HighPriorityEvents: []string{"push"}})
+	assert.Equal(t, High, l.Classify("push"))
+	assert.Equal(t, Low, l.Classify("issue_comment"))
+}
+
+func TestBulkEventsDoNotBlockHighPriorityEvents(t *testing.T) {
+	t.Parallel()
+
+	l := New(Options{HighWorkers: 1, LowWorkers: 1})
+	ctx := context.Background()
+
+	releasePush, err := l.Acquire(ctx, "push")
+	require.NoError(t, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		release, err := l.Acquire(ctx, "status")
+		if assert.NoError(t, err) {
+			release()
+		}
+		close(acquired)
+	}()
+
+	releaseComment, err := l.Acquire(ctx, "issue_comment")
+	require.NoError(t, err, "a comment should not wait for the bulk lane")
+	releaseComment()
+
+	select {
+	case <-acquired:
+		t.Fatal("the status should wait for a worker in the low priority lane")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Eventually(t, func() bool {
+		return l.Snapshot()[1].Waiting == 1
+	}, time.Second, 10*time.Millisecond)
+
+	releasePush()
+	releasePush()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("the status should be relayed once the push is")
+	}
+
+	statuses := l.Snapshot()
+	require.Len(t, statuses, 2)
+	assert.Equal(t, Status{Name: High, Workers: 1, Admitted: 1}, statuses[0])
+	assert.Equal(t, Status{Name: Low, Workers: 1, Admitted: 2}, statuses[1])
+}
+
+func TestAcquireCancelled(t *testing.T) {
+	t.Parallel()
+
+	l := New(Options{LowWorkers: 1})
+	release, err := l.Acquire(context.Background(), "push")
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Acquire(ctx, "push")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "low priority lane")
+	assert.Zero(t, l.Snapshot()[1].Waiting)
+}
+
+func TestUnlimitedLanes(t *testing.T) {
+	t.Parallel()
+
+	l := New(Options{})
+	var releases []func()
+	for i := 0; i < 50; i++ {
+		release, err := l.Acquire(context.Background(), "push")
+		require.NoError(t, err)
+		releases = append(releases, release)
+	}
+	assert.Equal(t, Status{Name: Low, InFlight: 50, Admitted: 50}, l.Snapshot()[1])
+
+	for _, release := range releases {
+		release()
+	}
+	assert.Equal(t, Status{Name: Low, Admitted: 50}, l.Snapshot()[1])
+}
@@ -0,0 +1,363 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "lighthouse_githubapp"
+
+	// OutcomeSuccess the outcome label value for a successful relay
+	OutcomeSuccess = "success"
+	// OutcomeFailure the outcome label value for a relay which failed after all retries
+	OutcomeFailure = "failure"
+	// OutcomeDryRun the outcome label value for a webhook which was routed to a workspace but not relayed due to dry-run mode
+	OutcomeDryRun = "dry_run"
+
+	// OperationFindWorkspaces the operation label value for workspace lookups
+	OperationFindWorkspaces = "find_workspaces"
+	// OperationRelay the operation label value for webhook relays
+	OperationRelay = "relay"
+
+	// PullOutcomeQueued the outcome label value for an event queued for a workspace which pulls its events
+	PullOutcomeQueued = "queued"
+	// PullOutcomeRejected the outcome label value for an event rejected as the queue of the workspace is full
+	PullOutcomeRejected = "rejected"
+	// PullOutcomeDelivered the outcome label value for an event received by a workspace
+	PullOutcomeDelivered = "delivered"
+	// PullOutcomeAcked the outcome label value for an event acknowledged by a workspace
+	PullOutcomeAcked = "acked"
+	// PullOutcomeRedelivered the outcome label value for an event which was not acknowledged in time
+	PullOutcomeRedelivered = "redelivered"
+	// PullOutcomeExpired the outcome label value for an event dropped as it was queued for too long
+	PullOutcomeExpired = "expired"
+
+	// PendingOutcomeParked the outcome label value for an event parked as no workspace is interested in its repository yet
+	PendingOutcomeParked = "parked"
+	// PendingOutcomeRejected the outcome label value for an event dropped as its repository has too many events parked
+	PendingOutcomeRejected = "rejected"
+	// PendingOutcomeDelivered the outcome label value for a parked event relayed once its repository was routable
+	PendingOutcomeDelivered = "delivered"
+	// PendingOutcomeFailed the outcome label value for a parked event which could not be relayed to some of the
+	// workspaces once its repository was routable
+	PendingOutcomeFailed = "failed"
+	// PendingOutcomeExpired the outcome label value for a parked event dropped as its repository was not routable in time
+	PendingOutcomeExpired = "expired"
+	// PendingOutcomeEvicted the outcome label value for a parked event dropped to make room as too many events are parked
+	PendingOutcomeEvicted = "evicted"
+
+	// MirrorOutcomeSuccess the outcome label value for a webhook mirrored to a canary Lighthouse
+	MirrorOutcomeSuccess = "success"
+	// MirrorOutcomeFailure the outcome label value for a webhook which could not be mirrored to a canary Lighthouse
+	MirrorOutcomeFailure = "failure"
+	// MirrorOutcomeDropped the outcome label value for a webhook not mirrored as too many mirrored deliveries were in flight
+	MirrorOutcomeDropped = "dropped"
+
+	// BotOutcomeDropped the outcome label value for a webhook sent by the bot of the App which was dropped
+	BotOutcomeDropped = "dropped"
+	// BotOutcomeMarked the outcome label value for a webhook sent by the bot of the App which was relayed with a header
+	BotOutcomeMarked = "marked"
+	// BotOutcomeAllowed the outcome label value for a webhook sent by the bot of the App which was relayed as it is allowed
+	BotOutcomeAllowed = "allowed"
+
+	// DebounceOutcomeHeld the outcome label value for a webhook held until its coalescing window ends
+	DebounceOutcomeHeld = "held"
+	// DebounceOutcomeSuperseded the outcome label value for a webhook which superseded a held webhook
+	DebounceOutcomeSuperseded = "superseded"
+	// DebounceOutcomeCommand the outcome label value for a webhook which was not coalesced as it carries commands
+	DebounceOutcomeCommand = "command"
+
+	// AppInstallation the installation label value used for calls authenticated as the App itself
+	AppInstallation = "app"
+)
+
+var (
+	// WebhooksReceived counts the webhooks received from GitHub
+	WebhooksReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhooks_received_total",
+		Help:      "The number of webhooks received by event, action and installation.",
+	}, []string{"event", "action", "installation"})
+
+	// SignatureFailures counts the webhooks rejected due to an invalid signature
+	SignatureFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_signature_failures_total",
+		Help:      "The number of webhooks rejected because their signature could not be verified.",
+	})
+
+	// FindWorkspacesDuration observes the latency of looking up the workspaces for a repository
+	FindWorkspacesDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "find_workspaces_duration_seconds",
+		Help:      "The latency of looking up the workspaces interested in a repository.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// FindWorkspacesErrors counts the failed workspace lookups
+	FindWorkspacesErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "find_workspaces_errors_total",
+		Help:      "The number of workspace lookups which returned an error.",
+	})
+
+	// RelayAttempts counts each attempt to relay a webhook to a workspace
+	RelayAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_attempts_total",
+		Help:      "The number of attempts to relay a webhook by workspace.",
+	}, []string{"workspace"})
+
+	// RelayOutcomes counts the final outcome of relaying a webhook to a workspace
+	RelayOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_outcomes_total",
+		Help:      "The number of relayed webhooks by workspace and final outcome.",
+	}, []string{"workspace", "outcome"})
+
+	// RelayDuration observes the latency of each attempt to relay a webhook to a workspace
+	RelayDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_duration_seconds",
+		Help:      "The latency of each attempt to relay a webhook by workspace.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"workspace"})
+
+	// RelayEndpointDeliveries counts the webhooks delivered to a workspace by the role of the endpoint which handled them
+	RelayEndpointDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_endpoint_deliveries_total",
+		Help:      "The number of webhooks delivered to a workspace by the role of the endpoint which handled them.",
+	}, []string{"workspace", "endpoint"})
+
+	// RelayEndpointHealthy whether each Lighthouse endpoint is considered healthy
+	RelayEndpointHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "relay_endpoint_healthy",
+		Help:      "Whether a Lighthouse endpoint is healthy (1) or deliveries fail over to another endpoint (0).",
+	}, []string{"url"})
+
+	// BackoffRetries counts the retries scheduled by the exponential backoff
+	BackoffRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backoff_retries_total",
+		Help:      "The number of retries scheduled by the exponential backoff by operation.",
+	}, []string{"operation"})
+
+	// GitHubRateLimitRemaining the last seen remaining GitHub API rate limit
+	GitHubRateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "github_rate_limit_remaining",
+		Help:      "The remaining GitHub API rate limit for the App or an installation.",
+	}, []string{"installation"})
+
+	// PullQueueDepth the number of events queued or in flight for each workspace which pulls its events
+	PullQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pull_queue_depth",
+		Help:      "The number of events queued or in flight for a workspace which pulls its events.",
+	}, []string{"workspace"})
+
+	// PullEvents counts the events of the workspaces which pull their events by outcome
+	PullEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pull_events_total",
+		Help:      "The number of events of workspaces which pull their events by workspace and outcome.",
+	}, []string{"workspace", "outcome"})
+
+	// PendingDepth the number of events parked until a workspace is interested in their repository
+	PendingDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_depth",
+		Help:      "The number of events parked until a workspace is interested in their repository.",
+	})
+
+	// PendingEvents counts the parked events by outcome
+	PendingEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pending_events_total",
+		Help:      "The number of events parked until a workspace is interested in their repository by outcome.",
+	}, []string{"outcome"})
+
+	// MirrorDeliveries counts the webhooks mirrored to canary Lighthouses by mirror and outcome
+	MirrorDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mirror_deliveries_total",
+		Help:      "The number of webhooks mirrored to a canary Lighthouse by mirror and outcome.",
+	}, []string{"mirror", "outcome"})
+
+	// MirrorDuration observes the latency of the deliveries to canary Lighthouses
+	MirrorDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mirror_duration_seconds",
+		Help:      "The latency of each webhook mirrored to a canary Lighthouse by mirror.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"mirror"})
+
+	// BotEvents counts the webhooks sent by the bot of the App by event type and outcome
+	BotEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bot_events_total",
+		Help:      "The number of webhooks sent by the bot of the GitHub App by event type and outcome.",
+	}, []string{"event", "outcome"})
+
+	// DebounceEvents counts the webhooks which are coalesced by event type and outcome
+	DebounceEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "debounce_events_total",
+		Help:      "The number of webhooks which are coalesced by event type and outcome.",
+	}, []string{"event", "outcome"})
+
+	// DebouncePending the number of webhooks held until their coalescing window ends
+	DebouncePending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "debounce_pending",
+		Help:      "The number of webhooks held until their coalescing window ends.",
+	})
+
+	// LaneEvents counts the webhooks relayed in each priority lane
+	LaneEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lane_events_total",
+		Help:      "The number of webhooks relayed in each priority lane.",
+	}, []string{"lane"})
+
+	// LaneInFlight the number of webhooks being relayed in each priority lane
+	LaneInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "lane_in_flight",
+		Help:      "The number of webhooks being relayed in each priority lane.",
+	}, []string{"lane"})
+
+	// LaneWaiting the number of webhooks waiting for a worker in each priority lane
+	LaneWaiting = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "lane_waiting",
+		Help:      "The number of webhooks waiting for a worker in each priority lane.",
+	}, []string{"lane"})
+
+	// LaneWaitDuration observes how long webhooks wait for a worker in each priority lane
+	LaneWaitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "lane_wait_duration_seconds",
+		Help:      "How long webhooks wait for a worker in each priority lane before they are relayed.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"lane"})
+
+	// InstallationThrottled counts the webhooks which waited as their installation was over its limits
+	InstallationThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "installation_throttled_total",
+		Help:      "The number of webhooks which waited as their installation was over its ingestion or relay limits.",
+	}, []string{"installation", "stage"})
+
+	// InstallationThrottleDuration observes how long webhooks waited as their installation was over its limits
+	InstallationThrottleDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "installation_throttle_duration_seconds",
+		Help:      "How long webhooks waited as their installation was over its ingestion or relay rate limit.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"stage"})
+
+	// InstallationWaiting the number of webhooks of each installation waiting as it is over its limits
+	InstallationWaiting = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "installation_waiting",
+		Help:      "The number of webhooks of an installation waiting as it is over its limits.",
+	}, []string{"installation"})
+
+	// InstallationRelaysInFlight the number of webhooks of each installation being relayed
+	InstallationRelaysInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "installation_relays_in_flight",
+		Help:      "The number of webhooks of an installation being relayed.",
+	}, []string{"installation"})
+
+	// RelayClientCertificateExpiry the expiry time of each client certificate used to relay webhooks
+	RelayClientCertificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "relay_client_certificate_expiry_timestamp_seconds",
+		Help:      "The time at which the client certificate used to relay webhooks expires, in seconds since the epoch.",
+	}, []string{"certificate"})
+
+	// RelayClientCertificateReloads counts the reloads of the client certificates after their files changed
+	RelayClientCertificateReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_client_certificate_reloads_total",
+		Help:      "The number of times a client certificate used to relay webhooks was reloaded by outcome.",
+	}, []string{"certificate", "outcome"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		WebhooksReceived,
+		SignatureFailures,
+		FindWorkspacesDuration,
+		FindWorkspacesErrors,
+		RelayAttempts,
+		RelayOutcomes,
+		RelayDuration,
+		RelayEndpointDeliveries,
+		RelayEndpointHealthy,
+		BackoffRetries,
+		GitHubRateLimitRemaining,
+		RelayClientCertificateExpiry,
+		RelayClientCertificateReloads,
+		PullQueueDepth,
+		PullEvents,
+		PendingDepth,
+		PendingEvents,
+		MirrorDeliveries,
+		MirrorDuration,
+		BotEvents,
+		DebounceEvents,
+		DebouncePending,
+		LaneEvents,
+		LaneInFlight,
+		LaneWaiting,
+		LaneWaitDuration,
+		InstallationThrottled,
+		InstallationThrottleDuration,
+		InstallationWaiting,
+		InstallationRelaysInFlight,
+	)
+}
+
+// Handler returns the HTTP handler which exposes the metrics to Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RateLimitTransport records the GitHub API rate limit remaining reported on each response
+type RateLimitTransport struct {
+	Base         http.RoundTripper
+	Installation string
+}
+
+// NewRateLimitTransport creates a new transport recording the rate limit for the given installation
+func NewRateLimitTransport(base http.RoundTripper, installation string) *RateLimitTransport {
+	return &RateLimitTransport{
+		Base:         base,
+		Installation: installation,
+	}
+}
+
+// RoundTrip invokes the base transport then records the rate limit header if present
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	text := resp.Header.Get("X-RateLimit-Remaining")
+	if text != "" {
+		remaining, err := strconv.Atoi(text)
+		if err == nil {
+			GitHubRateLimitRemaining.WithLabelValues(t.Installation).Set(float64(remaining))
+		}
+	}
+	return resp, nil
+}
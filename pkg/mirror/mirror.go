@@ -0,0 +1,276 @@
+package mirror
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hmac"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultTimeout the timeout of each mirrored delivery
+	DefaultTimeout = 10 * time.Second
+	// DefaultMaxInFlight the maximum number of mirrored deliveries in flight after which webhooks are not mirrored
+	DefaultMaxInFlight = 50
+
+	// HeaderMirror the header which names the mirror on mirrored deliveries
+	HeaderMirror = "X-Lighthouse-Mirror"
+)
+
+// Rule mirrors the matching webhooks to a canary Lighthouse
+type Rule struct {
+	// Name identifies the mirror in metrics and logs
+	Name string
+	// URL the URL of the canary Lighthouse whose scheme selects the sink
+	URL string
+	// Secret the HMAC token of the canary Lighthouse used to sign the mirrored deliveries
+	Secret []byte
+	// TLS the TLS settings used to connect to the canary Lighthouse
+	TLS relay.TLSProfile
+	// Installations only mirrors webhooks of these installations if not empty
+	Installations []int64
+	// Repositories only mirrors webhooks of repositories whose full name matches one of these patterns if not empty
+	Repositories []string
+	// Events only mirrors webhooks of these event types if not empty
+	Events []string
+	// Percentage the percentage of the matching webhooks which are mirrored from 0 for none to 100 for all
+	Percentage int
+}
+
+// Matches returns true if the webhook should be mirrored. Sampling uses the delivery ID so a webhook is either
+// mirrored every time it is received or not at all.
+func (r *Rule) Matches(event *relay.Event, fullName string) bool {
+	if len(r.Installations) > 0 && !containsInt64(r.Installations, event.Installation) {
+		return false
+	}
+	if len(r.Events) > 0 && !containsString(r.Events, event.Type) {
+		return false
+	}
+	if len(r.Repositories) > 0 && !matchesAny(r.Repositories, fullName) {
+		return false
+	}
+	if r.Percentage <= 0 {
+		return false
+	}
+	if r.Percentage >= 100 {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(r.Name + "/" + event.Delivery))
+	return int(h.Sum32()%100) < r.Percentage
+}
+
+// Options the options of the mirror
+type Options struct {
+	// Timeout the timeout of each mirrored delivery
+	Timeout time.Duration
+	// MaxInFlight the maximum number of mirrored deliveries in flight
+	MaxInFlight int
+	// Version the version of the relay sent to the canary Lighthouses
+	Version string
+}
+
+// Status the outcomes of the deliveries to a mirror
+type Status struct {
+	Name        string     `json:"name"`
+	URL         string     `json:"url"`
+	Delivered   int        `json:"delivered"`
+	Failed      int        `json:"failed"`
+	Dropped     int        `json:"dropped"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastAttempt *time.Time `json:"lastAttempt,omitempty"`
+}
+
+// Mirror mirrors webhooks to canary Lighthouses without affecting their delivery to the workspaces. Mirrored
+// deliveries are sent in the background, are not retried and are dropped if too many are in flight.
+type Mirror struct {
+	rules    []Rule
+	sinks    *relay.Sinks
+	options  Options
+	inFlight chan struct{}
+	wg       sync.WaitGroup
+	lock     sync.Mutex
+	statuses map[string]*Status
+}
+
+// New creates a new mirror for the rules delivering via the sinks
+func New(rules []Rule, sinks *relay.Sinks, options Options) *Mirror {
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+	if options.MaxInFlight <= 0 {
+		options.MaxInFlight = DefaultMaxInFlight
+	}
+	statuses := map[string]*Status{}
+	for _, rule := range rules {
+		statuses[rule.Name] = &Status{Name: rule.Name, URL: rule.URL}
+	}
+	return &Mirror{
+		rules:    rules,
+		sinks:    sinks,
+		options:  options,
+		inFlight: make(chan struct{}, options.MaxInFlight),
+		statuses: statuses,
+	}
+}
+
+// Mirror sends the webhook to each mirror whose rule matches in the background
+func (m *Mirror) Mirror(event *relay.Event, fullName string) {
+	for i := range m.rules {
+		rule := &m.rules[i]
+		if !rule.Matches(event, fullName) {
+			continue
+		}
+		select {
+		case m.inFlight <- struct{}{}:
+		default:
+			m.record(rule, metrics.MirrorOutcomeDropped, nil)
+			continue
+		}
+		m.wg.Add(1)
+		go func() {
+			defer func() {
+				<-m.inFlight
+				m.wg.Done()
+			}()
+			m.deliver(rule, event)
+		}()
+	}
+}
+
+// Wait waits for the mirrored deliveries in flight to complete
+func (m *Mirror) Wait() {
+	m.wg.Wait()
+}
+
+// Snapshot returns the outcomes of the deliveries to each mirror sorted by name
+func (m *Mirror) Snapshot() []Status {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	answer := make([]Status, 0, len(m.statuses))
+	for _, status := range m.statuses {
+		answer = append(answer, *status)
+	}
+	sort.Slice(answer, func(i, j int) bool {
+		return answer[i].Name < answer[j].Name
+	})
+	return answer
+}
+
+// deliver signs the webhook with the secret of the mirror and delivers it once
+func (m *Mirror) deliver(rule *Rule, webhook *relay.Event) {
+	log := logrus.WithFields(map[string]interface{}{
+		"Mirror":   rule.Name,
+		"URL":      rule.URL,
+		"Delivery": webhook.Delivery,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), m.options.Timeout)
+	defer cancel()
+
+	event := *webhook
+	event.Headers = http.Header{}
+	event.Headers.Set("X-GitHub-Event", webhook.Type)
+	event.Headers.Set("X-GitHub-Delivery", webhook.Delivery)
+	g, err := hmac.NewGenerator("sha256", rule.Secret)
+	if err != nil {
+		m.record(rule, metrics.MirrorOutcomeFailure, err)
+		return
+	}
+	signature := g.HubSignature(webhook.Body)
+	event.Headers.Set("X-Hub-Signature", signature)
+	event.Headers.Set(relay.HeaderSignature256, signature)
+	webhook.SetRelayHeaders(event.Headers, m.options.Version)
+	event.Headers.Set(HeaderMirror, rule.Name)
+
+	start := time.Now()
+	err = m.send(ctx, rule, &event)
+	metrics.MirrorDuration.WithLabelValues(rule.Name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		log.WithError(err).Debug("failed to mirror webhook")
+		m.record(rule, metrics.MirrorOutcomeFailure, err)
+		return
+	}
+	log.Debug("mirrored webhook")
+	m.record(rule, metrics.MirrorOutcomeSuccess, nil)
+}
+
+func (m *Mirror) send(ctx context.Context, rule *Rule, event *relay.Event) error {
+	sink, err := m.sinks.For(rule.URL)
+	if err != nil {
+		return err
+	}
+	target := &relay.Target{
+		Workspace: rule.Name,
+		URL:       rule.URL,
+		TLS:       rule.TLS,
+	}
+	result, err := sink.Deliver(ctx, event, target)
+	if err != nil {
+		return err
+	}
+	decision := relay.Decide(rule.URL, result, time.Now())
+	if !decision.Delivered {
+		return decision.Err
+	}
+	return nil
+}
+
+// record records the outcome of a delivery to the mirror
+func (m *Mirror) record(rule *Rule, outcome string, err error) {
+	metrics.MirrorDeliveries.WithLabelValues(rule.Name, outcome).Inc()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	status := m.statuses[rule.Name]
+	switch outcome {
+	case metrics.MirrorOutcomeSuccess:
+		status.Delivered++
+	case metrics.MirrorOutcomeFailure:
+		status.Failed++
+		status.LastError = err.Error()
+	case metrics.MirrorOutcomeDropped:
+		status.Dropped++
+		return
+	}
+	now := time.Now()
+	status.LastAttempt = &now
+}
+
+func containsInt64(values []int64, value int64) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny returns true if the full name of the repository matches one of the patterns such as myorg/*
+func matchesAny(patterns []string, fullName string) bool {
+	fullName = strings.ToLower(fullName)
+	for _, pattern := range patterns {
+		matched, err := path.Match(strings.ToLower(pattern), fullName)
+		if err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
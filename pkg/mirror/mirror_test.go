@@ -0,0 +1,134 @@
+package mirror
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hmac"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/relay"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent(delivery string) *relay.Event {
+	return &relay.Event{
+		Type:         "push",
+		Delivery:     delivery,
+		Source:       "https://github.com/cloudbees/lighthouse-githubapp",
+		Installation: 1234,
+		Body:         []byte(`{"ref":"refs/heads/main"}`),
+	}
+}
+
+func testSinks(server *httptest.Server) *relay.Sinks {
+	sinks := relay.NewSinks()
+	sinks.Register("http", &relay.HTTPSink{Client: server.Client()})
+	return sinks
+}
+
+func TestRuleMatches(t *testing.T) {
+	t.Parallel()
+
+	event := testEvent("f2467dea-70d6-11e8-8955-3c83993e0aef")
+	tests := []struct {
+		name    string
+		rule    Rule
+		matches bool
+	}{
+		{name: "no filters", rule: Rule{Percentage: 100}, matches: true},
+		{name: "installation", rule: Rule{Installations: []int64{1, 1234}, Percentage: 100}, matches: true},
+		{name: "other installation", rule: Rule{Installations: []int64{1}, Percentage: 100}},
+		{name: "repository pattern", rule: Rule{Repositories: []string{"CloudBees/*"}, Percentage: 100}, matches: true},
+		{name: "other repository", rule: Rule{Repositories: []string{"jenkins-x/*"}, Percentage: 100}},
+		{name: "event", rule: Rule{Events: []string{"pull_request", "push"}, Percentage: 100}, matches: true},
+		{name: "other event", rule: Rule{Events: []string{"pull_request"}, Percentage: 100}},
+		{name: "none sampled", rule: Rule{}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.matches, tc.rule.Matches(event, "cloudbees/lighthouse-githubapp"))
+		})
+	}
+
+	rule := Rule{Name: "canary", Percentage: 10}
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		e := testEvent(fmt.Sprintf("delivery-%d", i))
+		if rule.Matches(e, "cloudbees/lighthouse-githubapp") {
+			sampled++
+			assert.True(t, rule.Matches(e, "cloudbees/lighthouse-githubapp"), "sampling should be stable for a delivery")
+		}
+	}
+	assert.InDelta(t, 100, sampled, 40)
+}
+
+func TestMirrorResignsWithCanarySecret(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("canary-secret")
+	received := make(chan *http.Request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+		g, err := hmac.NewGenerator("sha256", secret)
+		assert.NoError(t, err)
+		assert.Equal(t, g.HubSignature(body), req.Header.Get("X-Hub-Signature"))
+		received <- req
+		if req.Header.Get("X-GitHub-Event") == "pull_request" {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	m := New([]Rule{
+		{Name: "canary", URL: server.URL, Secret: secret, Percentage: 100},
+		{Name: "ignored", URL: server.URL, Secret: secret, Events: []string{"issues"}, Percentage: 100},
+	}, testSinks(server), Options{})
+
+	event := testEvent("delivery-1")
+	event.Headers = http.Header{"X-Hub-Signature": []string{"sha256=primary"}}
+	m.Mirror(event, "cloudbees/lighthouse-githubapp")
+	failing := testEvent("delivery-2")
+	failing.Type = "pull_request"
+	m.Mirror(failing, "cloudbees/lighthouse-githubapp")
+	m.Wait()
+
+	require.Len(t, received, 2)
+	req := <-received
+	assert.Equal(t, "canary", req.Header.Get(HeaderMirror))
+	assert.Equal(t, []string{"sha256=primary"}, event.Headers["X-Hub-Signature"], "the primary event should not be modified")
+
+	statuses := m.Snapshot()
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "canary", statuses[0].Name)
+	assert.Equal(t, 1, statuses[0].Delivered)
+	assert.Equal(t, 1, statuses[0].Failed)
+	assert.Contains(t, statuses[0].LastError, "500")
+	assert.Equal(t, "ignored", statuses[1].Name)
+	assert.Nil(t, statuses[1].LastAttempt)
+}
+
+func TestMirrorDropsWhenTooManyInFlight(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	m := New([]Rule{{Name: "canary", URL: server.URL, Secret: []byte("s"), Percentage: 100}}, testSinks(server), Options{MaxInFlight: 1})
+	m.Mirror(testEvent("delivery-1"), "cloudbees/lighthouse-githubapp")
+	m.Mirror(testEvent("delivery-2"), "cloudbees/lighthouse-githubapp")
+	close(release)
+	m.Wait()
+
+	statuses := m.Snapshot()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, 1, statuses[0].Delivered)
+	assert.Equal(t, 1, statuses[0].Dropped)
+}
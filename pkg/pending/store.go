@@ -0,0 +1,242 @@
+package pending
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultTTL how long an event is parked waiting for its repository to be configured in a workspace
+	DefaultTTL = time.Hour
+	// DefaultMaxPerRepository the maximum number of events parked for a repository
+	DefaultMaxPerRepository = 100
+	// DefaultMaxEvents the maximum number of events parked for all the repositories
+	DefaultMaxEvents = 10000
+	// DefaultRecheckLimit the maximum number of repositories rechecked at once
+	DefaultRecheckLimit = 20
+)
+
+// ErrFull returned when the repository already has the maximum number of events parked
+var ErrFull = errors.New("the maximum number of events are already parked for the repository")
+
+// Event a webhook parked until a workspace is interested in its repository
+type Event struct {
+	Type         string      `json:"type"`
+	Delivery     string      `json:"delivery"`
+	Installation int64       `json:"installation"`
+	Repository   string      `json:"repository"`
+	FullName     string      `json:"fullName"`
+	Bot          bool        `json:"bot,omitempty"`
+	Forwarded    http.Header `json:"-"`
+	Hop          int         `json:"-"`
+	Body         []byte      `json:"-"`
+	ReceivedAt   time.Time   `json:"receivedAt"`
+	ParkedAt     time.Time   `json:"parkedAt"`
+}
+
+// Repository a repository which has events parked
+type Repository struct {
+	URL          string     `json:"url"`
+	FullName     string     `json:"fullName"`
+	Installation int64      `json:"installation"`
+	Parked       int        `json:"parked"`
+	Oldest       *time.Time `json:"oldest,omitempty"`
+}
+
+// Options the options of the store
+type Options struct {
+	// TTL how long an event is parked before it is dropped
+	TTL time.Duration
+	// MaxPerRepository the maximum number of events parked for each repository
+	MaxPerRepository int
+	// MaxEvents the maximum number of events parked for all the repositories after which the event parked the
+	// longest is evicted to make room for a new one
+	MaxEvents int
+	// RecheckLimit the maximum number of repositories returned by Due
+	RecheckLimit int
+}
+
+// Store parks the webhooks of repositories which no workspace is interested in yet, such as a newly imported
+// repository the tenant service does not know about, so that they can be delivered in order once it does. The events
+// are bounded per repository and in total, so installing the App on an organization with many repositories which are
+// not imported cannot exhaust the memory.
+type Store struct {
+	options Options
+	now     func() time.Time
+	lock    sync.Mutex
+	events  map[string][]*Event
+	checked map[string]time.Time
+}
+
+// NewStore creates a new store
+func NewStore(options Options) *Store {
+	if options.TTL <= 0 {
+		options.TTL = DefaultTTL
+	}
+	if options.MaxPerRepository <= 0 {
+		options.MaxPerRepository = DefaultMaxPerRepository
+	}
+	if options.MaxEvents <= 0 {
+		options.MaxEvents = DefaultMaxEvents
+	}
+	if options.RecheckLimit <= 0 {
+		options.RecheckLimit = DefaultRecheckLimit
+	}
+	return &Store{
+		options: options,
+		now:     time.Now,
+		events:  map[string][]*Event{},
+		checked: map[string]time.Time{},
+	}
+}
+
+// Park parks the event until its repository is routable
+func (s *Store) Park(event *Event) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.expire(event.Repository)
+	events := s.events[event.Repository]
+	if len(events) >= s.options.MaxPerRepository {
+		metrics.PendingEvents.WithLabelValues(metrics.PendingOutcomeRejected).Inc()
+		return ErrFull
+	}
+	if s.depth() >= s.options.MaxEvents {
+		s.evictOldest()
+		events = s.events[event.Repository]
+	}
+	event.ParkedAt = s.now()
+	s.events[event.Repository] = append(events, event)
+	metrics.PendingEvents.WithLabelValues(metrics.PendingOutcomeParked).Inc()
+	s.updateDepth()
+	return nil
+}
+
+// Take removes and returns the events parked for the repository in the order they were received
+func (s *Store) Take(repository string) []*Event {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.expire(repository)
+	events := s.events[repository]
+	s.drop(repository, len(events))
+	s.updateDepth()
+	return events
+}
+
+// Repositories returns the repositories which have events parked sorted by URL, dropping any expired events
+func (s *Store) Repositories() []Repository {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.repositories()
+}
+
+// Due returns up to the recheck limit of the repositories which have events parked, those which were rechecked the
+// longest time ago first, and marks them as rechecked so that each recheck looks up a bounded number of repositories
+// and every repository is rechecked in turn
+func (s *Store) Due() []Repository {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	answer := s.repositories()
+	sort.SliceStable(answer, func(i, j int) bool {
+		return s.checked[answer[i].URL].Before(s.checked[answer[j].URL])
+	})
+	if len(answer) > s.options.RecheckLimit {
+		answer = answer[:s.options.RecheckLimit]
+	}
+	now := s.now()
+	for _, repository := range answer {
+		s.checked[repository.URL] = now
+	}
+	return answer
+}
+
+func (s *Store) repositories() []Repository {
+	answer := []Repository{}
+	for repository := range s.events {
+		s.expire(repository)
+		events := s.events[repository]
+		if len(events) == 0 {
+			continue
+		}
+		oldest := events[0].ParkedAt
+		answer = append(answer, Repository{
+			URL:          repository,
+			FullName:     events[0].FullName,
+			Installation: events[len(events)-1].Installation,
+			Parked:       len(events),
+			Oldest:       &oldest,
+		})
+	}
+	s.updateDepth()
+	sort.Slice(answer, func(i, j int) bool {
+		return answer[i].URL < answer[j].URL
+	})
+	return answer
+}
+
+// Depth returns the number of events parked for all repositories
+func (s *Store) Depth() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.depth()
+}
+
+// expire drops the events of the repository which have been parked for longer than the TTL
+func (s *Store) expire(repository string) {
+	events := s.events[repository]
+	deadline := s.now().Add(-s.options.TTL)
+	i := 0
+	for i < len(events) && !events[i].ParkedAt.After(deadline) {
+		i++
+	}
+	if i == 0 {
+		return
+	}
+	metrics.PendingEvents.WithLabelValues(metrics.PendingOutcomeExpired).Add(float64(i))
+	s.drop(repository, i)
+}
+
+// evictOldest drops the event which has been parked the longest for any repository
+func (s *Store) evictOldest() {
+	oldest := ""
+	for repository, events := range s.events {
+		if oldest == "" || events[0].ParkedAt.Before(s.events[oldest][0].ParkedAt) {
+			oldest = repository
+		}
+	}
+	if oldest == "" {
+		return
+	}
+	metrics.PendingEvents.WithLabelValues(metrics.PendingOutcomeEvicted).Inc()
+	s.drop(oldest, 1)
+}
+
+// drop drops the first events of the repository forgetting the repository once it has no events parked
+func (s *Store) drop(repository string, count int) {
+	events := s.events[repository]
+	if count >= len(events) {
+		delete(s.events, repository)
+		delete(s.checked, repository)
+		return
+	}
+	s.events[repository] = events[count:]
+}
+
+func (s *Store) depth() int {
+	answer := 0
+	for _, events := range s.events {
+		answer += len(events)
+	}
+	return answer
+}
+
+func (s *Store) updateDepth() {
+	metrics.PendingDepth.Set(float64(s.depth()))
+}
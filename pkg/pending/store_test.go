@@ -0,0 +1,117 @@
+package pending
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRepository = "https://github.com/cloudbees/lighthouse-githubapp"
+
+func testEvent(delivery string) *Event {
+	return &Event{
+		Type:         "push",
+		Delivery:     delivery,
+		Installation: 1234,
+		Repository:   testRepository,
+		FullName:     "cloudbees/lighthouse-githubapp",
+		Body:         []byte(`{}`),
+	}
+}
+
+func TestParkAndTakeInOrder(t *testing.T) {
+	t.Parallel()
+
+	store := NewStore(Options{MaxPerRepository: 2})
+	require.NoError(t, store.Park(testEvent("1")))
+	require.NoError(t, store.Park(testEvent("2")))
+	assert.Equal(t, ErrFull, store.Park(testEvent("3")))
+
+	repositories := store.Repositories()
+	require.Len(t, repositories, 1)
+	assert.Equal(t, testRepository, repositories[0].URL)
+	assert.Equal(t, int64(1234), repositories[0].Installation)
+	assert.Equal(t, 2, repositories[0].Parked)
+
+	events := store.Take(testRepository)
+	require.Len(t, events, 2)
+	assert.Equal(t, "1", events[0].Delivery)
+	assert.Equal(t, "2", events[1].Delivery)
+	assert.Equal(t, 0, store.Depth())
+	assert.Empty(t, store.Take(testRepository))
+}
+
+func TestParkedEventsExpire(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	store := NewStore(Options{TTL: time.Minute})
+	store.now = func() time.Time {
+		return now
+	}
+	require.NoError(t, store.Park(testEvent("1")))
+	now = now.Add(30 * time.Second)
+	require.NoError(t, store.Park(testEvent("2")))
+	assert.Equal(t, 2, store.Depth())
+
+	now = now.Add(45 * time.Second)
+	repositories := store.Repositories()
+	require.Len(t, repositories, 1)
+	assert.Equal(t, 1, repositories[0].Parked)
+
+	now = now.Add(time.Minute)
+	assert.Empty(t, store.Repositories())
+	assert.Empty(t, store.Take(testRepository))
+	assert.Equal(t, 0, store.Depth())
+}
+
+func TestParkEvictsTheOldestEventWhenFull(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	store := NewStore(Options{MaxEvents: 2})
+	store.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	other := testEvent("2")
+	other.Repository = "https://github.com/cloudbees/other"
+	require.NoError(t, store.Park(testEvent("1")))
+	require.NoError(t, store.Park(other))
+	require.NoError(t, store.Park(testEvent("3")))
+
+	assert.Equal(t, 2, store.Depth())
+	events := store.Take(testRepository)
+	require.Len(t, events, 1)
+	assert.Equal(t, "3", events[0].Delivery, "the event parked the longest should be evicted")
+	assert.Len(t, store.Take(other.Repository), 1)
+}
+
+func TestDueRechecksRepositoriesInTurn(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	store := NewStore(Options{RecheckLimit: 2})
+	store.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		event := testEvent(name)
+		event.Repository = "https://github.com/cloudbees/" + name
+		require.NoError(t, store.Park(event))
+	}
+
+	urls := func(repositories []Repository) []string {
+		answer := []string{}
+		for _, repository := range repositories {
+			answer = append(answer, repository.URL)
+		}
+		return answer
+	}
+	assert.Equal(t, []string{"https://github.com/cloudbees/a", "https://github.com/cloudbees/b"}, urls(store.Due()))
+	assert.Equal(t, []string{"https://github.com/cloudbees/c", "https://github.com/cloudbees/a"}, urls(store.Due()))
+	assert.Equal(t, "https://github.com/cloudbees/b", store.Due()[0].URL)
+}
@@ -0,0 +1,351 @@
+package pull
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultAckTimeout how long a workspace has to acknowledge an event before it is redelivered
+	DefaultAckTimeout = time.Minute
+	// DefaultTTL how long an event is kept waiting for a workspace to receive it
+	DefaultTTL = time.Hour
+	// DefaultMaxQueued the maximum number of events queued or in flight for a workspace
+	DefaultMaxQueued = 1000
+)
+
+var (
+	// ErrQueueFull returned when a workspace already has the maximum number of events queued
+	ErrQueueFull = errors.New("the pull queue of the workspace is full")
+	// ErrUnknownEvent returned when acknowledging an event which is not in flight
+	ErrUnknownEvent = errors.New("unknown event")
+)
+
+// SignFunc returns the headers and body of an event signed at the time it is delivered to its workspace, so that
+// the signatures of an event which waited in the queue are as recent as those of a relayed webhook
+type SignFunc func() (map[string]string, []byte, error)
+
+// Event a webhook queued for a workspace which pulls its events
+type Event struct {
+	ID         string            `json:"id"`
+	Headers    map[string]string `json:"headers"`
+	Body       []byte            `json:"body"`
+	EnqueuedAt time.Time         `json:"enqueuedAt"`
+	Attempts   int               `json:"attempts"`
+
+	seq      uint64
+	deadline time.Time
+	sign     SignFunc
+}
+
+// QueueStatus the state of the queue of a workspace
+type QueueStatus struct {
+	Pending  int        `json:"pending"`
+	InFlight int        `json:"inFlight"`
+	Oldest   *time.Time `json:"oldest,omitempty"`
+}
+
+// Options the options of the broker
+type Options struct {
+	// AckTimeout how long a workspace has to acknowledge an event before it is redelivered
+	AckTimeout time.Duration
+	// TTL how long an event is kept before it is dropped if the workspace has not acknowledged it
+	TTL time.Duration
+	// MaxQueued the maximum number of events queued or in flight for each workspace
+	MaxQueued int
+}
+
+// Broker queues the events of the workspaces which cannot accept inbound connections until they pull them.
+// Received events are leased to the workspace and redelivered if they are not acknowledged in time.
+type Broker struct {
+	options Options
+	now     func() time.Time
+	lock    sync.Mutex
+	seq     uint64
+	queues  map[string]*queue
+}
+
+// queue the events of a single workspace
+type queue struct {
+	pending  []*Event
+	inFlight map[string]*Event
+	// notify is closed and replaced whenever events become available
+	notify chan struct{}
+}
+
+// NewBroker creates a new broker
+func NewBroker(options Options) *Broker {
+	if options.AckTimeout <= 0 {
+		options.AckTimeout = DefaultAckTimeout
+	}
+	if options.TTL <= 0 {
+		options.TTL = DefaultTTL
+	}
+	if options.MaxQueued <= 0 {
+		options.MaxQueued = DefaultMaxQueued
+	}
+	return &Broker{
+		options: options,
+		now:     time.Now,
+		queues:  map[string]*queue{},
+	}
+}
+
+// Enqueue queues the event for the workspace returning its ID. If the sign function is not nil it signs the event
+// again each time it is delivered.
+func (b *Broker) Enqueue(workspace string, headers map[string]string, body []byte, sign SignFunc) (string, error) {
+	id, err := randomID()
+	if err != nil {
+		return "", err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q := b.queue(workspace)
+	b.expire(workspace, q)
+	if len(q.pending)+len(q.inFlight) >= b.options.MaxQueued {
+		metrics.PullEvents.WithLabelValues(workspace, metrics.PullOutcomeRejected).Inc()
+		return "", ErrQueueFull
+	}
+	b.seq++
+	e := &Event{
+		ID:         id,
+		Headers:    headers,
+		Body:       body,
+		EnqueuedAt: b.now(),
+		seq:        b.seq,
+		sign:       sign,
+	}
+	q.pending = append(q.pending, e)
+	q.wake()
+	metrics.PullEvents.WithLabelValues(workspace, metrics.PullOutcomeQueued).Inc()
+	b.updateDepth(workspace, q)
+	return e.ID, nil
+}
+
+// Receive returns up to max events for the workspace in the order they were queued, waiting until at least one
+// is available or the context is done in which case no events are returned. The events must be acknowledged
+// before the ack timeout otherwise they are redelivered.
+func (b *Broker) Receive(ctx context.Context, workspace string, max int) []Event {
+	if max <= 0 {
+		max = 1
+	}
+	for {
+		b.lock.Lock()
+		q := b.queue(workspace)
+		b.expire(workspace, q)
+		if len(q.pending) > 0 {
+			answer := b.lease(workspace, q, max)
+			b.lock.Unlock()
+			return signed(workspace, answer)
+		}
+		notify := q.notify
+		wait := b.nextDeadline(q)
+		b.lock.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-notify:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// Ack acknowledges an event so that it is not redelivered
+func (b *Broker) Ack(workspace string, id string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q := b.queues[workspace]
+	if q == nil || q.inFlight[id] == nil {
+		return ErrUnknownEvent
+	}
+	delete(q.inFlight, id)
+	metrics.PullEvents.WithLabelValues(workspace, metrics.PullOutcomeAcked).Inc()
+	b.updateDepth(workspace, q)
+	return nil
+}
+
+// Snapshot returns the state of the queue of each workspace
+func (b *Broker) Snapshot() map[string]QueueStatus {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	answer := map[string]QueueStatus{}
+	for workspace, q := range b.queues {
+		status := QueueStatus{
+			Pending:  len(q.pending),
+			InFlight: len(q.inFlight),
+		}
+		for _, e := range q.all() {
+			if status.Oldest == nil || e.EnqueuedAt.Before(*status.Oldest) {
+				t := e.EnqueuedAt
+				status.Oldest = &t
+			}
+		}
+		answer[workspace] = status
+	}
+	return answer
+}
+
+// Depth returns the total number of events queued or in flight across all the workspaces
+func (b *Broker) Depth() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	depth := 0
+	for _, q := range b.queues {
+		depth += len(q.pending) + len(q.inFlight)
+	}
+	return depth
+}
+
+func (b *Broker) queue(workspace string) *queue {
+	q := b.queues[workspace]
+	if q == nil {
+		q = &queue{
+			inFlight: map[string]*Event{},
+			notify:   make(chan struct{}),
+		}
+		b.queues[workspace] = q
+	}
+	return q
+}
+
+// lease moves up to max pending events in flight returning copies of them
+func (b *Broker) lease(workspace string, q *queue, max int) []Event {
+	if max > len(q.pending) {
+		max = len(q.pending)
+	}
+	now := b.now()
+	answer := make([]Event, 0, max)
+	for _, e := range q.pending[:max] {
+		e.Attempts++
+		e.deadline = now.Add(b.options.AckTimeout)
+		q.inFlight[e.ID] = e
+		answer = append(answer, *e)
+		metrics.PullEvents.WithLabelValues(workspace, metrics.PullOutcomeDelivered).Inc()
+	}
+	q.pending = q.pending[max:]
+	return answer
+}
+
+// signed signs the leased events again so their signatures are as recent as their delivery. An event which cannot
+// be signed again is delivered with the signatures it was queued with.
+func signed(workspace string, events []Event) []Event {
+	for i := range events {
+		e := &events[i]
+		if e.sign == nil {
+			continue
+		}
+		headers, body, err := e.sign()
+		if err != nil {
+			logrus.WithError(err).WithField("Workspace", workspace).Warnf("failed to sign event %s again", e.ID)
+			continue
+		}
+		e.Headers = headers
+		e.Body = body
+	}
+	return events
+}
+
+// expire moves the events whose lease has expired back to the pending events in their original order and drops
+// the events which have been queued for longer than the TTL
+func (b *Broker) expire(workspace string, q *queue) {
+	now := b.now()
+	redelivered := false
+	for id, e := range q.inFlight {
+		if now.Before(e.deadline) {
+			continue
+		}
+		delete(q.inFlight, id)
+		q.pending = append(q.pending, e)
+		redelivered = true
+		metrics.PullEvents.WithLabelValues(workspace, metrics.PullOutcomeRedelivered).Inc()
+	}
+	if redelivered {
+		sort.Slice(q.pending, func(i, j int) bool {
+			return q.pending[i].seq < q.pending[j].seq
+		})
+	}
+
+	cutoff := now.Add(-b.options.TTL)
+	kept := q.pending[:0]
+	for _, e := range q.pending {
+		if e.EnqueuedAt.After(cutoff) {
+			kept = append(kept, e)
+			continue
+		}
+		metrics.PullEvents.WithLabelValues(workspace, metrics.PullOutcomeExpired).Inc()
+	}
+	q.pending = kept
+	b.updateDepth(workspace, q)
+}
+
+// nextDeadline returns how long until the next lease expires or zero if there are no events in flight
+func (b *Broker) nextDeadline(q *queue) time.Duration {
+	var next time.Time
+	for _, e := range q.inFlight {
+		if next.IsZero() || e.deadline.Before(next) {
+			next = e.deadline
+		}
+	}
+	if next.IsZero() {
+		return 0
+	}
+	wait := next.Sub(b.now())
+	if wait <= 0 {
+		wait = time.Millisecond
+	}
+	return wait
+}
+
+// randomID returns a random event ID so that the IDs of different replicas or of a replica which restarted never
+// collide, as a workspace may use them to skip the events it has already seen
+func randomID() (string, error) {
+	data := make([]byte, 16)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate an event ID")
+	}
+	return hex.EncodeToString(data), nil
+}
+
+func (b *Broker) updateDepth(workspace string, q *queue) {
+	metrics.PullQueueDepth.WithLabelValues(workspace).Set(float64(len(q.pending) + len(q.inFlight)))
+}
+
+// wake notifies the receivers waiting for events
+func (q *queue) wake() {
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
+
+func (q *queue) all() []*Event {
+	answer := append([]*Event{}, q.pending...)
+	for _, e := range q.inFlight {
+		answer = append(answer, e)
+	}
+	return answer
+}
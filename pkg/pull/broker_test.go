@@ -0,0 +1,141 @@
+package pull
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock a clock which only moves when told to
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestBroker(options Options) (*Broker, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)}
+	b := NewBroker(options)
+	b.now = clock.Now
+	return b, clock
+}
+
+func receiveNow(b *Broker, workspace string, max int) []Event {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	return b.Receive(ctx, workspace, max)
+}
+
+func TestBrokerDeliversInOrderAndRedelivers(t *testing.T) {
+	t.Parallel()
+
+	b, clock := newTestBroker(Options{AckTimeout: time.Minute})
+	for _, body := range []string{"one", "two", "three"} {
+		_, err := b.Enqueue("cbjx-mycluster", map[string]string{"X-GitHub-Event": "push"}, []byte(body), nil)
+		require.NoError(t, err)
+	}
+
+	events := receiveNow(b, "cbjx-mycluster", 2)
+	require.Len(t, events, 2)
+	assert.Equal(t, "one", string(events[0].Body))
+	assert.Equal(t, "two", string(events[1].Body))
+	assert.Equal(t, "push", events[0].Headers["X-GitHub-Event"])
+	assert.Empty(t, receiveNow(b, "cbjx-other", 10), "workspaces should not see each others events")
+
+	require.NoError(t, b.Ack("cbjx-mycluster", events[1].ID))
+	assert.Equal(t, ErrUnknownEvent, b.Ack("cbjx-mycluster", events[1].ID))
+
+	// the unacknowledged event is redelivered before the later event once its lease expires
+	clock.now = clock.now.Add(2 * time.Minute)
+	events = receiveNow(b, "cbjx-mycluster", 10)
+	require.Len(t, events, 2)
+	assert.Equal(t, "one", string(events[0].Body))
+	assert.Equal(t, 2, events[0].Attempts)
+	assert.Equal(t, "three", string(events[1].Body))
+
+	status := b.Snapshot()["cbjx-mycluster"]
+	assert.Equal(t, 0, status.Pending)
+	assert.Equal(t, 2, status.InFlight)
+	assert.Equal(t, 2, b.Depth())
+}
+
+func TestBrokerSignsEventsAsTheyAreDelivered(t *testing.T) {
+	t.Parallel()
+
+	b, clock := newTestBroker(Options{AckTimeout: time.Minute})
+	deliveries := 0
+	sign := func() (map[string]string, []byte, error) {
+		deliveries++
+		return map[string]string{"X-Delivery": strconv.Itoa(deliveries)}, []byte("signed"), nil
+	}
+	_, err := b.Enqueue("cbjx-mycluster", map[string]string{"X-Delivery": "0"}, []byte("queued"), sign)
+	require.NoError(t, err)
+
+	events := receiveNow(b, "cbjx-mycluster", 10)
+	require.Len(t, events, 1)
+	assert.Equal(t, "1", events[0].Headers["X-Delivery"])
+	assert.Equal(t, "signed", string(events[0].Body))
+
+	// the redelivery is signed again
+	clock.now = clock.now.Add(2 * time.Minute)
+	events = receiveNow(b, "cbjx-mycluster", 10)
+	require.Len(t, events, 1)
+	assert.Equal(t, "2", events[0].Headers["X-Delivery"])
+}
+
+func TestBrokerEventIDsAreUnique(t *testing.T) {
+	t.Parallel()
+
+	first, err := NewBroker(Options{}).Enqueue("cbjx-mycluster", nil, []byte("one"), nil)
+	require.NoError(t, err)
+	second, err := NewBroker(Options{}).Enqueue("cbjx-mycluster", nil, []byte("one"), nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second, "the IDs of different brokers should not collide")
+	assert.Len(t, first, 32)
+}
+
+func TestBrokerWaitsForEvents(t *testing.T) {
+	t.Parallel()
+
+	b := NewBroker(Options{})
+	received := make(chan []Event)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		received <- b.Receive(ctx, "cbjx-mycluster", 1)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	_, err := b.Enqueue("cbjx-mycluster", nil, []byte("late"), nil)
+	require.NoError(t, err)
+
+	events := <-received
+	require.Len(t, events, 1)
+	assert.Equal(t, "late", string(events[0].Body))
+}
+
+func TestBrokerLimits(t *testing.T) {
+	t.Parallel()
+
+	b, clock := newTestBroker(Options{MaxQueued: 2, TTL: time.Hour})
+	_, err := b.Enqueue("cbjx-mycluster", nil, []byte("one"), nil)
+	require.NoError(t, err)
+	_, err = b.Enqueue("cbjx-mycluster", nil, []byte("two"), nil)
+	require.NoError(t, err)
+	_, err = b.Enqueue("cbjx-mycluster", nil, []byte("three"), nil)
+	assert.Equal(t, ErrQueueFull, err)
+
+	// expired events are dropped which makes room for new events
+	clock.now = clock.now.Add(2 * time.Hour)
+	_, err = b.Enqueue("cbjx-mycluster", nil, []byte("four"), nil)
+	require.NoError(t, err)
+	events := receiveNow(b, "cbjx-mycluster", 10)
+	require.Len(t, events, 1)
+	assert.Equal(t, "four", string(events[0].Body))
+}
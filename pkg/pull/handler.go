@@ -0,0 +1,188 @@
+package pull
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/util"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// EventsPath URL path for the HTTP endpoint which long-polls for the events of a workspace
+	EventsPath = "/pull/{workspace}/events"
+	// StreamPath URL path for the HTTP endpoint which streams the events of a workspace as server-sent events
+	StreamPath = "/pull/{workspace}/stream"
+	// AckPath URL path for the HTTP endpoint which acknowledges an event
+	AckPath = "/pull/{workspace}/events/{id}/ack"
+
+	// DefaultWait how long a long-poll waits for events if no wait is specified
+	DefaultWait = 30 * time.Second
+	// MaxWait the maximum time a long-poll waits for events
+	MaxWait = 5 * time.Minute
+	// maxBatch the maximum number of events returned by a long-poll
+	maxBatch = 100
+	// keepAliveInterval how often a comment is written to idle streams so proxies do not close them
+	keepAliveInterval = 15 * time.Second
+)
+
+// Authenticator returns true if the bearer token is valid for the workspace
+type Authenticator func(workspace string, token string) bool
+
+// Handler the HTTP endpoints which workspaces use to pull their events
+type Handler struct {
+	broker       *Broker
+	authenticate Authenticator
+}
+
+// NewHandler creates a new handler for the broker using the authenticator to verify the workspace tokens
+func NewHandler(broker *Broker, authenticate Authenticator) *Handler {
+	return &Handler{
+		broker:       broker,
+		authenticate: authenticate,
+	}
+}
+
+// Handle registers the pull endpoints on the router
+func (h *Handler) Handle(router *mux.Router) {
+	router.HandleFunc(EventsPath, h.events).Methods(http.MethodGet)
+	router.HandleFunc(StreamPath, h.stream).Methods(http.MethodGet)
+	router.HandleFunc(AckPath, h.ack).Methods(http.MethodPost)
+}
+
+// events long-polls for the events of the workspace. It returns HTTP 200 with a JSON array of events or HTTP 204
+// if none were queued before the wait expired. The wait and the maximum number of events can be specified with
+// the ?wait=30s and ?max=10 query parameters.
+func (h *Handler) events(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	wait := DefaultWait
+	text := r.URL.Query().Get("wait")
+	if text != "" {
+		d, err := time.ParseDuration(text)
+		if err != nil || d < 0 {
+			http.Error(w, fmt.Sprintf("invalid wait %s", text), http.StatusBadRequest)
+			return
+		}
+		wait = d
+	}
+	if wait > MaxWait {
+		wait = MaxWait
+	}
+	max := maxBatch
+	text = r.URL.Query().Get("max")
+	if text != "" {
+		n, err := strconv.Atoi(text)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("invalid max %s", text), http.StatusBadRequest)
+			return
+		}
+		if n < max {
+			max = n
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	events := h.broker.Receive(ctx, workspace, max)
+	if len(events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	data, err := json.Marshal(events)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	if err != nil {
+		util.TraceLogger(r.Context()).WithError(err).Debugf("failed to write the events of workspace %s", workspace)
+	}
+}
+
+// stream streams the events of the workspace as server-sent events until the client disconnects. Each event
+// still has to be acknowledged otherwise it is sent again after the ack timeout.
+func (h *Handler) stream(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	l := util.TraceLogger(r.Context()).WithField("Workspace", workspace)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for r.Context().Err() == nil {
+		ctx, cancel := context.WithTimeout(r.Context(), keepAliveInterval)
+		events := h.broker.Receive(ctx, workspace, maxBatch)
+		cancel()
+		if len(events) == 0 {
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+			continue
+		}
+		for _, e := range events {
+			data, err := json.Marshal(e)
+			if err != nil {
+				l.WithError(err).Errorf("failed to marshal event %s", e.ID)
+				continue
+			}
+			_, err = fmt.Fprintf(w, "id: %s\nevent: webhook\ndata: %s\n\n", e.ID, data)
+			if err != nil {
+				// the unacknowledged events are redelivered after the ack timeout
+				l.WithError(err).Debug("the stream was closed")
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// ack acknowledges an event returning HTTP 204 or HTTP 404 if the event is not in flight
+func (h *Handler) ack(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	err := h.broker.Ack(workspace, id)
+	if err == ErrUnknownEvent {
+		http.Error(w, fmt.Sprintf("event %s is not in flight for workspace %s", id, workspace), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorize verifies the bearer token of the request returning the workspace
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) (string, bool) {
+	workspace := mux.Vars(r)["workspace"]
+	auth := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(auth, "Bearer ")
+	if workspace == "" || token == "" || token == auth || !h.authenticate(workspace, token) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="lighthouse-githubapp"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	return workspace, true
+}
@@ -0,0 +1,98 @@
+package pull
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, b *Broker) *httptest.Server {
+	router := mux.NewRouter()
+	NewHandler(b, func(workspace string, token string) bool {
+		return workspace == "cbjx-mycluster" && token == "s3cr3t"
+	}).Handle(router)
+	return httptest.NewServer(router)
+}
+
+func doRequest(t *testing.T, method string, url string, token string) *http.Response {
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestHandlerLongPoll(t *testing.T) {
+	t.Parallel()
+
+	b := NewBroker(Options{})
+	server := newTestServer(t, b)
+	defer server.Close()
+	eventsURL := server.URL + "/pull/cbjx-mycluster/events"
+
+	resp := doRequest(t, http.MethodGet, eventsURL+"?wait=10ms", "wrong")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = doRequest(t, http.MethodGet, eventsURL+"?wait=10ms", "s3cr3t")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	_, err := b.Enqueue("cbjx-mycluster", map[string]string{"X-GitHub-Event": "push"}, []byte(`{"ref":"main"}`), nil)
+	require.NoError(t, err)
+
+	resp = doRequest(t, http.MethodGet, eventsURL+"?wait=1s", "s3cr3t")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	events := []Event{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&events))
+	resp.Body.Close()
+	require.Len(t, events, 1)
+	assert.Equal(t, `{"ref":"main"}`, string(events[0].Body))
+
+	resp = doRequest(t, http.MethodPost, eventsURL+"/"+events[0].ID+"/ack", "s3cr3t")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = doRequest(t, http.MethodPost, eventsURL+"/"+events[0].ID+"/ack", "s3cr3t")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, 0, b.Depth())
+}
+
+func TestHandlerStream(t *testing.T) {
+	t.Parallel()
+
+	b := NewBroker(Options{})
+	server := newTestServer(t, b)
+	defer server.Close()
+	id, err := b.Enqueue("cbjx-mycluster", nil, []byte("streamed"), nil)
+	require.NoError(t, err)
+
+	resp := doRequest(t, http.MethodGet, server.URL+"/pull/cbjx-mycluster/stream", "s3cr3t")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	lines := []string{}
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	assert.Equal(t, "id: "+id, lines[0])
+	assert.Equal(t, "event: webhook", lines[1])
+	e := Event{}
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &e))
+	assert.Equal(t, "streamed", string(e.Body))
+}
@@ -0,0 +1,383 @@
+package ratelimit
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tracing"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// StageIngest the stage label value for webhooks received from an installation
+	StageIngest = "ingest"
+	// StageRelay the stage label value for webhooks relayed for an installation
+	StageRelay = "relay"
+
+	// DefaultIdleTimeout the default time after which the state of an installation which has not sent webhooks is
+	// forgotten
+	DefaultIdleTimeout = 10 * time.Minute
+	// DefaultMaxQueued the default maximum number of webhooks queued as their installation is over its ingest limit
+	DefaultMaxQueued = 1000
+)
+
+// Limit a token bucket which allows Rate webhooks per second on average with bursts of up to Burst webhooks. A zero
+// Rate is unlimited.
+type Limit struct {
+	Rate  int `json:"rate"`
+	Burst int `json:"burst"`
+}
+
+// Limits the limits of an installation
+type Limits struct {
+	// Ingest limits the webhooks received from the installation
+	Ingest Limit `json:"ingest"`
+	// Relay limits the webhooks relayed for the installation
+	Relay Limit `json:"relay"`
+	// MaxConcurrentRelays the maximum number of webhooks of the installation relayed at once, zero is unlimited
+	MaxConcurrentRelays int `json:"maxConcurrentRelays"`
+}
+
+// Options the options of the limiter
+type Options struct {
+	// Default the limits of every installation without an override
+	Default Limits
+	// Overrides the limits of specific installations keyed by installation ID
+	Overrides map[int64]Limits
+	// IdleTimeout the time after which an installation which is not sending webhooks is forgotten along with its
+	// metrics, defaults to DefaultIdleTimeout
+	IdleTimeout time.Duration
+	// MaxQueued the maximum number of webhooks queued as their installation is over its ingest limit, defaults to
+	// DefaultMaxQueued
+	MaxQueued int
+}
+
+// InstallationStatus the state of the limits of an installation
+type InstallationStatus struct {
+	Installation int64  `json:"installation"`
+	Limits       Limits `json:"limits"`
+	Waiting      int    `json:"waiting"`
+	Relaying     int    `json:"relaying"`
+	Throttled    int64  `json:"throttled"`
+}
+
+// Limiter isolates the installations of the shared relay from each other. Each installation has token buckets for
+// ingestion and relaying and a bulkhead limiting its concurrent relays so one noisy installation cannot delay the
+// others. Webhooks over the limits wait in the order they were received rather than being dropped: webhooks over the
+// ingest limit are queued in the background so the sender gets its response at once, and relays wait until the
+// context is done. Installations which stop sending webhooks are evicted so that the state and the per installation
+// metrics do not grow with every installation ever seen.
+type Limiter struct {
+	options       Options
+	now           func() time.Time
+	lock          sync.Mutex
+	installations map[int64]*installation
+	swept         time.Time
+	queued        chan struct{}
+	wg            sync.WaitGroup
+}
+
+type installation struct {
+	id        int64
+	limits    Limits
+	ingest    *bucket
+	relay     *bucket
+	relays    chan struct{}
+	waiting   int
+	throttled int64
+	lastSeen  time.Time
+}
+
+// New creates a new limiter
+func New(options Options) *Limiter {
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = DefaultIdleTimeout
+	}
+	if options.MaxQueued <= 0 {
+		options.MaxQueued = DefaultMaxQueued
+	}
+	return &Limiter{
+		options:       options,
+		now:           time.Now,
+		installations: map[int64]*installation{},
+		swept:         time.Now(),
+		queued:        make(chan struct{}, options.MaxQueued),
+	}
+}
+
+// WaitIngest waits until the installation may send another webhook
+func (l *Limiter) WaitIngest(ctx context.Context, id int64) error {
+	inst := l.installation(id)
+	return l.wait(ctx, inst, inst.ingest, StageIngest)
+}
+
+// Ingest processes the webhook of the installation at once if the installation is within its ingest limit. Otherwise
+// the webhook is queued and processed in the background once it is its turn, on a context which carries the values
+// of the context but is never cancelled, so that the sender is answered at once rather than timing out while the
+// webhook waits. An error is returned without processing the webhook if the queue is full.
+func (l *Limiter) Ingest(ctx context.Context, id int64, process func(ctx context.Context) error) error {
+	inst := l.installation(id)
+	if inst.ingest == nil {
+		return process(ctx)
+	}
+	l.lock.Lock()
+	delay := inst.ingest.reserve(l.now())
+	l.lock.Unlock()
+	if delay <= 0 {
+		return process(ctx)
+	}
+
+	select {
+	case l.queued <- struct{}{}:
+	default:
+		l.lock.Lock()
+		inst.ingest.cancel()
+		l.lock.Unlock()
+		return errors.Errorf("too many webhooks are queued to be within the ingest rate limits so rejected a webhook of installation %d", id)
+	}
+	ctx = tracing.Detach(ctx)
+	l.wg.Add(1)
+	go func() {
+		defer func() {
+			<-l.queued
+			l.wg.Done()
+		}()
+		err := l.waitFor(ctx, inst, inst.ingest, StageIngest, delay)
+		if err == nil {
+			err = process(ctx)
+		}
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to process a queued webhook of installation %d", id)
+		}
+	}()
+	return nil
+}
+
+// Close waits for the queued webhooks to be processed
+func (l *Limiter) Close() {
+	l.wg.Wait()
+}
+
+// AcquireRelay waits until the installation may relay another webhook. The returned function must be invoked to
+// release the relay once the webhook is relayed.
+func (l *Limiter) AcquireRelay(ctx context.Context, id int64) (func(), error) {
+	inst := l.installation(id)
+	if inst.relays != nil {
+		select {
+		case inst.relays <- struct{}{}:
+		default:
+			l.throttled(inst, StageRelay)
+			l.update(inst, 1)
+			select {
+			case inst.relays <- struct{}{}:
+				l.update(inst, -1)
+			case <-ctx.Done():
+				l.update(inst, -1)
+				return nil, errors.Wrapf(ctx.Err(), "timed out waiting to relay a webhook of installation %d", id)
+			}
+		}
+	}
+	release := func() {
+		if inst.relays != nil {
+			<-inst.relays
+			l.update(inst, 0)
+		}
+	}
+	err := l.wait(ctx, inst, inst.relay, StageRelay)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	l.update(inst, 0)
+
+	var once sync.Once
+	return func() {
+		once.Do(release)
+	}, nil
+}
+
+// Snapshot returns the state of each installation which has sent webhooks sorted by installation ID
+func (l *Limiter) Snapshot() []InstallationStatus {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	answer := make([]InstallationStatus, 0, len(l.installations))
+	for _, inst := range l.installations {
+		answer = append(answer, InstallationStatus{
+			Installation: inst.id,
+			Limits:       inst.limits,
+			Waiting:      inst.waiting,
+			Relaying:     len(inst.relays),
+			Throttled:    inst.throttled,
+		})
+	}
+	sort.Slice(answer, func(i, j int) bool {
+		return answer[i].Installation < answer[j].Installation
+	})
+	return answer
+}
+
+// wait reserves a token from the bucket and waits until it is available
+func (l *Limiter) wait(ctx context.Context, inst *installation, b *bucket, stage string) error {
+	if b == nil {
+		return nil
+	}
+	l.lock.Lock()
+	delay := b.reserve(l.now())
+	l.lock.Unlock()
+	return l.waitFor(ctx, inst, b, stage, delay)
+}
+
+// waitFor waits for the token reserved from the bucket to be available after the delay
+func (l *Limiter) waitFor(ctx context.Context, inst *installation, b *bucket, stage string, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+
+	l.throttled(inst, stage)
+	l.update(inst, 1)
+	defer l.update(inst, -1)
+	start := time.Now()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		metrics.InstallationThrottleDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+		return nil
+	case <-ctx.Done():
+		l.lock.Lock()
+		b.cancel()
+		l.lock.Unlock()
+		return errors.Wrapf(ctx.Err(), "timed out waiting for the %s rate limit of installation %d", stage, inst.id)
+	}
+}
+
+func (l *Limiter) throttled(inst *installation, stage string) {
+	metrics.InstallationThrottled.WithLabelValues(strconv.FormatInt(inst.id, 10), stage).Inc()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	inst.throttled++
+}
+
+// update changes the number of webhooks of the installation which are waiting and updates its metrics
+func (l *Limiter) update(inst *installation, waiting int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	inst.waiting += waiting
+	label := strconv.FormatInt(inst.id, 10)
+	metrics.InstallationWaiting.WithLabelValues(label).Set(float64(inst.waiting))
+	metrics.InstallationRelaysInFlight.WithLabelValues(label).Set(float64(len(inst.relays)))
+}
+
+// installation returns the state of the installation creating it with its limits if required
+func (l *Limiter) installation(id int64) *installation {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.now()
+	if now.Sub(l.swept) >= l.options.IdleTimeout {
+		l.evict(now)
+	}
+	inst := l.installations[id]
+	if inst == nil {
+		limits := l.limits(id)
+		inst = &installation{
+			id:     id,
+			limits: limits,
+			ingest: newBucket(limits.Ingest, now),
+			relay:  newBucket(limits.Relay, now),
+		}
+		if limits.MaxConcurrentRelays > 0 {
+			inst.relays = make(chan struct{}, limits.MaxConcurrentRelays)
+		}
+		l.installations[id] = inst
+	}
+	inst.lastSeen = now
+	return inst
+}
+
+// evict forgets the installations which have not sent a webhook within the idle timeout and have none waiting or
+// being relayed, deleting their metrics. The lock must be held.
+func (l *Limiter) evict(now time.Time) {
+	l.swept = now
+	for id, inst := range l.installations {
+		if now.Sub(inst.lastSeen) < l.options.IdleTimeout || inst.waiting > 0 || len(inst.relays) > 0 {
+			continue
+		}
+		delete(l.installations, id)
+		label := strconv.FormatInt(id, 10)
+		metrics.InstallationWaiting.DeleteLabelValues(label)
+		metrics.InstallationRelaysInFlight.DeleteLabelValues(label)
+		metrics.InstallationThrottled.DeleteLabelValues(label, StageIngest)
+		metrics.InstallationThrottled.DeleteLabelValues(label, StageRelay)
+		metrics.GitHubRateLimitRemaining.DeleteLabelValues(label)
+	}
+}
+
+// limits returns the limits of the installation where any limit not overridden uses the default
+func (l *Limiter) limits(id int64) Limits {
+	answer := l.options.Default
+	override, ok := l.options.Overrides[id]
+	if !ok {
+		return answer
+	}
+	if override.Ingest.Rate != 0 {
+		answer.Ingest = override.Ingest
+	}
+	if override.Relay.Rate != 0 {
+		answer.Relay = override.Relay
+	}
+	if override.MaxConcurrentRelays != 0 {
+		answer.MaxConcurrentRelays = override.MaxConcurrentRelays
+	}
+	return answer
+}
+
+// bucket a token bucket whose tokens can be reserved ahead of time so that waiting webhooks are admitted in order
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newBucket returns a full bucket for the limit or nil if the limit is unlimited
+func newBucket(limit Limit, now time.Time) *bucket {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	burst := limit.Burst
+	if burst <= 0 {
+		burst = limit.Rate
+	}
+	return &bucket{
+		rate:   float64(limit.Rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// reserve takes a token returning how long to wait until it is available
+func (b *bucket) reserve(now time.Time) time.Duration {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a reserved token which was not used
+func (b *bucket) cancel() {
+	b.tokens++
+}
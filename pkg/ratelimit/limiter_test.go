@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitIngest(t *testing.T) {
+	t.Parallel()
+
+	l := New(Options{Default: Limits{Ingest: Limit{Rate: 20, Burst: 2}}})
+	ctx := context.Background()
+
+	start := time.Now()
+	require.NoError(t, l.WaitIngest(ctx, 1))
+	require.NoError(t, l.WaitIngest(ctx, 1))
+	assert.True(t, time.Since(start) < 40*time.Millisecond, "the burst should not wait")
+
+	require.NoError(t, l.WaitIngest(ctx, 2), "another installation should have its own bucket")
+
+	require.NoError(t, l.WaitIngest(ctx, 1))
+	assert.True(t, time.Since(start) >= 40*time.Millisecond, "a webhook over the burst should wait for the rate")
+
+	statuses := l.Snapshot()
+	require.Len(t, statuses, 2)
+	assert.Equal(t, int64(1), statuses[0].Installation)
+	assert.Equal(t, int64(1), statuses[0].Throttled)
+	assert.Zero(t, statuses[1].Throttled)
+}
+
+func TestWaitIngestCancelled(t *testing.T) {
+	t.Parallel()
+
+	l := New(Options{Default: Limits{Ingest: Limit{Rate: 1, Burst: 1}}})
+	require.NoError(t, l.WaitIngest(context.Background(), 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := l.WaitIngest(ctx, 1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ingest rate limit of installation 1")
+	assert.Zero(t, l.Snapshot()[0].Waiting)
+}
+
+func TestRelayBulkhead(t *testing.T) {
+	t.Parallel()
+
+	l := New(Options{
+		Default:   Limits{MaxConcurrentRelays: 1},
+		Overrides: map[int64]Limits{2: {MaxConcurrentRelays: 2}},
+	})
+	ctx := context.Background()
+
+	release, err := l.AcquireRelay(ctx, 1)
+	require.NoError(t, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		release, err := l.AcquireRelay(ctx, 1)
+		if assert.NoError(t, err) {
+			release()
+		}
+		close(acquired)
+	}()
+
+	for i := 0; i < 2; i++ {
+		_, err := l.AcquireRelay(ctx, 2)
+		require.NoError(t, err, "another installation should not wait for the noisy one")
+	}
+
+	select {
+	case <-acquired:
+		t.Fatal("the second relay of the installation should wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("the waiting relay should proceed once the first is released")
+	}
+
+	statuses := l.Snapshot()
+	require.Len(t, statuses, 2)
+	assert.Equal(t, 1, statuses[0].Limits.MaxConcurrentRelays)
+	assert.Equal(t, 0, statuses[0].Relaying)
+	assert.Equal(t, 2, statuses[1].Limits.MaxConcurrentRelays)
+	assert.Equal(t, 2, statuses[1].Relaying)
+}
+
+func TestOverrides(t *testing.T) {
+	t.Parallel()
+
+	l := New(Options{
+		Default: Limits{
+			Ingest:              Limit{Rate: 10, Burst: 20},
+			Relay:               Limit{Rate: 5},
+			MaxConcurrentRelays: 3,
+		},
+		Overrides: map[int64]Limits{42: {Ingest: Limit{Rate: 100, Burst: 200}}},
+	})
+	assert.Equal(t, Limits{Ingest: Limit{Rate: 100, Burst: 200}, Relay: Limit{Rate: 5}, MaxConcurrentRelays: 3}, l.limits(42))
+	assert.Equal(t, Limits{Ingest: Limit{Rate: 10, Burst: 20}, Relay: Limit{Rate: 5}, MaxConcurrentRelays: 3}, l.limits(7))
+}
+
+func TestEvictIdleInstallations(t *testing.T) {
+	t.Parallel()
+
+	l := New(Options{Default: Limits{MaxConcurrentRelays: 1}, IdleTimeout: time.Minute})
+	now := time.Now()
+	l.now = func() time.Time {
+		return now
+	}
+	ctx := context.Background()
+
+	require.NoError(t, l.WaitIngest(ctx, 1))
+	release, err := l.AcquireRelay(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, l.Snapshot(), 2)
+
+	now = now.Add(2 * time.Minute)
+	require.NoError(t, l.WaitIngest(ctx, 3))
+	statuses := l.Snapshot()
+	require.Len(t, statuses, 2, "the idle installation should be evicted")
+	assert.Equal(t, int64(2), statuses[0].Installation, "an installation with a relay in flight should be kept")
+	assert.Equal(t, int64(3), statuses[1].Installation)
+
+	release()
+	now = now.Add(2 * time.Minute)
+	require.NoError(t, l.WaitIngest(ctx, 3))
+	statuses = l.Snapshot()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, int64(3), statuses[0].Installation)
+}
+
+func TestIngestQueuesWebhooksOverTheLimit(t *testing.T) {
+	t.Parallel()
+
+	l := New(Options{Default: Limits{Ingest: Limit{Rate: 10, Burst: 1}}, MaxQueued: 1})
+	processed := make(chan string, 3)
+	process := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			assert.NoError(t, ctx.Err(), "a queued webhook should not be processed on a cancelled context")
+			processed <- name
+			return nil
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	require.NoError(t, l.Ingest(ctx, 1, process("first")))
+	assert.Equal(t, "first", <-processed, "a webhook within the limit should be processed at once")
+
+	require.NoError(t, l.Ingest(ctx, 1, process("second")))
+	assert.Empty(t, processed, "a webhook over the limit should be queued")
+	err := l.Ingest(ctx, 1, process("third"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "too many webhooks are queued")
+
+	// the request of the queued webhook completes as soon as it is queued
+	cancel()
+	l.Close()
+	assert.Equal(t, "second", <-processed)
+	assert.Empty(t, processed)
+	assert.Zero(t, l.Snapshot()[0].Waiting)
+}
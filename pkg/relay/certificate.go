@@ -0,0 +1,156 @@
+package relay
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultCertificateReloadInterval how often the client certificate files are checked for rotation
+	DefaultCertificateReloadInterval = time.Minute
+
+	// certificateExpiryWarning how long before a client certificate expires that warnings are logged
+	certificateExpiryWarning = 14 * 24 * time.Hour
+)
+
+// CertificateStatus the state of a client certificate used to relay webhooks
+type CertificateStatus struct {
+	CertFile  string    `json:"certFile"`
+	KeyFile   string    `json:"keyFile"`
+	Subject   string    `json:"subject"`
+	NotAfter  time.Time `json:"notAfter"`
+	LoadedAt  time.Time `json:"loadedAt"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// clientCertificate a client certificate which is reloaded when its files change so that rotated
+// certificates are picked up without a restart
+type clientCertificate struct {
+	certFile       string
+	keyFile        string
+	reloadInterval time.Duration
+	lock           sync.Mutex
+	cert           *tls.Certificate
+	leaf           *x509.Certificate
+	modTime        time.Time
+	checked        time.Time
+	loaded         time.Time
+	lastError      error
+}
+
+// newClientCertificate loads the client certificate from the PEM encoded certificate and key files
+func newClientCertificate(certFile string, keyFile string, reloadInterval time.Duration) (*clientCertificate, error) {
+	c := &clientCertificate{
+		certFile:       certFile,
+		keyFile:        keyFile,
+		reloadInterval: reloadInterval,
+	}
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	err = c.load(modTime)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetClientCertificate returns the current certificate, reloading it first if its files have changed
+func (c *clientCertificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.checked) >= c.reloadInterval {
+		c.checked = now
+		c.reloadIfChanged()
+	}
+	return c.cert, nil
+}
+
+// reloadIfChanged reloads the certificate if either file has been modified. If the new files cannot be loaded,
+// for example as only one of them has been written so far, the previous certificate is kept.
+func (c *clientCertificate) reloadIfChanged() {
+	modTime, err := c.latestModTime()
+	if err == nil && !modTime.After(c.modTime) {
+		return
+	}
+	if err == nil {
+		err = c.load(modTime)
+	}
+	if err != nil {
+		c.lastError = err
+		metrics.RelayClientCertificateReloads.WithLabelValues(c.certFile, metrics.OutcomeFailure).Inc()
+		logrus.WithError(err).Warnf("failed to reload the client certificate %s, using the previous certificate", c.certFile)
+		return
+	}
+	metrics.RelayClientCertificateReloads.WithLabelValues(c.certFile, metrics.OutcomeSuccess).Inc()
+	logrus.Infof("reloaded the client certificate %s which expires at %s", c.certFile, c.leaf.NotAfter)
+}
+
+// load loads the certificate and key files and records the expiry
+func (c *clientCertificate) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to load the client certificate %s and key %s", c.certFile, c.keyFile)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse the client certificate %s", c.certFile)
+	}
+	cert.Leaf = leaf
+	c.cert = &cert
+	c.leaf = leaf
+	c.modTime = modTime
+	c.loaded = time.Now()
+	c.lastError = nil
+
+	metrics.RelayClientCertificateExpiry.WithLabelValues(c.certFile).Set(float64(leaf.NotAfter.Unix()))
+	remaining := time.Until(leaf.NotAfter)
+	if remaining <= 0 {
+		logrus.Errorf("the client certificate %s expired at %s", c.certFile, leaf.NotAfter)
+	} else if remaining < certificateExpiryWarning {
+		logrus.Warnf("the client certificate %s expires in %s at %s", c.certFile, remaining.Round(time.Hour), leaf.NotAfter)
+	}
+	return nil
+}
+
+// latestModTime returns the latest modification time of the certificate and key files
+func (c *clientCertificate) latestModTime() (time.Time, error) {
+	latest := time.Time{}
+	for _, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return latest, errors.Wrapf(err, "failed to stat %s", name)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// status returns the state of the certificate
+func (c *clientCertificate) status() CertificateStatus {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	answer := CertificateStatus{
+		CertFile: c.certFile,
+		KeyFile:  c.keyFile,
+		Subject:  c.leaf.Subject.String(),
+		NotAfter: c.leaf.NotAfter,
+		LoadedAt: c.loaded,
+	}
+	if c.lastError != nil {
+		answer.LastError = c.lastError.Error()
+	}
+	return answer
+}
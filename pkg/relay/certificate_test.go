@@ -0,0 +1,142 @@
+package relay
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA a certificate authority which issues the certificates for the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue writes a client certificate and key signed by the CA to the files
+func (ca *testCA) issue(t *testing.T, serial int64, certFile string, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "lighthouse-githubapp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func TestClientCertificates(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	serials := make(chan int64, 10)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serials <- r.TLS.PeerCertificates[0].SerialNumber.Int64()
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  ca.pool,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "relay")
+	require.NoError(t, err)
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	ca.issue(t, 100, certFile, keyFile)
+
+	f, err := NewClientFactory(Options{CertificateReloadInterval: time.Nanosecond})
+	require.NoError(t, err)
+
+	// without a client certificate the server rejects the handshake
+	client, err := f.Client(TLSProfile{Insecure: true})
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+
+	profile := TLSProfile{Insecure: true, CertFile: certFile, KeyFile: keyFile}
+	client, err = f.Client(profile)
+	require.NoError(t, err)
+	get := func() int64 {
+		// use new connections so that the handshake is repeated
+		client.CloseIdleConnections()
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		return <-serials
+	}
+	assert.Equal(t, int64(100), get())
+
+	// rotate the certificate making sure the modification time changes
+	ca.issue(t, 101, certFile, keyFile)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, chtimes(certFile, later))
+	require.NoError(t, chtimes(keyFile, later))
+	assert.Equal(t, int64(101), get(), "the rotated certificate should be presented")
+
+	statuses := f.Certificates()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, certFile, statuses[0].CertFile)
+	assert.Equal(t, "CN=lighthouse-githubapp", statuses[0].Subject)
+	assert.Empty(t, statuses[0].LastError)
+
+	// a broken rotation keeps using the previous certificate
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte("not a key"), 0600))
+	require.NoError(t, chtimes(keyFile, later.Add(time.Minute)))
+	assert.Equal(t, int64(101), get())
+	assert.NotEmpty(t, f.Certificates()[0].LastError)
+
+	_, err = f.Client(TLSProfile{CertFile: certFile})
+	assert.Error(t, err, "the key file is required")
+}
+
+func chtimes(name string, t time.Time) error {
+	return os.Chtimes(name, t, t)
+}
@@ -0,0 +1,216 @@
+package relay
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/util"
+	"github.com/pkg/errors"
+)
+
+// DefaultTimeout the default timeout of each relay request
+const DefaultTimeout = 30 * time.Second
+
+// TLSProfile the TLS settings used to relay webhooks to a workspace
+type TLSProfile struct {
+	// Insecure disables the verification of the server certificate
+	Insecure bool
+	// CAFile the location of a PEM encoded CA bundle which is trusted in addition to the system roots.
+	// If specified the server certificate is always verified even if Insecure is set.
+	CAFile string
+	// CertFile the location of the PEM encoded client certificate presented to servers which require mutual TLS
+	CertFile string
+	// KeyFile the location of the PEM encoded private key of the client certificate
+	KeyFile string
+}
+
+// key returns the key of the cached client for the profile
+func (p TLSProfile) key() string {
+	key := "default"
+	if p.CAFile != "" {
+		key = "ca:" + p.CAFile
+	} else if p.Insecure {
+		key = "insecure"
+	}
+	if p.CertFile != "" {
+		key += ",cert:" + p.CertFile
+	}
+	return key
+}
+
+// Options the options of the relay clients
+type Options struct {
+	// Transport the settings of the transport, otherwise the util defaults are used
+	Transport *util.TransportSettings
+	// Timeout the timeout of each request, otherwise DefaultTimeout is used
+	Timeout time.Duration
+	// ProxyURL the URL of the HTTP proxy, otherwise the standard proxy environment variables are used
+	ProxyURL string
+	// CertificateReloadInterval how often the client certificate files are checked for rotation,
+	// otherwise DefaultCertificateReloadInterval is used
+	CertificateReloadInterval time.Duration
+}
+
+// ClientFactory creates and caches the HTTP clients used to relay webhooks so that connections are reused
+// across deliveries. One client is cached per TLS profile.
+type ClientFactory struct {
+	settings       util.TransportSettings
+	timeout        time.Duration
+	proxy          func(*http.Request) (*url.URL, error)
+	reloadInterval time.Duration
+	lock           sync.Mutex
+	clients        map[string]*http.Client
+	certificates   map[string]*clientCertificate
+}
+
+// NewClientFactory creates a new client factory
+func NewClientFactory(options Options) (*ClientFactory, error) {
+	settings := util.DefaultTransportSettings()
+	if options.Transport != nil {
+		settings = *options.Transport
+	}
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	proxy := http.ProxyFromEnvironment
+	if options.ProxyURL != "" {
+		proxyURL, err := url.Parse(options.ProxyURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse the relay proxy URL %s", options.ProxyURL)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	reloadInterval := options.CertificateReloadInterval
+	if reloadInterval <= 0 {
+		reloadInterval = DefaultCertificateReloadInterval
+	}
+	return &ClientFactory{
+		settings:       settings,
+		timeout:        timeout,
+		proxy:          proxy,
+		reloadInterval: reloadInterval,
+		clients:        map[string]*http.Client{},
+		certificates:   map[string]*clientCertificate{},
+	}, nil
+}
+
+// Client returns the cached client for the TLS profile, creating it if required
+func (f *ClientFactory) Client(profile TLSProfile) (*http.Client, error) {
+	key := profile.key()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	client := f.clients[key]
+	if client != nil {
+		return client, nil
+	}
+	tlsConfig, err := f.newTLSConfig(profile)
+	if err != nil {
+		return nil, err
+	}
+	tr := util.NewTransport(f.settings)
+	tr.Proxy = f.proxy
+	tr.TLSClientConfig = tlsConfig
+	// the relay sends many requests to the same few Lighthouse hosts
+	tr.MaxIdleConnsPerHost = tr.MaxIdleConns
+	client = &http.Client{Transport: tr, Timeout: f.timeout}
+	f.clients[key] = client
+	return client, nil
+}
+
+// Purge closes the idle connections and removes the cached clients so that they are recreated, for example
+// to pick up a changed CA bundle
+func (f *ClientFactory) Purge() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, client := range f.clients {
+		client.CloseIdleConnections()
+	}
+	f.clients = map[string]*http.Client{}
+	f.certificates = map[string]*clientCertificate{}
+}
+
+// Certificates returns the state of the client certificates sorted by file name
+func (f *ClientFactory) Certificates() []CertificateStatus {
+	f.lock.Lock()
+	certificates := make([]*clientCertificate, 0, len(f.certificates))
+	for _, c := range f.certificates {
+		certificates = append(certificates, c)
+	}
+	f.lock.Unlock()
+
+	answer := []CertificateStatus{}
+	for _, c := range certificates {
+		answer = append(answer, c.status())
+	}
+	sort.Slice(answer, func(i, j int) bool {
+		return answer[i].CertFile < answer[j].CertFile
+	})
+	return answer
+}
+
+// Profiles returns the sorted keys of the cached clients
+func (f *ClientFactory) Profiles() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	keys := []string{}
+	for key := range f.clients {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// newTLSConfig creates the TLS configuration for the profile
+func (f *ClientFactory) newTLSConfig(profile TLSProfile) (*tls.Config, error) {
+	tlsConfig, err := newServerVerification(profile)
+	if err != nil {
+		return nil, err
+	}
+	if profile.CertFile == "" && profile.KeyFile == "" {
+		return tlsConfig, nil
+	}
+	if profile.CertFile == "" || profile.KeyFile == "" {
+		return nil, errors.New("both the client certificate and key files must be specified")
+	}
+	certKey := profile.CertFile + "," + profile.KeyFile
+	c := f.certificates[certKey]
+	if c == nil {
+		c, err = newClientCertificate(profile.CertFile, profile.KeyFile, f.reloadInterval)
+		if err != nil {
+			return nil, err
+		}
+		f.certificates[certKey] = c
+	}
+	tlsConfig.GetClientCertificate = c.GetClientCertificate
+	return tlsConfig, nil
+}
+
+// newServerVerification creates the TLS configuration which verifies the server certificate for the profile
+func newServerVerification(profile TLSProfile) (*tls.Config, error) {
+	if profile.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		data, err := ioutil.ReadFile(profile.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read the CA bundle %s", profile.CAFile)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.Errorf("no certificates found in the CA bundle %s", profile.CAFile)
+		}
+		return &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}, nil
+	}
+	if profile.Insecure {
+		// #nosec G402
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+	return &tls.Config{MinVersion: tls.VersionTLS12}, nil
+}
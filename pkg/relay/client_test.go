@@ -0,0 +1,115 @@
+package relay
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientFactoryCachesPerProfile(t *testing.T) {
+	t.Parallel()
+
+	f, err := NewClientFactory(Options{Timeout: 5 * time.Second})
+	require.NoError(t, err)
+
+	c1, err := f.Client(TLSProfile{})
+	require.NoError(t, err)
+	c2, err := f.Client(TLSProfile{})
+	require.NoError(t, err)
+	insecure, err := f.Client(TLSProfile{Insecure: true})
+	require.NoError(t, err)
+
+	assert.True(t, c1 == c2, "the client should be reused for the same profile")
+	assert.False(t, c1 == insecure, "a different profile should use a different client")
+	assert.Equal(t, 5*time.Second, c1.Timeout)
+	assert.Equal(t, []string{"default", "insecure"}, f.Profiles())
+
+	f.Purge()
+	assert.Empty(t, f.Profiles())
+}
+
+func TestClientFactoryTLS(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "relay")
+	require.NoError(t, err)
+	caFile := filepath.Join(dir, "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(caFile, data, 0600))
+
+	f, err := NewClientFactory(Options{})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		profile TLSProfile
+		wantErr bool
+	}{
+		{
+			name:    "default rejects an unknown CA",
+			profile: TLSProfile{},
+			wantErr: true,
+		},
+		{
+			name:    "insecure skips verification",
+			profile: TLSProfile{Insecure: true},
+		},
+		{
+			name:    "custom CA bundle",
+			profile: TLSProfile{CAFile: caFile},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := f.Client(tc.profile)
+			require.NoError(t, err)
+			resp, err := client.Get(server.URL)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			require.NoError(t, resp.Body.Close())
+		})
+	}
+
+	_, err = f.Client(TLSProfile{CAFile: filepath.Join(dir, "missing.pem")})
+	assert.Error(t, err)
+}
+
+func TestClientFactoryProxy(t *testing.T) {
+	t.Parallel()
+
+	proxied := ""
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer proxy.Close()
+
+	f, err := NewClientFactory(Options{ProxyURL: proxy.URL})
+	require.NoError(t, err)
+	client, err := f.Client(TLSProfile{})
+	require.NoError(t, err)
+
+	target := &url.URL{Scheme: "http", Host: "lighthouse.example.com", Path: "/hook"}
+	resp, err := client.Post(target.String(), "application/json", nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, target.String(), proxied)
+}
@@ -0,0 +1,110 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// CloudEventsBinary relays the payload as the body with the CloudEvents attributes as ce-* headers
+	CloudEventsBinary = "binary"
+	// CloudEventsStructured relays a JSON CloudEvent whose data is the payload
+	CloudEventsStructured = "structured"
+
+	// CloudEventsSpecVersion the version of the CloudEvents specification the events conform to
+	CloudEventsSpecVersion = "1.0"
+	// CloudEventsTypePrefix the prefix of the CloudEvents type which is followed by the GitHub event type
+	CloudEventsTypePrefix = "com.github."
+
+	cloudEventsContentType = "application/cloudevents+json; charset=UTF-8"
+	jsonContentType        = "application/json"
+)
+
+// githubHeaders the GitHub headers replaced by CloudEvents attributes. The X-GitHub-Delivery header is kept as the
+// timestamped and asymmetric signatures cover the delivery ID.
+var githubHeaders = []string{"X-GitHub-Event"}
+
+// CloudEvent returns a copy of the event presented as a CloudEvent in either binary or structured mode. The event type,
+// source repository, delivery ID and installation are carried as CloudEvents attributes. The event must be signed
+// after it is presented as a CloudEvent so that the signatures cover the body which is relayed: the payload in binary
+// mode and the JSON CloudEvent in structured mode.
+func CloudEvent(event *Event, mode string, t time.Time) (*Event, error) {
+	if event.Source == "" {
+		return nil, Permanent(errors.Errorf("no source repository for CloudEvent %s", event.Delivery))
+	}
+	attributes := map[string]string{
+		"specversion":     CloudEventsSpecVersion,
+		"id":              event.Delivery,
+		"type":            CloudEventsTypePrefix + event.Type,
+		"source":          event.Source,
+		"time":            t.UTC().Format(time.RFC3339),
+		"datacontenttype": jsonContentType,
+	}
+	if event.Installation != 0 {
+		attributes["installation"] = strconv.FormatInt(event.Installation, 10)
+	}
+
+	answer := *event
+	answer.Headers = http.Header{}
+	for name, values := range event.Headers {
+		answer.Headers[name] = append([]string{}, values...)
+	}
+	for _, name := range githubHeaders {
+		answer.Headers.Del(name)
+	}
+
+	switch mode {
+	case CloudEventsBinary:
+		for name, value := range attributes {
+			if name == "datacontenttype" {
+				continue
+			}
+			answer.Headers.Set("ce-"+name, value)
+		}
+		answer.Headers.Set("Content-Type", jsonContentType)
+		return &answer, nil
+
+	case CloudEventsStructured:
+		body, err := structuredCloudEvent(attributes, event.Body)
+		if err != nil {
+			return nil, Permanent(errors.Wrapf(err, "creating structured CloudEvent %s", event.Delivery))
+		}
+		answer.Headers.Set("Content-Type", cloudEventsContentType)
+		answer.Body = body
+		return &answer, nil
+
+	default:
+		return nil, Permanent(errors.Errorf("unknown CloudEvents mode '%s', must be either %s or %s", mode, CloudEventsBinary, CloudEventsStructured))
+	}
+}
+
+// structuredCloudEvent writes the attributes then the payload verbatim as the data so that the workspace receives the
+// payload GitHub sent byte for byte, while the signatures are over the whole CloudEvent. A payload which is not JSON
+// is base64 encoded in data_base64 instead.
+func structuredCloudEvent(attributes map[string]string, payload []byte) ([]byte, error) {
+	if !json.Valid(payload) {
+		delete(attributes, "datacontenttype")
+		envelope := map[string]interface{}{}
+		for name, value := range attributes {
+			envelope[name] = value
+		}
+		envelope["data_base64"] = payload
+		return json.Marshal(envelope)
+	}
+
+	data, err := json.Marshal(attributes)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.Buffer{}
+	buf.Write(data[:len(data)-1])
+	buf.WriteString(`,"data":`)
+	buf.Write(payload)
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
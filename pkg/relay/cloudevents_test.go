@@ -0,0 +1,79 @@
+package relay
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cloudEventsTestEvent() *Event {
+	event := testEvent()
+	event.Source = "https://github.com/cloudbees/lighthouse-githubapp"
+	event.Installation = 1234
+	return event
+}
+
+func TestCloudEventBinary(t *testing.T) {
+	t.Parallel()
+
+	event := cloudEventsTestEvent()
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	ce, err := CloudEvent(event, CloudEventsBinary, now)
+	require.NoError(t, err)
+
+	assert.Equal(t, event.Body, ce.Body, "the payload should not be modified")
+	assert.Equal(t, "1.0", ce.Headers.Get("ce-specversion"))
+	assert.Equal(t, "f2467dea-70d6-11e8-8955-3c83993e0aef", ce.Headers.Get("ce-id"))
+	assert.Equal(t, "com.github.push", ce.Headers.Get("ce-type"))
+	assert.Equal(t, "https://github.com/cloudbees/lighthouse-githubapp", ce.Headers.Get("ce-source"))
+	assert.Equal(t, "2020-06-01T12:00:00Z", ce.Headers.Get("ce-time"))
+	assert.Equal(t, "1234", ce.Headers.Get("ce-installation"))
+	assert.Equal(t, "application/json", ce.Headers.Get("Content-Type"))
+	assert.Equal(t, "sha256=1234", ce.Headers.Get("X-Hub-Signature"))
+	assert.Empty(t, ce.Headers.Get("X-GitHub-Event"))
+	assert.Equal(t, "f2467dea-70d6-11e8-8955-3c83993e0aef", ce.Headers.Get("X-GitHub-Delivery"), "the signatures cover the delivery ID")
+
+	assert.Equal(t, "push", event.Headers.Get("X-GitHub-Event"), "the original event should not be modified")
+}
+
+func TestCloudEventStructured(t *testing.T) {
+	t.Parallel()
+
+	event := cloudEventsTestEvent()
+	event.Body = []byte(`{"ref": "refs/heads/main",  "url": "https://example.com/?a=1&b=<2>"}`)
+	ce, err := CloudEvent(event, CloudEventsStructured, time.Now())
+	require.NoError(t, err)
+
+	assert.Equal(t, "application/cloudevents+json; charset=UTF-8", ce.Headers.Get("Content-Type"))
+	assert.Equal(t, "sha256=1234", ce.Headers.Get("X-Hub-Signature"))
+	envelope := map[string]json.RawMessage{}
+	require.NoError(t, json.Unmarshal(ce.Body, &envelope))
+	assert.Equal(t, string(event.Body), string(envelope["data"]), "the data should be the payload verbatim")
+	assert.Equal(t, `"com.github.push"`, string(envelope["type"]))
+	assert.Equal(t, `"1234"`, string(envelope["installation"]))
+	assert.Equal(t, `"application/json"`, string(envelope["datacontenttype"]))
+
+	event.Body = []byte("payload=not+json")
+	ce, err = CloudEvent(event, CloudEventsStructured, time.Now())
+	require.NoError(t, err)
+	envelope = map[string]json.RawMessage{}
+	require.NoError(t, json.Unmarshal(ce.Body, &envelope))
+	assert.Equal(t, `"`+base64.StdEncoding.EncodeToString(event.Body)+`"`, string(envelope["data_base64"]))
+	assert.NotContains(t, envelope, "data")
+}
+
+func TestCloudEventErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := CloudEvent(cloudEventsTestEvent(), "batch", time.Now())
+	require.Error(t, err)
+	assert.True(t, IsPermanent(err))
+
+	_, err = CloudEvent(testEvent(), CloudEventsBinary, time.Now())
+	require.Error(t, err)
+	assert.True(t, IsPermanent(err))
+}
@@ -0,0 +1,153 @@
+package relay
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/metrics"
+)
+
+const (
+	// DefaultFailureThreshold the number of consecutive failures after which an endpoint is unhealthy
+	DefaultFailureThreshold = 3
+	// DefaultRecoveryInterval how long to wait before trying an unhealthy endpoint again
+	DefaultRecoveryInterval = 30 * time.Second
+
+	// EndpointPrimary the role of the first endpoint of a workspace
+	EndpointPrimary = "primary"
+	// EndpointSecondary the role of the standby endpoints of a workspace
+	EndpointSecondary = "secondary"
+)
+
+// HealthOptions the options of the endpoint health tracking
+type HealthOptions struct {
+	// FailureThreshold the number of consecutive failures after which an endpoint is unhealthy
+	FailureThreshold int
+	// RecoveryInterval how long to wait before trying an unhealthy endpoint again
+	RecoveryInterval time.Duration
+}
+
+// EndpointStatus the health of an endpoint
+type EndpointStatus struct {
+	URL                 string     `json:"url"`
+	Healthy             bool       `json:"healthy"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	UnhealthySince      *time.Time `json:"unhealthySince,omitempty"`
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+}
+
+// EndpointHealth tracks the health of the endpoints of the workspaces so that deliveries fail over to a standby
+// endpoint when the primary is unhealthy and fail back once it recovers
+type EndpointHealth struct {
+	options   HealthOptions
+	now       func() time.Time
+	lock      sync.Mutex
+	endpoints map[string]*endpointState
+}
+
+type endpointState struct {
+	status      EndpointStatus
+	lastAttempt time.Time
+}
+
+// NewEndpointHealth creates a new endpoint health tracker
+func NewEndpointHealth(options HealthOptions) *EndpointHealth {
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold = DefaultFailureThreshold
+	}
+	if options.RecoveryInterval <= 0 {
+		options.RecoveryInterval = DefaultRecoveryInterval
+	}
+	return &EndpointHealth{
+		options:   options,
+		now:       time.Now,
+		endpoints: map[string]*endpointState{},
+	}
+}
+
+// Select returns the endpoint to deliver to and its index. This is the first endpoint in order which is healthy or
+// has been unhealthy for long enough to be tried again, so the primary is used again as soon as it recovers. If
+// every endpoint is unhealthy the one which has not been tried for the longest is used.
+func (h *EndpointHealth) Select(urls []string) (string, int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	now := h.now()
+	oldest := 0
+	for i, url := range urls {
+		state := h.state(url)
+		if state.status.Healthy || now.Sub(state.lastAttempt) >= h.options.RecoveryInterval {
+			state.lastAttempt = now
+			return url, i
+		}
+		if state.lastAttempt.Before(h.state(urls[oldest]).lastAttempt) {
+			oldest = i
+		}
+	}
+	h.state(urls[oldest]).lastAttempt = now
+	return urls[oldest], oldest
+}
+
+// Success records a delivery which reached the endpoint
+func (h *EndpointHealth) Success(url string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	state := h.state(url)
+	now := h.now()
+	state.status.Healthy = true
+	state.status.ConsecutiveFailures = 0
+	state.status.UnhealthySince = nil
+	state.status.LastSuccess = &now
+	metrics.RelayEndpointHealthy.WithLabelValues(url).Set(1)
+}
+
+// Failure records a delivery which failed as the endpoint was not available
+func (h *EndpointHealth) Failure(url string, err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	state := h.state(url)
+	state.status.ConsecutiveFailures++
+	state.status.LastError = err.Error()
+	if state.status.Healthy && state.status.ConsecutiveFailures >= h.options.FailureThreshold {
+		now := h.now()
+		state.status.Healthy = false
+		state.status.UnhealthySince = &now
+		state.lastAttempt = now
+		metrics.RelayEndpointHealthy.WithLabelValues(url).Set(0)
+	}
+}
+
+// Snapshot returns the health of the endpoints sorted by URL
+func (h *EndpointHealth) Snapshot() []EndpointStatus {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	answer := make([]EndpointStatus, 0, len(h.endpoints))
+	for _, state := range h.endpoints {
+		answer = append(answer, state.status)
+	}
+	sort.Slice(answer, func(i, j int) bool {
+		return answer[i].URL < answer[j].URL
+	})
+	return answer
+}
+
+func (h *EndpointHealth) state(url string) *endpointState {
+	state := h.endpoints[url]
+	if state == nil {
+		state = &endpointState{status: EndpointStatus{URL: url, Healthy: true}}
+		h.endpoints[url] = state
+	}
+	return state
+}
+
+// EndpointRole returns the role of the endpoint with the index
+func EndpointRole(index int) string {
+	if index == 0 {
+		return EndpointPrimary
+	}
+	return EndpointSecondary
+}
@@ -0,0 +1,71 @@
+package relay
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointHealthFailsOverAndBack(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	health := NewEndpointHealth(HealthOptions{FailureThreshold: 2, RecoveryInterval: time.Minute})
+	health.now = func() time.Time {
+		return now
+	}
+	endpoints := []string{"https://primary.example.com/hook", "https://standby.example.com/hook"}
+
+	url, index := health.Select(endpoints)
+	assert.Equal(t, endpoints[0], url)
+	assert.Equal(t, 0, index)
+	health.Failure(url, errors.New("503 Service Unavailable"))
+	url, _ = health.Select(endpoints)
+	assert.Equal(t, endpoints[0], url, "a single failure should not fail over")
+	health.Failure(url, errors.New("503 Service Unavailable"))
+
+	url, index = health.Select(endpoints)
+	assert.Equal(t, endpoints[1], url, "should fail over once the primary is unhealthy")
+	assert.Equal(t, EndpointSecondary, EndpointRole(index))
+	health.Success(url)
+
+	now = now.Add(2 * time.Minute)
+	url, index = health.Select(endpoints)
+	assert.Equal(t, endpoints[0], url, "the primary should be tried again after the recovery interval")
+	assert.Equal(t, EndpointPrimary, EndpointRole(index))
+	url, _ = health.Select(endpoints)
+	assert.Equal(t, endpoints[1], url, "only one delivery should probe the primary at a time")
+
+	health.Success(endpoints[0])
+	url, _ = health.Select(endpoints)
+	assert.Equal(t, endpoints[0], url, "should fail back once the primary recovers")
+
+	statuses := health.Snapshot()
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Healthy)
+	assert.Zero(t, statuses[0].ConsecutiveFailures)
+}
+
+func TestEndpointHealthAllUnhealthy(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	health := NewEndpointHealth(HealthOptions{FailureThreshold: 1, RecoveryInterval: time.Minute})
+	health.now = func() time.Time {
+		return now
+	}
+	endpoints := []string{"https://primary.example.com/hook", "https://standby.example.com/hook"}
+	health.Failure(endpoints[0], errors.New("timeout"))
+	now = now.Add(time.Second)
+	health.Failure(endpoints[1], errors.New("timeout"))
+	now = now.Add(time.Second)
+
+	url, _ := health.Select(endpoints)
+	assert.Equal(t, endpoints[0], url, "the endpoint tried longest ago should be used")
+	now = now.Add(time.Second)
+	url, _ = health.Select(endpoints)
+	assert.Equal(t, endpoints[1], url)
+}
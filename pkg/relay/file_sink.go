@@ -0,0 +1,124 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FileSinkName the name of the sink which appends events to a JSON lines file
+const FileSinkName = "file"
+
+// Record an event as it is written by the file and NATS sinks
+type Record struct {
+	Time      time.Time           `json:"time"`
+	Workspace string              `json:"workspace"`
+	Event     string              `json:"event"`
+	Delivery  string              `json:"delivery"`
+	Headers   map[string][]string `json:"headers"`
+	// Body the payload if it is valid JSON
+	Body json.RawMessage `json:"body,omitempty"`
+	// RawBody the payload if it is not valid JSON
+	RawBody []byte `json:"rawBody,omitempty"`
+}
+
+// FileSink appends the events as JSON lines to a file inside a directory which is useful for debugging and auditing.
+// The target URL is of the form file:///name.jsonl and can only refer to files inside the directory.
+type FileSink struct {
+	// Dir the directory which contains the files
+	Dir string
+
+	lock sync.Mutex
+}
+
+// Name returns the name of the sink
+func (s *FileSink) Name() string {
+	return FileSinkName
+}
+
+// Deliver appends the event to the file of the target
+func (s *FileSink) Deliver(ctx context.Context, event *Event, target *Target) (*Result, error) {
+	start := time.Now()
+	fileName, err := s.path(target.URL)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+	data, err := marshalRecord(event, target, start)
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, '\n')
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err = os.MkdirAll(filepath.Dir(fileName), 0750)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the directory of %s", fileName)
+	}
+	// #nosec G304 the file name is always inside the directory of the sink
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", fileName)
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "failed to write to %s", fileName)
+	}
+	err = f.Close()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to close %s", fileName)
+	}
+	return &Result{
+		Sink:     FileSinkName,
+		Duration: time.Since(start),
+	}, nil
+}
+
+// marshalRecord marshals the record of the event
+func marshalRecord(event *Event, target *Target, t time.Time) ([]byte, error) {
+	record := Record{
+		Time:      t.UTC(),
+		Workspace: target.Workspace,
+		Event:     event.Type,
+		Delivery:  event.Delivery,
+		Headers:   event.Headers,
+	}
+	if json.Valid(event.Body) {
+		record.Body = event.Body
+	} else {
+		record.RawBody = event.Body
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal the record")
+	}
+	return data, nil
+}
+
+// path returns the file for the URL making sure it is inside the directory of the sink
+func (s *FileSink) path(rawURL string) (string, error) {
+	if s.Dir == "" {
+		return "", errors.New("the file sink is disabled as no directory is configured")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse the file URL %s", rawURL)
+	}
+	name := u.Path
+	if name == "" {
+		name = u.Opaque
+	}
+	name = strings.TrimPrefix(filepath.Clean("/"+name), "/")
+	if name == "" || name == "." {
+		return "", errors.Errorf("no file name in the URL %s", rawURL)
+	}
+	return filepath.Join(s.Dir, name), nil
+}
@@ -0,0 +1,69 @@
+package relay
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// HeaderSignature256 the header of the SHA-256 signature of the payload
+	HeaderSignature256 = "X-Hub-Signature-256"
+
+	// HeaderRelayHop the number of relays the webhook has passed through including this one
+	HeaderRelayHop = "X-Lighthouse-Relay-Hop"
+	// HeaderRelayReceivedAt when the relay received the webhook from GitHub in RFC 3339 format
+	HeaderRelayReceivedAt = "X-Lighthouse-Relay-Received-At"
+	// HeaderRelayInstallation the ID of the GitHub App installation which received the webhook
+	HeaderRelayInstallation = "X-Lighthouse-Relay-Installation"
+	// HeaderRelayVersion the version of the relay
+	HeaderRelayVersion = "X-Lighthouse-Relay-Version"
+)
+
+// ForwardedHeaders the headers of the webhook request from GitHub which are forwarded as they are. The signatures
+// are not forwarded as they are recomputed with the HMAC token of each workspace.
+var ForwardedHeaders = []string{
+	"User-Agent",
+	"X-GitHub-Hook-ID",
+	"X-GitHub-Hook-Installation-Target-ID",
+	"X-GitHub-Hook-Installation-Target-Type",
+}
+
+// Received records the headers of the webhook request which are forwarded and when it was received. The hop is one
+// more than the hop of a webhook which was relayed to this relay by another relay.
+func (e *Event) Received(headers http.Header, receivedAt time.Time) {
+	e.Forwarded = http.Header{}
+	for _, name := range ForwardedHeaders {
+		value := headers.Get(name)
+		if value != "" {
+			e.Forwarded.Set(name, value)
+		}
+	}
+	e.Hop = 1
+	hop, err := strconv.Atoi(headers.Get(HeaderRelayHop))
+	if err == nil && hop > 0 {
+		e.Hop = hop + 1
+	}
+	e.ReceivedAt = receivedAt
+}
+
+// SetRelayHeaders sets the forwarded headers of the event and the headers which identify the relayed webhook
+func (e *Event) SetRelayHeaders(headers http.Header, version string) {
+	for name, values := range e.Forwarded {
+		headers[name] = append([]string{}, values...)
+	}
+	hop := e.Hop
+	if hop <= 0 {
+		hop = 1
+	}
+	headers.Set(HeaderRelayHop, strconv.Itoa(hop))
+	if !e.ReceivedAt.IsZero() {
+		headers.Set(HeaderRelayReceivedAt, e.ReceivedAt.UTC().Format(time.RFC3339Nano))
+	}
+	if e.Installation != 0 {
+		headers.Set(HeaderRelayInstallation, strconv.FormatInt(e.Installation, 10))
+	}
+	if version != "" {
+		headers.Set(HeaderRelayVersion, version)
+	}
+}
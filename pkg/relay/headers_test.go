@@ -0,0 +1,54 @@
+package relay
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelayHeaders(t *testing.T) {
+	t.Parallel()
+
+	original := http.Header{}
+	original.Set("User-Agent", "GitHub-Hookshot/044aadd")
+	original.Set("X-GitHub-Hook-ID", "292430182")
+	original.Set("X-GitHub-Hook-Installation-Target-ID", "79929171")
+	original.Set("X-GitHub-Hook-Installation-Target-Type", "integration")
+	original.Set("X-Hub-Signature-256", "sha256=github")
+	original.Set("Authorization", "Bearer secret")
+
+	receivedAt := time.Date(2020, 6, 1, 12, 30, 0, 0, time.UTC)
+	event := &Event{Installation: 1234}
+	event.Received(original, receivedAt)
+
+	headers := http.Header{}
+	event.SetRelayHeaders(headers, "1.2.3")
+	assert.Equal(t, "GitHub-Hookshot/044aadd", headers.Get("User-Agent"))
+	assert.Equal(t, "292430182", headers.Get("X-GitHub-Hook-ID"))
+	assert.Equal(t, "79929171", headers.Get("X-GitHub-Hook-Installation-Target-ID"))
+	assert.Equal(t, "integration", headers.Get("X-GitHub-Hook-Installation-Target-Type"))
+	assert.Empty(t, headers.Get("X-Hub-Signature-256"), "the signature of GitHub should not be forwarded")
+	assert.Empty(t, headers.Get("Authorization"))
+	assert.Equal(t, "1", headers.Get(HeaderRelayHop))
+	assert.Equal(t, "2020-06-01T12:30:00Z", headers.Get(HeaderRelayReceivedAt))
+	assert.Equal(t, "1234", headers.Get(HeaderRelayInstallation))
+	assert.Equal(t, "1.2.3", headers.Get(HeaderRelayVersion))
+}
+
+func TestRelayHeadersHop(t *testing.T) {
+	t.Parallel()
+
+	original := http.Header{}
+	original.Set(HeaderRelayHop, "2")
+	event := &Event{}
+	event.Received(original, time.Now())
+	assert.Equal(t, 3, event.Hop, "a webhook relayed by another relay should count its hops")
+
+	headers := http.Header{}
+	(&Event{}).SetRelayHeaders(headers, "")
+	assert.Equal(t, "1", headers.Get(HeaderRelayHop))
+	assert.Empty(t, headers.Get(HeaderRelayReceivedAt))
+	assert.Empty(t, headers.Get(HeaderRelayVersion))
+}
@@ -0,0 +1,73 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// HTTPSinkName the name of the sink which POSTs events to the Lighthouse of the workspace
+	HTTPSinkName = "http"
+
+	// maxResponseBody the maximum amount of the response body which is read
+	maxResponseBody = 10000000
+)
+
+// HTTPSink POSTs the events to the Lighthouse of the workspace
+type HTTPSink struct {
+	// Clients creates the clients for the TLS profile of each target
+	Clients *ClientFactory
+	// Client if specified is used for every target instead of the clients of the factory
+	Client *http.Client
+}
+
+// Name returns the name of the sink
+func (s *HTTPSink) Name() string {
+	return HTTPSinkName
+}
+
+// Deliver POSTs the event to the URL of the target
+func (s *HTTPSink) Deliver(ctx context.Context, event *Event, target *Target) (*Result, error) {
+	client := s.Client
+	if client == nil {
+		var err error
+		client, err = s.Clients.Client(target.TLS)
+		if err != nil {
+			return nil, Permanent(errors.Wrapf(err, "creating client for workspace '%s'", target.Workspace))
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", target.URL, bytes.NewReader(event.Body))
+	if err != nil {
+		return nil, Permanent(errors.Wrapf(err, "creating request for '%s'", target.URL))
+	}
+	for name, values := range event.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing resp.body")
+	}
+	return &Result{
+		Sink:       HTTPSinkName,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       body,
+		Duration:   time.Since(start),
+	}, nil
+}
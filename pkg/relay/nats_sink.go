@@ -0,0 +1,189 @@
+package relay
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// NATSSinkName the name of the sink which publishes events to NATS
+	NATSSinkName = "nats"
+
+	// DefaultNATSSubjectPrefix the prefix of the subject if the target URL does not specify a subject
+	DefaultNATSSubjectPrefix = "lighthouse.webhooks"
+
+	// DefaultNATSMaxConnections the maximum number of connections kept open by default
+	DefaultNATSMaxConnections = 16
+)
+
+// NATSSink publishes the events to NATS. The target URL is of the form nats://host:4222/subject where the subject
+// defaults to lighthouse.webhooks.<workspace>. Each message is a JSON Record containing the relay headers and body.
+// As the URLs of the workspaces come from the tenant service, only the configured servers are published to.
+type NATSSink struct {
+	// Timeout how long to wait for the server to confirm it has received an event
+	Timeout time.Duration
+	// Servers the host:port of the NATS servers which may be published to, the sink is disabled if there are none
+	Servers []string
+	// MaxConnections the maximum number of connections kept open after which the least recently used is closed
+	MaxConnections int
+
+	lock        sync.Mutex
+	connections map[string]*natsConnection
+}
+
+// natsConnection a cached connection to a NATS server
+type natsConnection struct {
+	conn *nats.Conn
+	used time.Time
+}
+
+// Name returns the name of the sink
+func (s *NATSSink) Name() string {
+	return NATSSinkName
+}
+
+// Deliver publishes the event to the subject of the target
+func (s *NATSSink) Deliver(ctx context.Context, event *Event, target *Target) (*Result, error) {
+	start := time.Now()
+	server, subject, err := parseNATSURL(target)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+	err = s.allowed(server)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+	nc, err := s.connection(server)
+	if err != nil {
+		return nil, err
+	}
+	data, err := marshalRecord(event, target, start)
+	if err != nil {
+		return nil, err
+	}
+	err = nc.Publish(subject, data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to publish to %s", subject)
+	}
+
+	// wait for the server to process the message so that connection failures are reported
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	flushCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err = nc.FlushWithContext(flushCtx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to flush the message to %s", subject)
+	}
+	return &Result{
+		Sink:     NATSSinkName,
+		Duration: time.Since(start),
+	}, nil
+}
+
+// Close closes the connections
+func (s *NATSSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, c := range s.connections {
+		c.conn.Close()
+	}
+	s.connections = nil
+	return nil
+}
+
+// allowed returns an error unless the server is one of the configured servers
+func (s *NATSSink) allowed(server string) error {
+	if len(s.Servers) == 0 {
+		return errors.New("the NATS sink is disabled as no servers are configured")
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse the NATS server %s", server)
+	}
+	for _, allowed := range s.Servers {
+		if strings.EqualFold(allowed, u.Host) {
+			return nil
+		}
+	}
+	return errors.Errorf("the NATS server %s is not one of the configured servers", u.Host)
+}
+
+// connection returns the cached connection to the server connecting to it if there is none. The connection is
+// made without holding the lock so that a slow server does not delay the events published to the others.
+func (s *NATSSink) connection(server string) (*nats.Conn, error) {
+	s.lock.Lock()
+	c := s.connections[server]
+	if c != nil && !c.conn.IsClosed() {
+		c.used = time.Now()
+		s.lock.Unlock()
+		return c.conn, nil
+	}
+	s.lock.Unlock()
+
+	nc, err := nats.Connect(server, nats.Name("lighthouse-githubapp"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to NATS server %s", server)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c = s.connections[server]
+	if c != nil && !c.conn.IsClosed() {
+		// another event connected to the server at the same time
+		nc.Close()
+		c.used = time.Now()
+		return c.conn, nil
+	}
+	if s.connections == nil {
+		s.connections = map[string]*natsConnection{}
+	}
+	delete(s.connections, server)
+	max := s.MaxConnections
+	if max <= 0 {
+		max = DefaultNATSMaxConnections
+	}
+	for len(s.connections) >= max {
+		s.evictOldest()
+	}
+	s.connections[server] = &natsConnection{conn: nc, used: time.Now()}
+	return nc, nil
+}
+
+// evictOldest closes the least recently used connection. The lock must be held.
+func (s *NATSSink) evictOldest() {
+	oldest := ""
+	for server, c := range s.connections {
+		if oldest == "" || c.used.Before(s.connections[oldest].used) {
+			oldest = server
+		}
+	}
+	s.connections[oldest].conn.Close()
+	delete(s.connections, oldest)
+}
+
+// parseNATSURL returns the server URL and subject of the target
+func parseNATSURL(target *Target) (string, string, error) {
+	u, err := url.Parse(target.URL)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to parse the NATS URL %s", target.URL)
+	}
+	if u.Host == "" {
+		return "", "", errors.Errorf("no host in the NATS URL %s", target.URL)
+	}
+	subject := strings.Trim(u.Path, "/")
+	if subject == "" {
+		subject = DefaultNATSSubjectPrefix + "." + target.Workspace
+	}
+	subject = strings.Replace(subject, "/", ".", -1)
+	server := url.URL{Scheme: u.Scheme, Host: u.Host, User: u.User}
+	return server.String(), subject, nil
+}
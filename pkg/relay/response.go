@@ -0,0 +1,141 @@
+package relay
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ErrorResponseVersion the version of the error response contract understood by the relay
+	ErrorResponseVersion = 1
+
+	// RepoNotConfiguredMessage the message of the legacy error response of a Lighthouse which does not have the
+	// repository in its configuration yet
+	RepoNotConfiguredMessage = "repository not configured"
+	// NoGitHubAppSecretFoundMessage the message of the legacy error response of a Lighthouse which does not have
+	// the secret of the owner of the repository yet
+	NoGitHubAppSecretFoundMessage = "no github app secret found for owner" // #nosec G101
+
+	// ErrorCodeRepositoryNotConfigured the error code for the legacy repository not configured response
+	ErrorCodeRepositoryNotConfigured = "repository_not_configured"
+	// ErrorCodeNoGitHubAppSecret the error code for the legacy no GitHub App secret response
+	ErrorCodeNoGitHubAppSecret = "no_github_app_secret"
+	// ErrorCodeUnavailable the error code for any other response which is not successful and has no error contract
+	ErrorCodeUnavailable = "unavailable"
+)
+
+// ErrorResponse the versioned JSON body a Lighthouse returns when it cannot accept a webhook, such as:
+//
+//	{"version": 1, "code": "repository_not_configured", "message": "...", "retryable": true, "retryAfter": 10}
+type ErrorResponse struct {
+	// Version the version of the contract which must be ErrorResponseVersion
+	Version int `json:"version"`
+	// Code identifies the error
+	Code string `json:"code"`
+	// Message describes the error
+	Message string `json:"message,omitempty"`
+	// Retryable whether the webhook should be relayed again
+	Retryable bool `json:"retryable"`
+	// RetryAfter the number of seconds to wait before relaying the webhook again, otherwise the Retry-After header
+	// or the exponential backoff is used
+	RetryAfter int `json:"retryAfter,omitempty"`
+}
+
+// Decision how the relay proceeds after a response
+type Decision struct {
+	// Delivered the workspace accepted the webhook
+	Delivered bool
+	// Retryable whether the webhook should be relayed again if it was not delivered
+	Retryable bool
+	// RetryAfter the minimum time to wait before relaying the webhook again, zero uses the exponential backoff
+	RetryAfter time.Duration
+	// Code identifies why the webhook was not delivered
+	Code string
+	// Err describes why the webhook was not delivered
+	Err error
+}
+
+// Decide decides whether the webhook was delivered or should be relayed again. A response which follows the error
+// response contract is used as is, otherwise the legacy messages in the body are recognised and any other
+// unsuccessful response is retried. A Retry-After header is honoured unless the contract specifies the delay.
+func Decide(url string, result *Result, now time.Time) Decision {
+	if result.StatusCode == 0 || (result.StatusCode >= 200 && result.StatusCode < 300) {
+		return Decision{Delivered: true}
+	}
+	retryAfter := parseRetryAfter(result.Header.Get("Retry-After"), now)
+
+	errorResponse := parseErrorResponse(result)
+	if errorResponse != nil {
+		if errorResponse.RetryAfter > 0 {
+			retryAfter = time.Duration(errorResponse.RetryAfter) * time.Second
+		}
+		message := errorResponse.Message
+		if message == "" {
+			message = result.Status
+		}
+		return Decision{
+			Retryable:  errorResponse.Retryable,
+			RetryAfter: retryAfter,
+			Code:       errorResponse.Code,
+			Err:        errors.Errorf("%s returned %s: %s", url, errorResponse.Code, message),
+		}
+	}
+
+	decision := Decision{
+		Retryable:  true,
+		RetryAfter: retryAfter,
+		Code:       ErrorCodeUnavailable,
+		Err:        errors.Errorf("%s not available, error was %s", url, result.Status),
+	}
+	if result.StatusCode == http.StatusInternalServerError {
+		body := string(result.Body)
+		if strings.Contains(body, RepoNotConfiguredMessage) {
+			decision.Code = ErrorCodeRepositoryNotConfigured
+			decision.Err = errors.New("repository not configured in Lighthouse")
+		} else if strings.Contains(body, NoGitHubAppSecretFoundMessage) {
+			decision.Code = ErrorCodeNoGitHubAppSecret
+			decision.Err = errors.New("no github app secret found for owner")
+		}
+	}
+	return decision
+}
+
+// parseErrorResponse returns the error response if the body follows a version of the contract which is understood
+func parseErrorResponse(result *Result) *ErrorResponse {
+	mediaType, _, err := mime.ParseMediaType(result.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return nil
+	}
+	answer := &ErrorResponse{}
+	err = json.Unmarshal(result.Body, answer)
+	if err != nil || answer.Version != ErrorResponseVersion || answer.Code == "" {
+		return nil
+	}
+	return answer
+}
+
+// parseRetryAfter parses a Retry-After header which is either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	t, err := http.ParseTime(value)
+	if err != nil || !t.After(now) {
+		return 0
+	}
+	return t.Sub(now)
+}
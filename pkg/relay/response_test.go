@@ -0,0 +1,107 @@
+package relay
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecide(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	jsonHeader := func(extra ...string) http.Header {
+		h := http.Header{}
+		h.Set("Content-Type", "application/json; charset=utf-8")
+		for i := 0; i+1 < len(extra); i += 2 {
+			h.Set(extra[i], extra[i+1])
+		}
+		return h
+	}
+
+	tests := []struct {
+		name       string
+		result     *Result
+		delivered  bool
+		retryable  bool
+		retryAfter time.Duration
+		code       string
+	}{
+		{
+			name:      "success",
+			result:    &Result{StatusCode: 200, Header: http.Header{}},
+			delivered: true,
+		},
+		{
+			name:      "non HTTP sink",
+			result:    &Result{Sink: FileSinkName},
+			delivered: true,
+		},
+		{
+			name: "contract not retryable",
+			result: &Result{StatusCode: 400, Status: "400 Bad Request", Header: jsonHeader(),
+				Body: []byte(`{"version": 1, "code": "unsupported_event", "message": "no plugin handles the event", "retryable": false}`)},
+			code: "unsupported_event",
+		},
+		{
+			name: "contract retry after",
+			result: &Result{StatusCode: 503, Status: "503 Service Unavailable", Header: jsonHeader("Retry-After", "5"),
+				Body: []byte(`{"version": 1, "code": "repository_not_configured", "retryable": true, "retryAfter": 20}`)},
+			retryable:  true,
+			retryAfter: 20 * time.Second,
+			code:       ErrorCodeRepositoryNotConfigured,
+		},
+		{
+			name: "contract uses header",
+			result: &Result{StatusCode: 429, Status: "429 Too Many Requests", Header: jsonHeader("Retry-After", "Mon, 01 Jun 2020 12:00:30 GMT"),
+				Body: []byte(`{"version": 1, "code": "rate_limited", "retryable": true}`)},
+			retryable:  true,
+			retryAfter: 30 * time.Second,
+			code:       "rate_limited",
+		},
+		{
+			name: "unknown contract version falls back",
+			result: &Result{StatusCode: 500, Status: "500 Internal Server Error", Header: jsonHeader(),
+				Body: []byte(`{"version": 2, "code": "unsupported_event", "retryable": false}`)},
+			retryable: true,
+			code:      ErrorCodeUnavailable,
+		},
+		{
+			name:      "legacy repository not configured",
+			result:    &Result{StatusCode: 500, Status: "500 Internal Server Error", Header: http.Header{}, Body: []byte(RepoNotConfiguredMessage)},
+			retryable: true,
+			code:      ErrorCodeRepositoryNotConfigured,
+		},
+		{
+			name:      "legacy no secret",
+			result:    &Result{StatusCode: 500, Status: "500 Internal Server Error", Header: http.Header{}, Body: []byte(NoGitHubAppSecretFoundMessage + " cloudbees")},
+			retryable: true,
+			code:      ErrorCodeNoGitHubAppSecret,
+		},
+		{
+			name:       "legacy other error with retry after",
+			result:     &Result{StatusCode: 502, Status: "502 Bad Gateway", Header: jsonHeader("Retry-After", "3"), Body: []byte("not ok")},
+			retryable:  true,
+			retryAfter: 3 * time.Second,
+			code:       ErrorCodeUnavailable,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			decision := Decide("http://lighthouse/hook", tc.result, now)
+			assert.Equal(t, tc.delivered, decision.Delivered)
+			assert.Equal(t, tc.retryable, decision.Retryable)
+			assert.Equal(t, tc.retryAfter, decision.RetryAfter)
+			assert.Equal(t, tc.code, decision.Code)
+			if tc.delivered {
+				assert.NoError(t, decision.Err)
+			} else {
+				assert.Error(t, decision.Err)
+			}
+		})
+	}
+}
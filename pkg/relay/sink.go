@@ -0,0 +1,165 @@
+package relay
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Event a signed webhook to relay to a workspace
+type Event struct {
+	// Type the GitHub event type
+	Type string
+	// Delivery the GitHub delivery ID
+	Delivery string
+	// Source the URL of the repository the event is about
+	Source string
+	// Installation the ID of the GitHub App installation which received the event
+	Installation int64
+	// Bot the event was sent by the bot of the GitHub App
+	Bot bool
+	// Forwarded the headers of the webhook request from GitHub which are forwarded
+	Forwarded http.Header
+	// Hop the number of relays the event has passed through including this one
+	Hop int
+	// ReceivedAt when the event was received from GitHub
+	ReceivedAt time.Time
+	// Headers the headers to relay including the signature
+	Headers http.Header
+	// Body the webhook payload
+	Body []byte
+}
+
+// Target the workspace an event is relayed to
+type Target struct {
+	// Workspace the project of the workspace
+	Workspace string
+	// URL the URL whose scheme selects the sink
+	URL string
+	// TLS the TLS settings used by sinks which connect over TLS
+	TLS TLSProfile
+}
+
+// Result the result of delivering an event
+type Result struct {
+	// Sink the name of the sink which delivered the event
+	Sink string
+	// StatusCode the HTTP status code for sinks which use HTTP
+	StatusCode int
+	// Status the HTTP status for sinks which use HTTP
+	Status string
+	// Header the response headers for sinks which use HTTP
+	Header http.Header
+	// Body the start of the response body for sinks which use HTTP
+	Body []byte
+	// Duration how long the delivery took
+	Duration time.Duration
+}
+
+// Sink delivers events to workspaces. An error is returned if the event could not be handed over, otherwise the
+// result describes the response of the workspace.
+type Sink interface {
+	// Name returns the name of the sink used in logs and results
+	Name() string
+
+	// Deliver delivers the event to the target
+	Deliver(ctx context.Context, event *Event, target *Target) (*Result, error)
+}
+
+// Closer is implemented by sinks which hold connections that should be closed on shutdown
+type Closer interface {
+	Close() error
+}
+
+// permanentError an error which will not go away by retrying the delivery
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Permanent marks the error as one which will not go away by retrying the delivery such as invalid configuration
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent returns true if retrying the delivery will not help
+func IsPermanent(err error) bool {
+	_, ok := err.(*permanentError)
+	return ok
+}
+
+// Sinks selects the sink for each target by the scheme of its URL
+type Sinks struct {
+	lock  sync.RWMutex
+	sinks map[string]Sink
+}
+
+// NewSinks creates a new set of sinks
+func NewSinks() *Sinks {
+	return &Sinks{
+		sinks: map[string]Sink{},
+	}
+}
+
+// Register registers the sink for the URL scheme
+func (s *Sinks) Register(scheme string, sink Sink) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sinks[strings.ToLower(scheme)] = sink
+}
+
+// For returns the sink for the URL
+func (s *Sinks) For(rawURL string) (Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the relay URL %s", rawURL)
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	sink := s.sinks[strings.ToLower(u.Scheme)]
+	if sink == nil {
+		return nil, errors.Errorf("no sink supports the scheme '%s' of the relay URL %s", u.Scheme, rawURL)
+	}
+	return sink, nil
+}
+
+// Schemes returns the sorted schemes which have a sink
+func (s *Sinks) Schemes() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	answer := []string{}
+	for scheme := range s.sinks {
+		answer = append(answer, scheme)
+	}
+	sort.Strings(answer)
+	return answer
+}
+
+// Close closes the sinks which hold connections
+func (s *Sinks) Close() error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	closed := map[Sink]bool{}
+	var answer error
+	for _, sink := range s.sinks {
+		closer, ok := sink.(Closer)
+		if !ok || closed[sink] {
+			continue
+		}
+		closed[sink] = true
+		err := closer.Close()
+		if err != nil && answer == nil {
+			answer = errors.Wrapf(err, "failed to close the %s sink", sink.Name())
+		}
+	}
+	return answer
+}
@@ -0,0 +1,206 @@
+package relay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent() *Event {
+	headers := http.Header{}
+	headers.Set("X-GitHub-Event", "push")
+	headers.Set("X-GitHub-Delivery", "f2467dea-70d6-11e8-8955-3c83993e0aef")
+	headers.Set("X-Hub-Signature", "sha256=1234")
+	return &Event{
+		Type:     "push",
+		Delivery: "f2467dea-70d6-11e8-8955-3c83993e0aef",
+		Headers:  headers,
+		Body:     []byte(`{"ref":"refs/heads/main"}`),
+	}
+}
+
+func TestSinksSelectByScheme(t *testing.T) {
+	t.Parallel()
+
+	sinks := NewSinks()
+	httpSink := &HTTPSink{}
+	sinks.Register("http", httpSink)
+	sinks.Register("https", httpSink)
+	sinks.Register("file", &FileSink{})
+
+	sink, err := sinks.For("HTTPS://lighthouse.example.com/hook")
+	require.NoError(t, err)
+	assert.Equal(t, HTTPSinkName, sink.Name())
+
+	sink, err = sinks.For("file:///audit.jsonl")
+	require.NoError(t, err)
+	assert.Equal(t, FileSinkName, sink.Name())
+
+	_, err = sinks.For("ftp://example.com")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"file", "http", "https"}, sinks.Schemes())
+}
+
+func TestHTTPSink(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "push", r.Header.Get("X-GitHub-Event"))
+		assert.Equal(t, "sha256=1234", r.Header.Get("X-Hub-Signature"))
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"ref":"refs/heads/main"}`, string(body))
+		w.WriteHeader(http.StatusInternalServerError)
+		_, err = w.Write([]byte("repository not configured"))
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+
+	clients, err := NewClientFactory(Options{})
+	require.NoError(t, err)
+	sink := &HTTPSink{Clients: clients}
+	result, err := sink.Deliver(context.Background(), testEvent(), &Target{Workspace: "cbjx-mycluster", URL: server.URL})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, result.StatusCode)
+	assert.Equal(t, "repository not configured", string(result.Body))
+
+	_, err = (&HTTPSink{Clients: clients}).Deliver(context.Background(), testEvent(), &Target{URL: server.URL, TLS: TLSProfile{CAFile: "missing.pem"}})
+	require.Error(t, err)
+	assert.True(t, IsPermanent(err))
+}
+
+func TestFileSink(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "sink")
+	require.NoError(t, err)
+	sink := &FileSink{Dir: dir}
+	target := &Target{Workspace: "cbjx-mycluster", URL: "file:///audit/mycluster.jsonl"}
+
+	for i := 0; i < 2; i++ {
+		result, err := sink.Deliver(context.Background(), testEvent(), target)
+		require.NoError(t, err)
+		assert.Equal(t, FileSinkName, result.Sink)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "audit", "mycluster.jsonl"))
+	require.NoError(t, err)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	records := []Record{}
+	for scanner.Scan() {
+		record := Record{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.Len(t, records, 2)
+	assert.Equal(t, "cbjx-mycluster", records[0].Workspace)
+	assert.Equal(t, "push", records[0].Event)
+	assert.Equal(t, []string{"sha256=1234"}, records[0].Headers["X-Hub-Signature"])
+	assert.JSONEq(t, `{"ref":"refs/heads/main"}`, string(records[0].Body))
+
+	// paths cannot escape the directory
+	_, err = sink.Deliver(context.Background(), testEvent(), &Target{URL: "file:///../../etc/passwd"})
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "etc", "passwd"))
+	assert.NoError(t, err)
+
+	_, err = (&FileSink{}).Deliver(context.Background(), testEvent(), target)
+	require.Error(t, err)
+	assert.True(t, IsPermanent(err), "the file sink should be disabled without a directory")
+}
+
+func TestNATSSink(t *testing.T) {
+	t.Parallel()
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	server := test.RunServer(&opts)
+	defer server.Shutdown()
+
+	nc, err := nats.Connect(server.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+	messages := make(chan *nats.Msg, 10)
+	_, err = nc.ChanSubscribe("lighthouse.webhooks.cbjx-mycluster", messages)
+	require.NoError(t, err)
+	require.NoError(t, nc.Flush())
+
+	sink := &NATSSink{Timeout: 5 * time.Second, Servers: []string{natsHost(t, server.ClientURL())}}
+	defer sink.Close()
+	result, err := sink.Deliver(context.Background(), testEvent(), &Target{Workspace: "cbjx-mycluster", URL: server.ClientURL()})
+	require.NoError(t, err)
+	assert.Equal(t, NATSSinkName, result.Sink)
+
+	select {
+	case msg := <-messages:
+		record := Record{}
+		require.NoError(t, json.Unmarshal(msg.Data, &record))
+		assert.Equal(t, "f2467dea-70d6-11e8-8955-3c83993e0aef", record.Delivery)
+		assert.Equal(t, []string{"push"}, record.Headers["X-Github-Event"])
+		assert.JSONEq(t, `{"ref":"refs/heads/main"}`, string(record.Body))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+
+	_, err = sink.Deliver(context.Background(), testEvent(), &Target{URL: "nats:///no-host"})
+	require.Error(t, err)
+	assert.True(t, IsPermanent(err))
+}
+
+func natsHost(t *testing.T, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	return u.Host
+}
+
+func TestNATSSinkOnlyPublishesToTheConfiguredServers(t *testing.T) {
+	t.Parallel()
+
+	sink := &NATSSink{}
+	_, err := sink.Deliver(context.Background(), testEvent(), &Target{URL: "nats://nats.example.com:4222"})
+	require.Error(t, err)
+	assert.True(t, IsPermanent(err), "the NATS sink should be disabled without servers")
+
+	sink = &NATSSink{Servers: []string{"nats.example.com:4222"}}
+	_, err = sink.Deliver(context.Background(), testEvent(), &Target{URL: "nats://10.0.0.1:4222"})
+	require.Error(t, err)
+	assert.True(t, IsPermanent(err), "a server which is not configured should not be published to")
+}
+
+func TestNATSSinkClosesTheLeastRecentlyUsedConnection(t *testing.T) {
+	t.Parallel()
+
+	var urls []string
+	for i := 0; i < 2; i++ {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		server := test.RunServer(&opts)
+		defer server.Shutdown()
+		urls = append(urls, server.ClientURL())
+	}
+
+	sink := &NATSSink{Timeout: 5 * time.Second, Servers: []string{natsHost(t, urls[0]), natsHost(t, urls[1])}, MaxConnections: 1}
+	defer sink.Close()
+	_, err := sink.Deliver(context.Background(), testEvent(), &Target{Workspace: "cbjx-mycluster", URL: urls[0]})
+	require.NoError(t, err)
+	first := sink.connections[urls[0]].conn
+	_, err = sink.Deliver(context.Background(), testEvent(), &Target{Workspace: "cbjx-mycluster", URL: urls[1]})
+	require.NoError(t, err)
+
+	assert.Len(t, sink.connections, 1)
+	assert.True(t, first.IsClosed(), "the least recently used connection should be closed")
+}
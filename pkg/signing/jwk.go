@@ -0,0 +1,113 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// JWSAlgorithmEdDSA the JWS algorithm of Ed25519 signatures
+	JWSAlgorithmEdDSA = "EdDSA"
+	// JWSAlgorithmES256 the JWS algorithm of ECDSA P-256 signatures with SHA-256
+	JWSAlgorithmES256 = "ES256"
+)
+
+// JWK a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+// JWKS a set of public keys in JSON Web Key Set format
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// newJWK returns the JWK of the public key identified by its RFC 7638 thumbprint so that the key ID is the same on
+// every replica which has the key
+func newJWK(public crypto.PublicKey) (JWK, error) {
+	var jwk JWK
+	switch k := public.(type) {
+	case ed25519.PublicKey:
+		jwk = JWK{Kty: "OKP", Crv: "Ed25519", X: encode(k), Alg: JWSAlgorithmEdDSA}
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return jwk, errors.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+		}
+		jwk = JWK{Kty: "EC", Crv: "P-256", X: encode(pad(k.X, 32)), Y: encode(pad(k.Y, 32)), Alg: JWSAlgorithmES256}
+	default:
+		return jwk, errors.Errorf("unsupported public key type %T", public)
+	}
+	jwk.Use = "sig"
+
+	// the members of the thumbprint are in lexicographic order
+	members := map[string]string{"crv": jwk.Crv, "kty": jwk.Kty, "x": jwk.X}
+	if jwk.Y != "" {
+		members["y"] = jwk.Y
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return jwk, err
+	}
+	sum := sha256.Sum256(data)
+	jwk.Kid = encode(sum[:])
+	return jwk, nil
+}
+
+// PublicKey returns the public key of the JWK
+func (k *JWK) PublicKey() (crypto.PublicKey, error) {
+	x, err := decode(k.X)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid x of key %s", k.Kid)
+	}
+	switch {
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.Errorf("invalid Ed25519 key %s", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid y of key %s", k.Kid)
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !public.Curve.IsOnCurve(public.X, public.Y) {
+			return nil, errors.Errorf("the key %s is not on the P-256 curve", k.Kid)
+		}
+		return public, nil
+	}
+	return nil, errors.Errorf("unsupported key type %s and curve %s of key %s", k.Kty, k.Crv, k.Kid)
+}
+
+// pad returns the big endian bytes of the integer left padded to the size
+func pad(i *big.Int, size int) []byte {
+	data := i.Bytes()
+	if len(data) >= size {
+		return data
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(data):], data)
+	return padded
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(text string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(text)
+}
@@ -0,0 +1,333 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hmac"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// AlgorithmEd25519 signs the relayed webhooks with Ed25519 keys
+	AlgorithmEd25519 = "Ed25519"
+	// AlgorithmES256 signs the relayed webhooks with ECDSA P-256 keys
+	AlgorithmES256 = "ES256"
+
+	// HeaderKeyID the header of the ID of the key in the JWKS which signed the webhook
+	HeaderKeyID = "X-Lighthouse-Key-ID"
+	// HeaderSignature the header of the asymmetric signature of the timestamp, delivery ID and body in the format
+	// <JWS algorithm>=<base64url signature>
+	HeaderSignature = "X-Lighthouse-Asymmetric-Signature"
+
+	// DefaultRotationInterval how often the generated signing key is replaced
+	DefaultRotationInterval = 24 * time.Hour
+	// DefaultReloadInterval how often the key directory is checked for new keys
+	DefaultReloadInterval = time.Minute
+)
+
+// Options the options of the signing keys
+type Options struct {
+	// Algorithm the algorithm of the generated keys which is either Ed25519 or ES256
+	Algorithm string
+	// RotationInterval how often a new key is generated. The previous key is published for another interval so that
+	// webhooks signed with it and cached key sets can still be verified.
+	RotationInterval time.Duration
+	// KeyDir a directory of PEM encoded private keys, such as a mounted secret shared by every replica, which are
+	// used rather than generated keys. The most recently modified key signs and every key is published.
+	KeyDir string
+	// ReloadInterval how often the key directory is checked for new keys
+	ReloadInterval time.Duration
+}
+
+// KeySet the keys which sign the relayed webhooks and whose public keys are published as a JWKS so that workspaces
+// can verify relayed webhooks without sharing a secret
+type KeySet struct {
+	options   Options
+	now       func() time.Time
+	lock      sync.Mutex
+	keys      []*key
+	checkedAt time.Time
+	modTime   time.Time
+}
+
+type key struct {
+	jwk      JWK
+	signer   crypto.Signer
+	created  time.Time
+	retireAt time.Time
+}
+
+// NewKeySet creates the signing keys either loading them from the key directory or generating the first key
+func NewKeySet(options Options) (*KeySet, error) {
+	if options.RotationInterval <= 0 {
+		options.RotationInterval = DefaultRotationInterval
+	}
+	if options.ReloadInterval <= 0 {
+		options.ReloadInterval = DefaultReloadInterval
+	}
+	s := &KeySet{
+		options: options,
+		now:     time.Now,
+	}
+	if options.KeyDir != "" {
+		return s, s.load()
+	}
+	if options.Algorithm != AlgorithmEd25519 && options.Algorithm != AlgorithmES256 {
+		return nil, errors.Errorf("unsupported signing algorithm %q which must be either %s or %s", options.Algorithm, AlgorithmEd25519, AlgorithmES256)
+	}
+	return s, s.rotate()
+}
+
+// Sign sets the headers of the asymmetric signature of the timestamp, delivery ID and body of a request. The
+// delivery ID is taken from the X-GitHub-Delivery header which must already be set.
+func (s *KeySet) Sign(headers http.Header, timestamp time.Time, body []byte) error {
+	k, err := s.current()
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	signature, err := sign(k, hmac.SignedContent(ts, headers.Get(hmac.HeaderDelivery), body))
+	if err != nil {
+		return errors.Wrapf(err, "failed to sign with key %s", k.jwk.Kid)
+	}
+	headers.Set(hmac.HeaderTimestamp, ts)
+	headers.Set(HeaderKeyID, k.jwk.Kid)
+	headers.Set(HeaderSignature, k.jwk.Alg+"="+encode(signature))
+	return nil
+}
+
+// JWKS returns the public keys which verify the relayed webhooks, the current key first
+func (s *KeySet) JWKS() *JWKS {
+	_, err := s.current()
+	if err != nil {
+		logrus.WithError(err).Warn("failed to refresh the signing keys")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	answer := &JWKS{Keys: []JWK{}}
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		answer.Keys = append(answer.Keys, s.keys[i].jwk)
+	}
+	return answer
+}
+
+// ServeHTTP serves the JWKS
+func (s *KeySet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := json.Marshal(s.JWKS())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_, err = w.Write(data)
+	if err != nil {
+		logrus.WithError(err).Debug("failed to write the JWKS")
+	}
+}
+
+// current returns the key which signs, rotating the generated keys or reloading the key directory if required
+func (s *KeySet) current() (*key, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := s.now()
+	if s.options.KeyDir != "" {
+		if now.Sub(s.checkedAt) >= s.options.ReloadInterval {
+			err := s.reload()
+			if err != nil {
+				logrus.WithError(err).Warnf("failed to reload the signing keys from %s so using the previous keys", s.options.KeyDir)
+			}
+		}
+	} else if now.Sub(s.keys[len(s.keys)-1].created) >= s.options.RotationInterval {
+		err := s.generate()
+		if err != nil {
+			logrus.WithError(err).Warn("failed to rotate the signing key so using the previous key")
+		}
+	}
+	if len(s.keys) == 0 {
+		return nil, errors.Errorf("no signing keys in %s", s.options.KeyDir)
+	}
+	return s.keys[len(s.keys)-1], nil
+}
+
+// rotate generates a new signing key
+func (s *KeySet) rotate() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.generate()
+}
+
+// generate generates a new key which signs from now on and retires the previous keys after another interval
+func (s *KeySet) generate() error {
+	var signer crypto.Signer
+	var err error
+	if s.options.Algorithm == AlgorithmES256 {
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	} else {
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to generate %s key", s.options.Algorithm)
+	}
+	jwk, err := newJWK(signer.Public())
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	keys := []*key{}
+	for _, k := range s.keys {
+		if k.retireAt.IsZero() {
+			k.retireAt = now.Add(s.options.RotationInterval)
+		}
+		if now.Before(k.retireAt) {
+			keys = append(keys, k)
+		}
+	}
+	s.keys = append(keys, &key{jwk: jwk, signer: signer, created: now})
+	logrus.Infof("generated the %s signing key %s", s.options.Algorithm, jwk.Kid)
+	return nil
+}
+
+// load loads the keys from the key directory
+func (s *KeySet) load() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.reload()
+	if err == nil && len(s.keys) == 0 {
+		err = errors.Errorf("no signing keys in %s", s.options.KeyDir)
+	}
+	return err
+}
+
+// reload loads the keys from the key directory if any of the files have changed
+func (s *KeySet) reload() error {
+	s.checkedAt = s.now()
+	fileNames, err := filepath.Glob(filepath.Join(s.options.KeyDir, "*.pem"))
+	if err != nil {
+		return errors.Wrapf(err, "failed to list the keys in %s", s.options.KeyDir)
+	}
+	type file struct {
+		name    string
+		modTime time.Time
+	}
+	files := []file{}
+	latest := time.Time{}
+	for _, fileName := range fileNames {
+		info, err := os.Stat(fileName)
+		if err != nil {
+			return errors.Wrapf(err, "failed to stat %s", fileName)
+		}
+		files = append(files, file{name: fileName, modTime: info.ModTime()})
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	if len(files) == len(s.keys) && latest.Equal(s.modTime) {
+		return nil
+	}
+	// the most recently modified key signs so it is last
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].modTime.Equal(files[j].modTime) {
+			return files[i].name < files[j].name
+		}
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	keys := []*key{}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f.name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read the signing key %s", f.name)
+		}
+		signer, err := parsePrivateKey(data)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse the signing key %s", f.name)
+		}
+		jwk, err := newJWK(signer.Public())
+		if err != nil {
+			return errors.Wrapf(err, "unsupported signing key %s", f.name)
+		}
+		keys = append(keys, &key{jwk: jwk, signer: signer, created: f.modTime})
+	}
+	s.keys = keys
+	s.modTime = latest
+	if len(keys) > 0 {
+		logrus.Infof("loaded %d signing keys from %s signing with %s", len(keys), s.options.KeyDir, keys[len(keys)-1].jwk.Kid)
+	}
+	return nil
+}
+
+// parsePrivateKey parses a PEM encoded PKCS #8 Ed25519 or ECDSA private key or a SEC 1 ECDSA private key
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	if block.Type == "EC PRIVATE KEY" {
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	}
+	return nil, errors.Errorf("unsupported private key type %T which must be Ed25519 or ECDSA", parsed)
+}
+
+// sign signs the content with the key using the encoding of its JWS algorithm
+func sign(k *key, content []byte) ([]byte, error) {
+	switch signer := k.signer.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(signer, content), nil
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(content)
+		r, s, err := ecdsa.Sign(rand.Reader, signer, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// JWS encodes an ECDSA signature as the fixed size r and s
+		return append(pad(r, 32), pad(s, 32)...), nil
+	}
+	return nil, errors.Errorf("unsupported signing key type %T", k.signer)
+}
+
+// verify verifies the signature of the content with the public key using the encoding of its JWS algorithm
+func verify(public crypto.PublicKey, content []byte, signature []byte) bool {
+	switch k := public.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, content, signature)
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(content)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(k, digest[:], r, s)
+	}
+	return false
+}
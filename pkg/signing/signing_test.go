@@ -0,0 +1,160 @@
+package signing
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hmac"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"action":"opened"}`)
+	for _, algorithm := range []string{AlgorithmEd25519, AlgorithmES256} {
+		keys, err := NewKeySet(Options{Algorithm: algorithm})
+		require.NoError(t, err, algorithm)
+
+		headers := http.Header{}
+		headers.Set(hmac.HeaderDelivery, "f2467dea-70d6-11e8-8955-3c83993e0aef")
+		require.NoError(t, keys.Sign(headers, time.Now(), body), algorithm)
+		assert.Equal(t, keys.JWKS().Keys[0].Kid, headers.Get(HeaderKeyID), algorithm)
+
+		verifier, err := NewVerifier(keys.JWKS(), 0)
+		require.NoError(t, err, algorithm)
+		assert.NoError(t, verifier.VerifyRequest(headers, body), algorithm)
+		assert.Equal(t, hmac.ErrReplayed, errors.Cause(verifier.VerifyRequest(headers, body)), algorithm)
+
+		retry := http.Header{}
+		retry.Set(hmac.HeaderDelivery, headers.Get(hmac.HeaderDelivery))
+		require.NoError(t, keys.Sign(retry, time.Now().Add(2*time.Second), body), algorithm)
+		assert.NoError(t, verifier.VerifyRequest(retry, body), "a retry of the delivery is signed with a new timestamp")
+
+		verifier, err = NewVerifier(keys.JWKS(), 0)
+		require.NoError(t, err, algorithm)
+		assert.Equal(t, ErrSignatureInvalid, errors.Cause(verifier.VerifyRequest(headers, []byte(`{"action":"closed"}`))), algorithm)
+
+		tampered := http.Header{}
+		for name := range headers {
+			tampered.Set(name, headers.Get(name))
+		}
+		tampered.Set(HeaderKeyID, "unknown")
+		assert.Equal(t, ErrUnknownKey, errors.Cause(verifier.VerifyRequest(tampered, body)), algorithm)
+
+		headers.Set(hmac.HeaderDelivery, "another")
+		require.NoError(t, keys.Sign(headers, time.Now().Add(-time.Hour), body), algorithm)
+		assert.Equal(t, hmac.ErrTimestampSkew, errors.Cause(verifier.VerifyRequest(headers, body)), algorithm)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	keys, err := NewKeySet(Options{Algorithm: AlgorithmEd25519, RotationInterval: time.Hour})
+	require.NoError(t, err)
+	now := time.Now()
+	keys.now = func() time.Time {
+		return now
+	}
+	first := keys.JWKS().Keys[0].Kid
+
+	now = now.Add(61 * time.Minute)
+	jwks := keys.JWKS()
+	require.Len(t, jwks.Keys, 2, "the previous key should still be published")
+	second := jwks.Keys[0].Kid
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, first, jwks.Keys[1].Kid)
+
+	headers := http.Header{}
+	headers.Set(hmac.HeaderDelivery, "f2467dea-70d6-11e8-8955-3c83993e0aef")
+	require.NoError(t, keys.Sign(headers, now, nil))
+	assert.Equal(t, second, headers.Get(HeaderKeyID))
+
+	now = now.Add(61 * time.Minute)
+	jwks = keys.JWKS()
+	require.Len(t, jwks.Keys, 2, "the retired key should no longer be published")
+	assert.Equal(t, second, jwks.Keys[1].Kid)
+}
+
+func TestKeyDir(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "signing-keys")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	data, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	writeKey(t, filepath.Join(dir, "old.pem"), "PRIVATE KEY", data, time.Now().Add(-time.Hour))
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	data, err = x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	writeKey(t, filepath.Join(dir, "new.pem"), "EC PRIVATE KEY", data, time.Now())
+
+	keys, err := NewKeySet(Options{KeyDir: dir})
+	require.NoError(t, err)
+	another, err := NewKeySet(Options{KeyDir: dir})
+	require.NoError(t, err)
+	assert.Equal(t, keys.JWKS(), another.JWKS(), "every replica should publish the same key IDs")
+
+	jwks := keys.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, JWSAlgorithmES256, jwks.Keys[0].Alg, "the most recently modified key should sign")
+	assert.Equal(t, JWSAlgorithmEdDSA, jwks.Keys[1].Alg)
+
+	headers := http.Header{}
+	headers.Set(hmac.HeaderDelivery, "f2467dea-70d6-11e8-8955-3c83993e0aef")
+	require.NoError(t, keys.Sign(headers, time.Now(), []byte(`{}`)))
+	assert.Equal(t, jwks.Keys[0].Kid, headers.Get(HeaderKeyID))
+
+	empty, err := ioutil.TempDir("", "signing-keys")
+	require.NoError(t, err)
+	defer os.RemoveAll(empty)
+	_, err = NewKeySet(Options{KeyDir: empty})
+	assert.Error(t, err)
+}
+
+func TestFetchJWKS(t *testing.T) {
+	t.Parallel()
+
+	keys, err := NewKeySet(Options{Algorithm: AlgorithmES256})
+	require.NoError(t, err)
+	server := httptest.NewServer(keys)
+	defer server.Close()
+
+	jwks, err := FetchJWKS(context.Background(), server.Client(), server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, keys.JWKS(), jwks)
+
+	verifier, err := NewVerifier(jwks, 0)
+	require.NoError(t, err)
+	headers := http.Header{}
+	headers.Set(hmac.HeaderDelivery, "f2467dea-70d6-11e8-8955-3c83993e0aef")
+	require.NoError(t, keys.Sign(headers, time.Now(), []byte(`{}`)))
+	assert.NoError(t, verifier.VerifyRequest(headers, []byte(`{}`)))
+}
+
+func writeKey(t *testing.T, fileName string, blockType string, data []byte, modTime time.Time) {
+	err := ioutil.WriteFile(fileName, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0600)
+	require.NoError(t, err)
+	require.NoError(t, os.Chtimes(fileName, modTime, modTime))
+}
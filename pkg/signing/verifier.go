@@ -0,0 +1,101 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudbees/lighthouse-githubapp/pkg/hmac"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUnknownKey returned when the key which signed the request is not in the JWKS
+	ErrUnknownKey = errors.New("the signing key is not in the JWKS")
+	// ErrSignatureInvalid returned when the asymmetric signature does not match the request
+	ErrSignatureInvalid = errors.New("the asymmetric signature is invalid")
+)
+
+// Verifier verifies the asymmetric signatures of relayed webhooks with the public keys of a JWKS rejecting requests
+// whose timestamp is outside of the clock skew window or which were already verified within the window
+type Verifier struct {
+	keys  map[string]crypto.PublicKey
+	guard *hmac.ReplayGuard
+}
+
+// NewVerifier creates a verifier of the keys in the JWKS with the clock skew window defaulting to hmac.DefaultSkew
+func NewVerifier(jwks *JWKS, skew time.Duration) (*Verifier, error) {
+	v := &Verifier{
+		keys:  map[string]crypto.PublicKey{},
+		guard: hmac.NewReplayGuard(skew),
+	}
+	for i := range jwks.Keys {
+		public, err := jwks.Keys[i].PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		v.keys[jwks.Keys[i].Kid] = public
+	}
+	return v, nil
+}
+
+// FetchJWKS fetches the JWKS published by the relay at the URL
+func FetchJWKS(ctx context.Context, client *http.Client, url string) (*JWKS, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the request for %s", url)
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch the JWKS from %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to fetch the JWKS from %s with status %d", url, resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1000000))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the JWKS from %s", url)
+	}
+	jwks := &JWKS{}
+	err = json.Unmarshal(data, jwks)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the JWKS from %s", url)
+	}
+	return jwks, nil
+}
+
+// VerifyRequest verifies the asymmetric signature headers of a request
+func (v *Verifier) VerifyRequest(headers http.Header, body []byte) error {
+	delivery := headers.Get(hmac.HeaderDelivery)
+	if delivery == "" {
+		return errors.Wrap(ErrSignatureInvalid, "missing delivery ID")
+	}
+	kid := headers.Get(HeaderKeyID)
+	public, ok := v.keys[kid]
+	if !ok {
+		return errors.Wrapf(ErrUnknownKey, "key %q", kid)
+	}
+	timestamp := headers.Get(hmac.HeaderTimestamp)
+	signedAt, err := hmac.ParseTimestamp(timestamp)
+	if err != nil {
+		return errors.Wrapf(ErrSignatureInvalid, "invalid timestamp %q", timestamp)
+	}
+	parts := strings.SplitN(headers.Get(HeaderSignature), "=", 2)
+	if len(parts) != 2 {
+		return errors.Wrap(ErrSignatureInvalid, "the signature must be in the format <algorithm>=<signature>")
+	}
+	signature, err := decode(parts[1])
+	if err != nil {
+		return errors.Wrap(ErrSignatureInvalid, "the signature is not base64url encoded")
+	}
+	if !verify(public, hmac.SignedContent(timestamp, delivery, body), signature) {
+		return ErrSignatureInvalid
+	}
+	return v.guard.Check(delivery, signedAt)
+}
@@ -34,3 +34,8 @@ func (t *fakeTenantService) FindWorkspaces(ctx context.Context, log *logrus.Entr
 func (t *fakeTenantService) GetGithubAppToken(ctx context.Context, log *logrus.Entry, installationID int64) (*domain.InstallationToken, error) {
 	return &domain.InstallationToken{}, nil
 }
+
+// Ping checks the tenant service is reachable
+func (t *fakeTenantService) Ping(ctx context.Context, log *logrus.Entry) error {
+	return nil
+}
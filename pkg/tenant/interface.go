@@ -13,4 +13,5 @@ type TenantService interface {
 	AppUnnstall(ctx context.Context, log *logrus.Entry, installationID int64) error
 	FindWorkspaces(ctx context.Context, log *logrus.Entry, installationID int64, gitURL string) ([]*access.WorkspaceAccess, error)
 	GetGithubAppToken(ctx context.Context, log *logrus.Entry, installationID int64) (*domain.InstallationToken, error)
+	Ping(ctx context.Context, log *logrus.Entry) error
 }
@@ -3,6 +3,8 @@ package tenant
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
 
 	"github.com/cloudbees/jx-tenant-service/pkg/access"
 	"github.com/cloudbees/jx-tenant-service/pkg/client"
@@ -96,6 +98,29 @@ func (t *tenantService) GetGithubAppToken(ctx context.Context, log *logrus.Entry
 	return clientutils.ToInstallationToken(gitToken), nil
 }
 
+// Ping checks the tenant service is reachable
+func (t *tenantService) Ping(ctx context.Context, log *logrus.Entry) error {
+	u := url.URL{Scheme: t.client.Scheme, Host: t.client.Host, Path: "/"}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create request for %s", u.String())
+	}
+	resp, err := t.client.Do(ctx, req)
+	if err != nil {
+		err = errors.Wrapf(err, "failed to reach the tenant service at %s", u.String())
+		log.WithError(err).Debug(err.Error())
+		return err
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		log.WithError(err).Debug("failed to close the response body")
+	}
+	if resp.StatusCode >= 500 {
+		return errors.Errorf("tenant service at %s returned %s", u.String(), resp.Status)
+	}
+	return nil
+}
+
 func installationPath(installationID int64) string {
 	return client.CreateGitHubAppInstallGithubAppPath(model.Int64ToA(installationID))
 }
@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// datadogTracer traces using the Datadog agent. Incoming requests are already traced by the
+// Datadog gorilla mux router so the middleware is a no-op
+type datadogTracer struct{}
+
+type datadogSpan struct {
+	span tracer.Span
+	err  error
+}
+
+func newDatadogTracer() *datadogTracer {
+	tracer.Start()
+	return &datadogTracer{}
+}
+
+func (t *datadogTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	span, ctx := tracer.StartSpanFromContext(ctx, name)
+	return ctx, &datadogSpan{span: span}
+}
+
+func (t *datadogTracer) Inject(ctx context.Context, header http.Header) {
+	span, exists := tracer.SpanFromContext(ctx)
+	if !exists {
+		return
+	}
+	err := tracer.Inject(span.Context(), tracer.HTTPHeadersCarrier(header))
+	if err != nil {
+		logrus.WithError(err).Debug("failed to inject the trace context")
+	}
+}
+
+func (t *datadogTracer) Middleware(next http.Handler) http.Handler {
+	return next
+}
+
+func (t *datadogTracer) LogFields(ctx context.Context) logrus.Fields {
+	if ctx != nil {
+		span, exists := tracer.SpanFromContext(ctx)
+		if exists && span.Context().TraceID() != 0 {
+			return logrus.Fields{
+				"dd.trace_id": span.Context().TraceID(),
+				"dd.span_id":  span.Context().SpanID(),
+			}
+		}
+	}
+	// add a field to indicate that this logger doesn't have any context, and thus no traceID/spanID
+	return logrus.Fields{"dd.no_trace": ""}
+}
+
+func (t *datadogTracer) Shutdown(ctx context.Context) error {
+	tracer.Stop()
+	return nil
+}
+
+func (s *datadogSpan) SetAttribute(key string, value interface{}) {
+	s.span.SetTag(key, value)
+}
+
+func (s *datadogSpan) RecordError(err error) {
+	s.err = err
+}
+
+func (s *datadogSpan) End() {
+	if s.err != nil {
+		s.span.Finish(tracer.WithError(s.err))
+		return
+	}
+	s.span.Finish()
+}
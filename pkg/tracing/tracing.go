@@ -0,0 +1,155 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ServiceName the name of this service used by the tracing backends
+	ServiceName = "lighthouse-githubapp"
+
+	// ExporterNone disables tracing
+	ExporterNone = ""
+	// ExporterDatadog traces using the Datadog agent
+	ExporterDatadog = "datadog"
+	// ExporterOTLP traces using an OpenTelemetry OTLP collector
+	ExporterOTLP = "otlp"
+)
+
+// Span represents a unit of work within a trace
+type Span interface {
+	// SetAttribute adds the key value pair to the span
+	SetAttribute(key string, value interface{})
+
+	// RecordError marks the span as failed with the given error
+	RecordError(err error)
+
+	// End completes the span
+	End()
+}
+
+// Tracer abstracts the tracing backend so that we can switch between Datadog and OpenTelemetry
+type Tracer interface {
+	// StartSpan starts a new span as a child of any span in the context
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+
+	// Inject adds the trace context headers of the current span to the outgoing request headers
+	Inject(ctx context.Context, header http.Header)
+
+	// Middleware extracts the trace context of incoming requests and starts a server span
+	Middleware(next http.Handler) http.Handler
+
+	// LogFields returns the fields used to correlate log lines with the current span
+	LogFields(ctx context.Context) logrus.Fields
+
+	// Shutdown flushes any pending spans and stops the backend
+	Shutdown(ctx context.Context) error
+}
+
+var defaultTracer Tracer = &noopTracer{}
+
+// Init creates the tracer for the given exporter and makes it the default tracer
+func Init(ctx context.Context, exporter string, version string) (Tracer, error) {
+	var t Tracer
+	switch strings.ToLower(exporter) {
+	case ExporterNone:
+		t = &noopTracer{}
+	case ExporterDatadog:
+		t = newDatadogTracer()
+	case ExporterOTLP:
+		var err error
+		t, err = newOTelTracer(ctx, version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create the OpenTelemetry tracer")
+		}
+	default:
+		return nil, errors.Errorf("unknown tracing exporter '%s'", exporter)
+	}
+	defaultTracer = t
+	return t, nil
+}
+
+// StartSpan starts a new span using the default tracer
+func StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	return defaultTracer.StartSpan(ctx, name)
+}
+
+// Inject adds the trace context headers to the outgoing request headers using the default tracer
+func Inject(ctx context.Context, header http.Header) {
+	defaultTracer.Inject(ctx, header)
+}
+
+// Middleware wraps the handler so that incoming requests are traced using the default tracer
+func Middleware(next http.Handler) http.Handler {
+	return defaultTracer.Middleware(next)
+}
+
+// LogFields returns the fields used to correlate log lines with the current span using the default tracer
+func LogFields(ctx context.Context) logrus.Fields {
+	return defaultTracer.LogFields(ctx)
+}
+
+// Detach returns a context which carries the span and other values of the context but is never cancelled and has no
+// deadline, so that work which must outlive a request, such as relaying a webhook after GitHub stopped waiting for
+// the response, is still traced as part of the request
+func Detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
+
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+type noopTracer struct{}
+
+type noopSpan struct{}
+
+func (t *noopTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, &noopSpan{}
+}
+
+func (t *noopTracer) Inject(ctx context.Context, header http.Header) {
+}
+
+func (t *noopTracer) Middleware(next http.Handler) http.Handler {
+	return next
+}
+
+func (t *noopTracer) LogFields(ctx context.Context) logrus.Fields {
+	return logrus.Fields{"dd.no_trace": ""}
+}
+
+func (t *noopTracer) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (s *noopSpan) SetAttribute(key string, value interface{}) {
+}
+
+func (s *noopSpan) RecordError(err error) {
+}
+
+func (s *noopSpan) End() {
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestDetach(t *testing.T) {
+	t.Parallel()
+
+	type key struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "span"))
+	detached := Detach(ctx)
+	cancel()
+
+	assert.Error(t, ctx.Err())
+	assert.NoError(t, detached.Err())
+	assert.Nil(t, detached.Done())
+	_, ok := detached.Deadline()
+	assert.False(t, ok)
+	assert.Equal(t, "span", detached.Value(key{}))
+}
+
+func TestOTelTracerPropagatesTraceContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := newOTelTracerWithProvider(provider)
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	relayed := http.Header{}
+	var fields logrus.Fields
+	handler := tracer.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.StartSpan(r.Context(), "relay_attempt")
+		defer span.End()
+		fields = tracer.LogFields(ctx)
+		tracer.Inject(ctx, relayed)
+	}))
+
+	req, err := http.NewRequest("POST", "/hook", nil)
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	traceparent := relayed.Get("traceparent")
+	assert.True(t, strings.HasPrefix(traceparent, "00-"+traceID+"-"), "relayed traceparent %s should continue trace %s", traceparent, traceID)
+	assert.Equal(t, traceID, fields["trace_id"])
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "relay_attempt", spans[0].Name())
+	assert.Equal(t, "POST /hook", spans[1].Name())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
+
+func TestInitUnknownExporter(t *testing.T) {
+	_, err := Init(context.Background(), "zipkin", "1.0.0")
+	assert.Error(t, err)
+}
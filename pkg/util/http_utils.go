@@ -8,8 +8,6 @@ import (
 	"net"
 	"net/http"
 	"net/url"
-	"os"
-	"strconv"
 	"strings"
 	"time"
 
@@ -19,21 +17,58 @@ import (
 	"github.com/pkg/errors"
 )
 
-// defaults mirror the default http.Transport values
-var jxDefaultTransport http.RoundTripper = &http.Transport{
-	DialContext: (&net.Dialer{
-		Timeout:   time.Duration(getIntFromEnv("HTTP_DIALER_TIMEOUT", 30)) * time.Second,
-		KeepAlive: time.Duration(getIntFromEnv("HTTP_DIALER_KEEP_ALIVE", 30)) * time.Second,
-		DualStack: getBoolFromEnv("HTTP_USE_DUAL_STACK", true),
-	}).DialContext,
-	MaxIdleConns:          getIntFromEnv("HTTP_MAX_IDLE_CONNS", 100),
-	IdleConnTimeout:       time.Duration(getIntFromEnv("HTTP_IDLE_CONN_TIMEOUT", 90)) * time.Second,
-	TLSHandshakeTimeout:   time.Duration(getIntFromEnv("HTTP_TLS_HANDSHAKE_TIMEOUT", 10)) * time.Second,
-	ExpectContinueTimeout: time.Duration(getIntFromEnv("HTTP_EXPECT_CONTINUE_TIMEOUT", 1)) * time.Second,
-	Proxy:                 http.ProxyFromEnvironment,
+// TransportSettings the settings of the default HTTP transport and client
+type TransportSettings struct {
+	DialerTimeout         time.Duration
+	DialerKeepAlive       time.Duration
+	DualStack             bool
+	MaxIdleConns          int
+	IdleConnTimeout       time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ExpectContinueTimeout time.Duration
+	RequestTimeout        time.Duration
 }
 
-var defaultClient = http.Client{Transport: jxDefaultTransport, Timeout: time.Duration(getIntFromEnv("DEFAULT_HTTP_REQUEST_TIMEOUT", 30)) * time.Second}
+// DefaultTransportSettings mirror the default http.Transport values
+func DefaultTransportSettings() TransportSettings {
+	return TransportSettings{
+		DialerTimeout:         30 * time.Second,
+		DialerKeepAlive:       30 * time.Second,
+		DualStack:             true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		RequestTimeout:        30 * time.Second,
+	}
+}
+
+// NewTransport creates a new transport using the given settings
+func NewTransport(settings TransportSettings) *http.Transport {
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   settings.DialerTimeout,
+			KeepAlive: settings.DialerKeepAlive,
+			DualStack: settings.DualStack,
+		}).DialContext,
+		MaxIdleConns:          settings.MaxIdleConns,
+		IdleConnTimeout:       settings.IdleConnTimeout,
+		TLSHandshakeTimeout:   settings.TLSHandshakeTimeout,
+		ExpectContinueTimeout: settings.ExpectContinueTimeout,
+		Proxy:                 http.ProxyFromEnvironment,
+	}
+}
+
+var jxDefaultTransport http.RoundTripper = NewTransport(DefaultTransportSettings())
+
+var defaultClient = http.Client{Transport: jxDefaultTransport, Timeout: DefaultTransportSettings().RequestTimeout}
+
+// ConfigureTransport replaces the default transport and client with ones using the given settings.
+// It should be invoked on startup before any clients are created.
+func ConfigureTransport(settings TransportSettings) {
+	jxDefaultTransport = NewTransport(settings)
+	defaultClient = http.Client{Transport: jxDefaultTransport, Timeout: settings.RequestTimeout}
+}
 
 // GetClient returns a Client reference with our default configuration
 func GetClient() *http.Client {
@@ -53,28 +88,6 @@ func GetCustomClient(transport http.RoundTripper, timeout int) *http.Client {
 	return &(http.Client{Transport: transport, Timeout: time.Duration(timeout) * time.Second})
 }
 
-func getIntFromEnv(key string, fallback int) int {
-	if value, ok := os.LookupEnv(key); ok {
-		intValue, err := strconv.Atoi(value)
-		if err == nil {
-			return intValue
-		}
-		logrus.Warnf("Unable to convert env var %s with value %s to integer, using default value of %d instead", key, value, fallback)
-	}
-	return fallback
-}
-
-func getBoolFromEnv(key string, fallback bool) bool {
-	if value, ok := os.LookupEnv(key); ok {
-		boolValue, err := strconv.ParseBool(value)
-		if err == nil {
-			return boolValue
-		}
-		logrus.Warnf("Unable to convert env var %s with value %s to boolean, using default value of %t instead", key, value, fallback)
-	}
-	return fallback
-}
-
 // CallWithExponentialBackOff make a http call with exponential backoff retry
 func CallWithExponentialBackOff(url string, auth string, httpMethod string, reqBody []byte, reqParams url.Values) ([]byte, error) {
 	logrus.Debugf("%sing %s to %s", httpMethod, reqBody, url)
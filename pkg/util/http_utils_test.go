@@ -28,7 +28,7 @@ func TestGetClient(t *testing.T) {
 
 	// verify that default client timeout is correct
 	myClient := GetClient()
-	assert.Equal(t, time.Duration(getIntFromEnv("DEFAULT_HTTP_REQUEST_TIMEOUT", 30))*time.Second, myClient.Timeout)
+	assert.Equal(t, 30*time.Second, myClient.Timeout)
 
 	// verify that it times out properly
 	timeoutClient := GetClientWithTimeout(3 * time.Second)
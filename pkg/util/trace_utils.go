@@ -3,22 +3,11 @@ package util
 import (
 	"context"
 
+	"github.com/cloudbees/lighthouse-githubapp/pkg/tracing"
 	log "github.com/sirupsen/logrus"
-	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
+// TraceLogger returns a logger with the fields which correlate log lines with the current trace
 func TraceLogger(ctx context.Context) *log.Entry {
-	if ctx != nil {
-		span, exists := tracer.SpanFromContext(ctx)
-		if exists && span.Context().TraceID() != 0 {
-			traceID := span.Context().TraceID()
-			spanID := span.Context().SpanID()
-			return log.WithFields(log.Fields{
-				"dd.trace_id": traceID,
-				"dd.span_id":  spanID,
-			})
-		}
-	}
-	// add a field to indicate that this logger doesn't have any context, and thus no traceID/spanID
-	return log.WithField("dd.no_trace", "")
+	return log.WithFields(tracing.LogFields(ctx))
 }